@@ -0,0 +1,424 @@
+// admin.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ashukhotski/secret-santa-service/service"
+)
+
+const adminUsage string = `Usage: secret-santa-service [command]
+
+Commands:
+  serve                                        run the service, the default
+  events list [-team <id>] [-status <status>]  list the events of all workspaces
+  event show <eventId>                         show an event, its roster and audit log
+  event cancel -reason <text> <eventId>        cancel an event and tell its participants
+  participant remove -reason <text> <eventId> <userId>
+                                               take an unmatched participant out of an event
+  notifications replay [-user <id>] <eventId>  send again the matches that did not get through
+  migrate                                      bring the stored events up to date
+  export [-format json|csv] [-assignments] <eventId>
+                                               print an event and its participants, with
+                                               who gives to whom once it is revealed
+  import [-dry-run] <eventId> <file.csv|->     enroll the participants of a CSV roster
+  user data -team <id> <userId>                print everything stored about a user in the
+                                               events of a workspace as JSON
+  user forget -team <id> -reason <text> <userId>
+                                               erase a user from the events of a workspace
+
+The commands use the same environment as the service. What they change is
+recorded in the audit log of the event as done by an operator.
+`
+
+// adminCommand is an operator command whose arguments have been parsed, so
+// that mistakes are caught before connecting to the database.
+type adminCommand func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error
+
+// runAdmin runs an operator command and returns the exit code of the
+// process.
+func runAdmin(args []string) int {
+	cmd, err := parseAdminCommand(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+
+	logger := newLogger(os.Stderr)
+
+	serviceRepo, err := newServiceRepo()
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	keys, err := newAssignmentKeys(logger)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	p, err := newPlatforms()
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	threadKey, err := service.NewThreadKey(os.Getenv("THREAD_KEY"))
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	santa, err := service.NewSecretSanta(logger, serviceRepo, keys, threadKey, p.notifiers, p.posters)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+
+	err = cmd(context.Background(), santa, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func parseAdminCommand(args []string) (adminCommand, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command given")
+	}
+
+	name := args[0]
+	args = args[1:]
+	switch name {
+	case "events", "event", "participant", "notifications", "user":
+		if len(args) == 0 {
+			return nil, errors.New(name + " needs a subcommand")
+		}
+		name += " " + args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	switch name {
+	case "events list":
+		team := fs.String("team", "", "")
+		status := fs.String("status", "", "")
+		_, err := parseAdminArgs(fs, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			return listEvents(ctx, santa, out, *team, *status)
+		}, nil
+
+	case "event show":
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			return showEvent(ctx, santa, out, pos[0])
+		}, nil
+
+	case "event cancel":
+		reason := fs.String("reason", "", "")
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			e, err := santa.CancelEvent(ctx, pos[0], *reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Cancelled", e.Id, "and told its participants")
+			return nil
+		}, nil
+
+	case "participant remove":
+		reason := fs.String("reason", "", "")
+		pos, err := parseAdminArgs(fs, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			err := santa.RemoveParticipant(ctx, pos[0], pos[1], *reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Removed", pos[1], "from", pos[0])
+			return nil
+		}, nil
+
+	case "notifications replay":
+		user := fs.String("user", "", "")
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			delivered, failed, err := santa.ReplayNotifications(ctx, pos[0], *user)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, delivered, "delivered,", failed, "failed")
+			if failed > 0 {
+				return errors.New("some matches could not be delivered, see the log for why")
+			}
+			return nil
+		}, nil
+
+	case "migrate":
+		_, err := parseAdminArgs(fs, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			report, err := santa.Migrate(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Events:", report.Events)
+			fmt.Fprintln(out, "Owners set:", report.OwnersSet)
+			fmt.Fprintln(out, "Platforms set:", report.PlatformsSet)
+			fmt.Fprintln(out, "Santas sealed:", report.Sealed)
+			return nil
+		}, nil
+
+	case "export":
+		format := fs.String("format", service.ExportFormatJson, "")
+		assignments := fs.Bool("assignments", false, "")
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		*format, err = service.ParseExportFormat(*format)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			export, err := santa.ExportEvent(ctx, pos[0], *assignments)
+			if err != nil {
+				return err
+			}
+			if *format == service.ExportFormatCsv {
+				return service.WriteRosterCsv(out, export)
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(export)
+		}, nil
+
+	case "import":
+		dryRun := fs.Bool("dry-run", false, "")
+		pos, err := parseAdminArgs(fs, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			return importRoster(ctx, santa, out, pos[0], pos[1], *dryRun)
+		}, nil
+
+	case "user data":
+		team := fs.String("team", "", "")
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if *team == "" {
+			return nil, errors.New(name + " needs the workspace of the user as -team <id>")
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			data, err := santa.FindPersonalData(ctx, *team, pos[0])
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(data)
+		}, nil
+
+	case "user forget":
+		team := fs.String("team", "", "")
+		reason := fs.String("reason", "", "")
+		pos, err := parseAdminArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if *team == "" {
+			return nil, errors.New(name + " needs the workspace of the user as -team <id>")
+		}
+		return func(ctx context.Context, santa *service.SecretSanta, out io.Writer) error {
+			report, err := santa.ForgetUser(ctx, *team, pos[0], *reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Events:", report.Events)
+			fmt.Fprintln(out, "Removed from:", report.Removed)
+			fmt.Fprintln(out, "Anonymized in:", report.Anonymized)
+			fmt.Fprintln(out, "Santa copies erased:", report.SantaCopies)
+			fmt.Fprintln(out, "Messages erased:", report.Messages)
+			return nil
+		}, nil
+
+	default:
+		return nil, errors.New("unknown command " + name)
+	}
+}
+
+// parseAdminArgs parses the flags of a command, which may come before or
+// after its n positional arguments, and returns the latter.
+func parseAdminArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	var pos []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, errors.New(fs.Name() + ": " + err.Error())
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(pos) != n {
+		return nil, errors.New(fs.Name() + " takes " + strconv.Itoa(n) + " arguments, not " + strconv.Itoa(len(pos)))
+	}
+	return pos, nil
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func listEvents(ctx context.Context, santa *service.SecretSanta, out io.Writer, team string, status string) error {
+	events, err := santa.ListEvents(ctx, team, status)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPLATFORM\tTEAM\tCHANNEL\tNAME\tYEAR\tSTATUS\tOWNER")
+	for _, e := range events {
+		platform := e.Platform
+		if platform == "" {
+			platform = service.PlatformSlack
+		}
+		status := e.Status
+		if status == "" {
+			status = service.EventStatusOpen
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			e.Id, platform, value(e.TeamId), value(e.ChannelId), e.Name, e.Year, status, e.OwnerId)
+	}
+	return tw.Flush()
+}
+
+func showEvent(ctx context.Context, santa *service.SecretSanta, out io.Writer, id string) error {
+	report, err := santa.ShowEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	e := report.Event
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Event:\t%s\n", e.Id)
+	fmt.Fprintf(tw, "Name:\t%s\n", e.Name)
+	fmt.Fprintf(tw, "Platform:\t%s\n", e.Platform)
+	fmt.Fprintf(tw, "Team:\t%s\n", value(e.TeamId))
+	fmt.Fprintf(tw, "Channel:\t%s\n", value(e.ChannelId))
+	fmt.Fprintf(tw, "Year:\t%d\n", e.Year)
+	fmt.Fprintf(tw, "Status:\t%s\n", report.Status.Status)
+	fmt.Fprintf(tw, "Owner:\t%s\n", e.OwnerId)
+	fmt.Fprintf(tw, "Co-hosts:\t%s\n", strings.Join(e.CoHostIds, ", "))
+	if !e.LockedUntil.IsZero() {
+		fmt.Fprintf(tw, "Locked until:\t%s\n", e.LockedUntil.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(tw, "Enrolled:\t%d, %d matched, %d notified, %d failed, %d without address\n",
+		report.Status.Enrolled, report.Status.Matched, report.Status.Notified,
+		report.Status.NotificationsFailed, report.Status.WithoutAddress)
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	tw = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tNAME\tHOST\tADDRESS\tMATCHED\tNOTIFICATION\tGIFT")
+	for _, p := range report.Participants {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%t\t%s\t%s\n",
+			p.UserId, p.UserName, p.IsHost, p.HasAddress, p.IsMatched, p.Notification, p.GiftStatus)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Audit log:")
+	for _, entry := range report.Audit {
+		line := entry.At.Format("2006-01-02 15:04") + " " + entry.ActorId + " " + entry.Action
+		if entry.TargetId != "" {
+			line += " " + entry.TargetId
+		}
+		if entry.Details != "" {
+			line += " (" + entry.Details + ")"
+		}
+		fmt.Fprintln(out, line)
+	}
+	if len(report.Audit) == 0 {
+		fmt.Fprintln(out, "Nothing has been recorded yet.")
+	}
+	return nil
+}
+
+// importRoster imports the roster in the file, or on standard input if the
+// file is "-", and prints the report. Rows left out make it fail, so that
+// scripts notice.
+func importRoster(ctx context.Context, santa *service.SecretSanta, out io.Writer, id string, file string, dryRun bool) error {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	report, err := santa.ImportRoster(ctx, id, in, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range report.Problems {
+		line := "Row " + strconv.Itoa(p.Row) + ": "
+		if p.UserId != "" {
+			line += p.UserId + ": "
+		}
+		fmt.Fprintln(out, line+p.Message)
+	}
+	verb := "enrolled"
+	if dryRun {
+		verb = "would be enrolled"
+	}
+	fmt.Fprintln(out, report.Rows, "rows,", len(report.Enrolled), verb+",", len(report.Problems), "left out")
+	if len(report.Problems) > 0 {
+		return errors.New("some rows were left out")
+	}
+	return nil
+}
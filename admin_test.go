@@ -0,0 +1,85 @@
+// admin_test.go
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestParseAdminCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"no command", nil, true},
+		{"unknown command", []string{"drop"}, true},
+		{"missing subcommand", []string{"event"}, true},
+		{"unknown subcommand", []string{"event", "delete", "e1"}, true},
+		{"events list", []string{"events", "list"}, false},
+		{"events list with flags", []string{"events", "list", "-team", "T1", "-status", "open"}, false},
+		{"events list with argument", []string{"events", "list", "e1"}, true},
+		{"event show", []string{"event", "show", "e1"}, false},
+		{"event show without id", []string{"event", "show"}, true},
+		{"event cancel", []string{"event", "cancel", "e1", "-reason", "duplicate"}, false},
+		{"participant remove", []string{"participant", "remove", "e1", "U1"}, false},
+		{"participant remove without user", []string{"participant", "remove", "e1"}, true},
+		{"notifications replay", []string{"notifications", "replay", "-user", "U1", "e1"}, false},
+		{"migrate", []string{"migrate"}, false},
+		{"unknown flag", []string{"migrate", "-force"}, true},
+		{"export", []string{"export", "e1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parseAdminCommand(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAdminCommand(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if !tt.wantErr && cmd == nil {
+				t.Errorf("parseAdminCommand(%q) returned no command", tt.args)
+			}
+		})
+	}
+}
+
+func TestParseAdminArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		n          int
+		want       []string
+		wantReason string
+		wantErr    bool
+	}{
+		{"positional only", []string{"e1", "U1"}, 2, []string{"e1", "U1"}, "", false},
+		{"flag first", []string{"-reason", "moved", "e1"}, 1, []string{"e1"}, "moved", false},
+		{"flag last", []string{"e1", "-reason", "moved"}, 1, []string{"e1"}, "moved", false},
+		{"flag between", []string{"e1", "-reason=moved", "U1"}, 2, []string{"e1", "U1"}, "moved", false},
+		{"too few", []string{"e1"}, 2, nil, "", true},
+		{"too many", []string{"e1", "e2"}, 1, nil, "", true},
+		{"flag without value", []string{"e1", "-reason"}, 1, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			reason := fs.String("reason", "", "")
+
+			got, err := parseAdminArgs(fs, tt.args, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAdminArgs(%q, %d) error = %v, wantErr %v", tt.args, tt.n, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAdminArgs(%q, %d) = %q, want %q", tt.args, tt.n, got, tt.want)
+			}
+			if *reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", *reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -18,17 +19,12 @@ import (
 )
 
 func main() {
-	dir := filepath.Join(".", "logs")
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		os.Mkdir(dir, os.ModeDir)
-	}
-	fname := time.Now().Format("2006-01-02") + ".txt"
-	file, err := os.OpenFile(filepath.Join(dir, fname), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Fatal(err)
+	// Anything but serve is an operator command, see admin.go.
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runAdmin(os.Args[1:]))
 	}
-	mw := io.MultiWriter(os.Stdout, file)
-	logger := log.New(mw, "secret-santa-service: ", log.LstdFlags|log.Lshortfile)
+
+	logger := newLogger(os.Stdout)
 
 	errChan := make(chan error)
 
@@ -38,23 +34,166 @@ func main() {
 		errChan <- fmt.Errorf("%s", <-c)
 	}()
 
-	connString := fmt.Sprintf("mongodb://%s:%s@%s",
-		os.Getenv("MONGO_INITDB_ROOT_USERNAME"),
-		os.Getenv("MONGO_INITDB_ROOT_PASSWORD"),
-		os.Getenv("DB_ADDRESS"))
-	serviceRepo, err := service.NewServiceRepo(connString, os.Getenv("DB_NAME"))
+	serviceRepo, err := newServiceRepo()
 	if err != nil {
 		logger.Println(err)
 	}
 
-	h := service.NewHandlers(logger, *serviceRepo)
+	// The indexes of the participant collections are left to migrate, the
+	// others, such as the unique names of open events, are needed at once.
+	err = serviceRepo.EnsureIndexes(context.Background(), nil)
+	if err != nil {
+		logger.Println("could not create the database indexes:", err)
+	}
+
+	keys, err := newAssignmentKeys(logger)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	p, err := newPlatforms()
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	if p.discord != nil {
+		err = p.discord.RegisterCommands()
+		if err != nil {
+			logger.Println("could not register the Discord commands:", err)
+		}
+	}
+
+	apiKeys, err := service.NewApiKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	web, err := service.NewWebUI(
+		os.Getenv("WEB_URL"),
+		os.Getenv("SLACK_CLIENT_ID"),
+		os.Getenv("SLACK_CLIENT_SECRET"),
+		os.Getenv("WEB_SESSION_KEY"))
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	threadKey, err := service.NewThreadKey(os.Getenv("THREAD_KEY"))
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	santa, err := service.NewSecretSanta(logger, serviceRepo, keys, threadKey, p.notifiers, p.posters)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	signingSecret := os.Getenv("SLACK_SIGNING_SECRET")
+	if signingSecret == "" {
+		logger.Println("SLACK_SIGNING_SECRET is not set, Slack requests are turned down")
+	}
+
+	h := service.NewHandlers(santa, os.Getenv("SLACK_BOT_TOKEN"), signingSecret, apiKeys, web, p.teams, p.discord, p.mattermost)
 
 	router := mux.NewRouter()
 	h.SetupRoutes(router)
 
+	scheduler := service.NewScheduler(logger, serviceRepo)
+	h.SetupJobs(scheduler)
+	go scheduler.Run(context.Background())
+
 	go func() {
 		errChan <- http.ListenAndServe(":8080", router)
 	}()
 
 	log.Fatalln(<-errChan)
 }
+
+func newLogger(out io.Writer) *log.Logger {
+	dir := filepath.Join(".", "logs")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		os.Mkdir(dir, os.ModeDir)
+	}
+	fname := time.Now().Format("2006-01-02") + ".txt"
+	file, err := os.OpenFile(filepath.Join(dir, fname), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mw := io.MultiWriter(out, file)
+	return log.New(mw, "secret-santa-service: ", log.LstdFlags|log.Lshortfile)
+}
+
+func newServiceRepo() (*service.ServiceRepo, error) {
+	connString := fmt.Sprintf("mongodb://%s:%s@%s",
+		os.Getenv("MONGO_INITDB_ROOT_USERNAME"),
+		os.Getenv("MONGO_INITDB_ROOT_PASSWORD"),
+		os.Getenv("DB_ADDRESS"))
+	return service.NewServiceRepo(connString, os.Getenv("DB_NAME"))
+}
+
+func newAssignmentKeys(logger *log.Logger) (*service.AssignmentKeys, error) {
+	keys, err := service.NewAssignmentKeys(os.Getenv("ASSIGNMENT_MASTER_KEY"))
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		logger.Println("ASSIGNMENT_MASTER_KEY is not set, pairs are stored unencrypted")
+	}
+	return keys, nil
+}
+
+// platforms are the chat platforms and other channels participants are
+// reached on, as configured by the environment.
+type platforms struct {
+	discord    *service.DiscordClient
+	mattermost *service.MattermostClient
+	notifiers  service.Notifiers
+	posters    service.ChannelPosters
+	teams      *service.TeamsClient
+}
+
+func newPlatforms() (*platforms, error) {
+	p := &platforms{
+		notifiers: service.Notifiers{service.NewSlackNotifier(os.Getenv("SLACK_BOT_TOKEN"))},
+		posters:   service.ChannelPosters{service.NewSlackPoster(os.Getenv("SLACK_BOT_TOKEN"))},
+	}
+
+	email, err := service.NewEmailNotifier(
+		os.Getenv("SMTP_HOST"),
+		os.Getenv("SMTP_PORT"),
+		os.Getenv("SMTP_USERNAME"),
+		os.Getenv("SMTP_PASSWORD"),
+		os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return nil, err
+	}
+	if email != nil {
+		p.notifiers = append(p.notifiers, email)
+	}
+
+	p.teams = service.NewTeamsClient(os.Getenv("TEAMS_APP_ID"), os.Getenv("TEAMS_APP_PASSWORD"))
+	if p.teams != nil {
+		p.notifiers = append(p.notifiers, service.NewTeamsNotifier(p.teams))
+		p.posters = append(p.posters, service.NewTeamsPoster(p.teams))
+	}
+
+	p.discord, err = service.NewDiscordClient(
+		os.Getenv("DISCORD_APP_ID"),
+		os.Getenv("DISCORD_PUBLIC_KEY"),
+		os.Getenv("DISCORD_BOT_TOKEN"))
+	if err != nil {
+		return nil, err
+	}
+	if p.discord != nil {
+		p.notifiers = append(p.notifiers, service.NewDiscordNotifier(p.discord))
+		p.posters = append(p.posters, service.NewDiscordPoster(p.discord))
+	}
+
+	p.mattermost = service.NewMattermostClient(
+		os.Getenv("MATTERMOST_URL"),
+		os.Getenv("MATTERMOST_BOT_TOKEN"),
+		os.Getenv("MATTERMOST_COMMAND_TOKENS"))
+	if p.mattermost != nil {
+		p.notifiers = append(p.notifiers, service.NewMattermostNotifier(p.mattermost))
+		p.posters = append(p.posters, service.NewMattermostPoster(p.mattermost))
+	}
+
+	return p, nil
+}
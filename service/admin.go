@@ -0,0 +1,284 @@
+// admin.go
+package service
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OperatorId is the actor the audit log names for what operators do from
+// the command line, as opposed to the hosts of an event.
+const OperatorId string = "operator"
+
+const (
+	AdminActionRemoveParticipant   string = "removeParticipant"
+	AdminActionReplayNotifications string = "replayNotifications"
+)
+
+// EventReport is what operators see of an event: its participants and how
+// far they have come, but never who gives to whom.
+type EventReport struct {
+	Audit        []AuditEntry
+	Event        *Event
+	Participants []ApiParticipant
+	Status       *ApiStatus
+}
+
+// MigrationReport counts what Migrate brought up to date.
+type MigrationReport struct {
+	Events       int
+	OwnersSet    int
+	PlatformsSet int
+	Sealed       int
+}
+
+// ListEvents returns the events of every workspace, newest first. An empty
+// team or status matches all of them.
+func (s *SecretSanta) ListEvents(ctx context.Context, teamId string, status string) ([]Event, error) {
+	events, err := s.repo.GetAllEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Event
+	for _, e := range events {
+		if teamId != "" && (e.TeamId == nil || *e.TeamId != teamId) {
+			continue
+		}
+		if status != "" && apiEvent(&e).Status != status {
+			continue
+		}
+		found = append(found, e)
+	}
+	return found, nil
+}
+
+// ShowEvent returns the event with its roster, sorted by user ID, and the
+// latest entries of its audit log.
+func (s *SecretSanta) ShowEvent(ctx context.Context, id string) (*EventReport, error) {
+	e, err := s.repo.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserId < participants[j].UserId
+	})
+
+	entries, err := s.repo.GetAuditEntries(ctx, e.Id, auditPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EventReport{
+		Audit:        entries,
+		Event:        e,
+		Participants: []ApiParticipant{},
+		Status:       apiStatus(e, participants),
+	}
+	for i := range participants {
+		report.Participants = append(report.Participants, apiParticipant(&participants[i]))
+	}
+	return report, nil
+}
+
+// CancelEvent cancels an event on behalf of the operators, e.g. when its
+// owner has left the company. The reason is recorded in the audit log.
+func (s *SecretSanta) CancelEvent(ctx context.Context, id string, reason string) (*Event, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, invalidError("Please give a reason, it is recorded in the audit log")
+	}
+
+	e, err := s.repo.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status == EventStatusArchived {
+		return nil, conflictError(eventTitle(e) + " has already been revealed")
+	}
+
+	text := eventTitle(e) + " has been cancelled by the Secret Santa operators. Sorry, there will be no gift exchange this time."
+	return s.cancelEvent(ctx, e, OperatorId, reason, text)
+}
+
+// RemoveParticipant takes a participant out of an event, e.g. when they
+// have left the company. Once pairs are drawn somebody gives them a gift,
+// so the matches have to be reset first.
+func (s *SecretSanta) RemoveParticipant(ctx context.Context, eventId string, uid string, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return invalidError("Please give a reason, it is recorded in the audit log")
+	}
+
+	e, err := s.lockEvent(ctx, eventId, nil)
+	if err != nil {
+		return err
+	}
+	defer s.unlockEvent(ctx, e.Id, nil)
+
+	p, err := s.repo.GetParticipantById(ctx, e.Id, uid)
+	if err != nil {
+		return notFoundError(uid + " is not taking part in " + eventTitle(e))
+	}
+	if p.IsMatched {
+		return conflictError(uid + " has already been matched in " + eventTitle(e) + ", please have a host reset the matches with /santa reset first")
+	}
+
+	err = s.repo.RemoveParticipant(ctx, e.Id, uid)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, e, OperatorId, AdminActionRemoveParticipant, uid, reason)
+	return nil
+}
+
+// ReplayNotifications sends santas their match once more: the given user,
+// or, without one, everybody whose match notification failed or was never
+// recorded. It returns how many notices got through and how many failed
+// again.
+func (s *SecretSanta) ReplayNotifications(ctx context.Context, eventId string, uid string) (int, int, error) {
+	e, err := s.repo.GetEvent(ctx, eventId)
+	if err != nil {
+		return 0, 0, err
+	}
+	if e.Status != EventStatusMatched {
+		return 0, 0, conflictError(eventTitle(e) + " pairs have not been matched yet, or the event is over")
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	wishlists := make(map[string]*Wishlist)
+	for _, participant := range participants {
+		wishlists[participant.UserId] = participant.Wishlist
+	}
+
+	found := false
+	delivered, failed := 0, 0
+	for i := range participants {
+		p := &participants[i]
+		if uid != "" && p.UserId != uid {
+			continue
+		}
+		found = true
+		if !p.IsMatched {
+			continue
+		}
+		if uid == "" && p.Notification != nil && p.Notification.Delivered {
+			continue
+		}
+
+		s.openMatches(e, p)
+		err = s.notifyMatch(ctx, e, p, wishlists)
+		if err != nil {
+			failed++
+		} else {
+			delivered++
+		}
+	}
+	if uid != "" && !found {
+		return 0, 0, notFoundError(uid + " is not taking part in " + eventTitle(e))
+	}
+
+	if delivered+failed > 0 {
+		details := strconv.Itoa(delivered) + " delivered, " + strconv.Itoa(failed) + " failed"
+		s.audit(ctx, e, OperatorId, AdminActionReplayNotifications, uid, details)
+	}
+	return delivered, failed, nil
+}
+
+// Migrate brings the stored events up to date with what the service
+// expects, so that nothing is left to be fixed on first use: events get a
+// platform and an owner, participant collections their indexes, and, if
+// assignment keys are configured, pairs stored in the clear are sealed.
+// It may be run any number of times.
+func (s *SecretSanta) Migrate(ctx context.Context) (*MigrationReport, error) {
+	events, err := s.repo.GetAllEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{Events: len(events)}
+	var ids []string
+	for i := range events {
+		e := &events[i]
+		ids = append(ids, e.Id)
+
+		if e.OwnerId == "" {
+			err = s.backfillOwner(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			if e.OwnerId != "" {
+				report.OwnersSet++
+			}
+		}
+
+		if e.Platform == "" {
+			_, err = s.updateEvent(ctx, e.Id, func(e *Event) error {
+				e.Platform = PlatformSlack
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			report.PlatformsSet++
+		}
+
+		if s.keys == nil {
+			continue
+		}
+		sealed, err := s.sealStoredMatches(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		report.Sealed += sealed
+	}
+
+	err = s.repo.EnsureIndexes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// sealStoredMatches seals the pairs of an event that were drawn before
+// assignment keys were configured, and returns how many santas it sealed.
+func (s *SecretSanta) sealStoredMatches(ctx context.Context, e *Event) (int, error) {
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range participants {
+		p := &participants[i]
+		matches := giftees(p)
+		if p.SealedMatches != "" || len(matches) == 0 {
+			continue
+		}
+
+		var tags []string
+		for _, m := range matches {
+			tags = append(tags, s.keys.santaTag(e.Id, m.UserId))
+		}
+		sealed, err := s.keys.sealMatches(e.Id, p.UserId, matches)
+		if err != nil {
+			return count, err
+		}
+		err = s.repo.SealParticipantMatches(ctx, e.Id, p.UserId, sealed, tags)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,637 @@
+// api.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	apiUserIdHeader   string = "X-Santa-User-Id"
+	apiUserNameHeader string = "X-Santa-User-Name"
+)
+
+// ApiActionReadAssignment is audited whenever a user's giftees are read
+// through the API.
+const ApiActionReadAssignment string = "apiReadAssignment"
+
+//go:embed openapi.yaml
+var openApiDocument []byte
+
+// apiWorkspace is the workspace an API key gives access to: a team of a
+// chat platform, e.g. a Slack workspace or a Teams tenant. Keys bound to a
+// user only act on their behalf. keyId names the key in the audit log.
+type apiWorkspace struct {
+	keyId    string
+	platform string
+	teamId   string
+	userId   string
+}
+
+// ApiKeys authenticates the callers of the JSON API. Each key gives access
+// to the events of one workspace, on behalf of any of its users unless it
+// is bound to one, so workspace keys are meant for trusted systems such as
+// an intranet. Only keys bound to a user can read whom they give to. Only
+// the hashes of the keys are kept.
+type ApiKeys struct {
+	workspaces map[string]apiWorkspace
+}
+
+// NewApiKeys parses API keys written as [platform/]teamId[@userId]:key
+// and separated by commas, e.g. "T0123:s3cret,teams/7a9c…:0th3r,
+// T0123@U0456:m1ne". The platform is Slack unless given. It returns nil if
+// no keys are configured.
+func NewApiKeys(keys string) (*ApiKeys, error) {
+	workspaces := make(map[string]apiWorkspace)
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.Index(entry, ":")
+		if i < 1 || i == len(entry)-1 {
+			return nil, errors.New("API keys must be written as [platform/]teamId[@userId]:key")
+		}
+		hash := hashApiKey(entry[i+1:])
+		ws := apiWorkspace{keyId: hash[:8], platform: PlatformSlack, teamId: entry[:i]}
+		if j := strings.Index(ws.teamId, "/"); j >= 0 {
+			ws.platform, ws.teamId = ws.teamId[:j], ws.teamId[j+1:]
+		}
+		if j := strings.Index(ws.teamId, "@"); j >= 0 {
+			ws.teamId, ws.userId = ws.teamId[:j], ws.teamId[j+1:]
+			if ws.teamId == "" || ws.userId == "" {
+				return nil, errors.New("API keys must be written as [platform/]teamId[@userId]:key")
+			}
+		}
+		switch ws.platform {
+		case PlatformDiscord, PlatformMattermost, PlatformSlack, PlatformTeams:
+		default:
+			return nil, errors.New("unknown platform " + ws.platform + " of an API key")
+		}
+
+		workspaces[hash] = ws
+	}
+	if len(workspaces) == 0 {
+		return nil, nil
+	}
+	return &ApiKeys{workspaces: workspaces}, nil
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// workspace returns the workspace of the bearer token of the request.
+func (k *ApiKeys) workspace(r *http.Request) (apiWorkspace, bool) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if key == "" {
+		return apiWorkspace{}, false
+	}
+	ws, ok := k.workspaces[hashApiKey(key)]
+	return ws, ok
+}
+
+func (h *Handlers) setupApiRoutes(mux *mux.Router) {
+	api := mux.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.yaml", h.OpenApiHandler).Methods(http.MethodGet)
+	api.HandleFunc("/events", h.apiHandler(h.apiListEvents)).Methods(http.MethodGet)
+	api.HandleFunc("/events", h.apiHandler(h.apiCreateEvent)).Methods(http.MethodPost)
+	api.HandleFunc("/events/{eventId}", h.apiHandler(h.apiGetEvent)).Methods(http.MethodGet)
+	api.HandleFunc("/events/{eventId}/assignment", h.apiHandler(h.apiGetAssignment)).Methods(http.MethodGet)
+	api.HandleFunc("/events/{eventId}/draw", h.apiHandler(h.apiDraw)).Methods(http.MethodPost)
+	api.HandleFunc("/events/{eventId}/export", h.apiHandler(h.apiExport)).Methods(http.MethodGet)
+	api.HandleFunc("/events/{eventId}/participants", h.apiHandler(h.apiListParticipants)).Methods(http.MethodGet)
+	api.HandleFunc("/events/{eventId}/participants", h.apiHandler(h.apiEnroll)).Methods(http.MethodPost)
+	api.HandleFunc("/events/{eventId}/participants/import", h.apiHandler(h.apiImport)).Methods(http.MethodPost)
+	api.HandleFunc("/events/{eventId}/status", h.apiHandler(h.apiGetStatus)).Methods(http.MethodGet)
+}
+
+// OpenApiHandler serves the OpenAPI document describing the JSON API.
+func (h *Handlers) OpenApiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openApiDocument)
+}
+
+// apiHandler authenticates a request of the JSON API and passes its
+// caller on: a user of the key's workspace, named by the X-Santa-User-Id
+// and X-Santa-User-Name headers, or the user the key is bound to.
+func (h *Handlers) apiHandler(fn func(w http.ResponseWriter, r *http.Request, c *Caller)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.apiKeys == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ws, ok := h.apiKeys.workspace(r)
+		if !ok {
+			writeApiError(w, http.StatusUnauthorized, "unauthorized", "Please provide a valid API key as a bearer token")
+			return
+		}
+
+		uid := strings.TrimSpace(r.Header.Get(apiUserIdHeader))
+		if ws.userId != "" {
+			if uid != "" && uid != ws.userId {
+				writeApiError(w, http.StatusForbidden, ErrorKindForbidden, "This API key only acts on behalf of the user it is bound to")
+				return
+			}
+			uid = ws.userId
+		}
+
+		fn(w, r, &Caller{
+			Platform: ws.platform,
+			TeamId:   String(ws.teamId),
+			UserId:   uid,
+			UserName: strings.TrimSpace(r.Header.Get(apiUserNameHeader)),
+		})
+	}
+}
+
+func writeApiJson(w http.ResponseWriter, status int, v interface{}) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeApiError(w http.ResponseWriter, status int, kind string, msg string) {
+	writeApiJson(w, status, &ApiError{Error: ApiErrorDetails{Kind: kind, Message: msg}})
+}
+
+// httpStatus is the status code answering an error of the given kind.
+func httpStatus(kind string) int {
+	switch kind {
+	case ErrorKindConflict:
+		return http.StatusConflict
+	case ErrorKindForbidden:
+		return http.StatusForbidden
+	case ErrorKindInvalid:
+		return http.StatusBadRequest
+	case ErrorKindNotFound:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// writeApiFailure answers an error with the status code of its kind.
+// Errors that are not domain errors are logged but not shown, as they may
+// tell about the internals of the service.
+func (h *Handlers) writeApiFailure(w http.ResponseWriter, err error) {
+	h.logger.Println(err)
+
+	kind := ErrorKind(err)
+	if kind == "" {
+		writeApiError(w, http.StatusInternalServerError, "internal", "Something went wrong, please try again later")
+		return
+	}
+	writeApiError(w, httpStatus(kind), kind, err.Error())
+}
+
+func decodeApiRequest(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return invalidError("The request body is not valid JSON: " + err.Error())
+	}
+	return nil
+}
+
+func requireApiUser(c *Caller) error {
+	if c.UserId == "" {
+		return invalidError("Please name the user acting with the " + apiUserIdHeader + " header")
+	}
+	return nil
+}
+
+// requireUserKey returns the workspace of the request's key, refusing
+// workspace keys, which may name any user, the owner included, for what
+// only the acting user should do.
+func (h *Handlers) requireUserKey(r *http.Request, action string) (apiWorkspace, error) {
+	ws, _ := h.apiKeys.workspace(r)
+	if ws.userId == "" {
+		return ws, forbiddenError(action + " only with an API key bound to the user")
+	}
+	return ws, nil
+}
+
+// workspaceEvent returns the event with the given ID if it belongs to the
+// workspace of the caller, whose channel becomes the event's.
+func (s *SecretSanta) workspaceEvent(ctx context.Context, c *Caller, id string) (*Event, error) {
+	e, err := s.repo.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if eventPlatform(e) != c.Platform || e.TeamId == nil || c.TeamId == nil || *e.TeamId != *c.TeamId {
+		return nil, ErrEventNotFound
+	}
+
+	c.ChannelId = e.ChannelId
+	c.EnterpriseId = e.EnterpriseId
+	c.ServiceUrl = e.ServiceUrl
+	return e, nil
+}
+
+// checkEventActive keeps participants from joining and hosts from drawing
+// events that are over.
+func checkEventActive(e *Event) error {
+	if !isActiveEvent(e) {
+		return conflictError(eventTitle(e) + " has been " + e.Status)
+	}
+	return nil
+}
+
+func apiEvent(e *Event) ApiEvent {
+	status := e.Status
+	if status == "" {
+		status = EventStatusOpen
+	}
+	a := ApiEvent{
+		Id:                 e.Id,
+		Budget:             e.Budget,
+		ChannelId:          e.ChannelId,
+		CoHostIds:          e.CoHostIds,
+		Currency:           e.Currency,
+		EnrollmentClosesAt: e.Reminders.EnrollmentClosesAt,
+		ExchangeDate:       e.ExchangeDate,
+		GifteesEach:        e.GifteesEach,
+		MatchByRegion:      e.MatchByRegion,
+		Name:               eventTitle(e),
+		OwnerId:            e.OwnerId,
+		RevealAt:           e.Reminders.RevealAt,
+		Rules:              e.Rules,
+		Status:             status,
+		Theme:              e.Theme,
+		Year:               e.Year,
+	}
+	if a.CoHostIds == nil {
+		a.CoHostIds = []string{}
+	}
+	if e.Draw != nil {
+		a.Commitment = e.Draw.Commitment
+	}
+	return a
+}
+
+func apiParticipant(p *Participant) ApiParticipant {
+	a := ApiParticipant{
+		GiftStatus: giftStatus(p),
+		HasAddress: hasAddress(p),
+		IsHost:     p.IsHost,
+		IsMatched:  p.IsMatched,
+		UserId:     p.UserId,
+		UserName:   p.UserName,
+	}
+	if p.Notification != nil {
+		a.Notification = "delivered"
+		if !p.Notification.Delivered {
+			a.Notification = "failed"
+		}
+	}
+	return a
+}
+
+func apiWishlist(wl *Wishlist) *ApiWishlist {
+	if wl == nil {
+		return nil
+	}
+	return &ApiWishlist{
+		Allergies: wl.Allergies,
+		Items:     wl.Items,
+		Links:     wl.Links,
+		NoThanks:  wl.NoThanks,
+		Sizes:     wl.Sizes,
+	}
+}
+
+// apiListEvents lists the events of a channel, given as the channelId
+// query parameter, newest first.
+func (h *Handlers) apiListEvents(w http.ResponseWriter, r *http.Request, c *Caller) {
+	channelId := r.URL.Query().Get("channelId")
+	if channelId == "" {
+		h.writeApiFailure(w, invalidError("Please provide the channelId query parameter"))
+		return
+	}
+	c.ChannelId = String(channelId)
+
+	events, err := h.channelEvents(r.Context(), c)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	list := []ApiEvent{}
+	for i := range events {
+		list = append(list, apiEvent(&events[i]))
+	}
+	writeApiJson(w, http.StatusOK, list)
+}
+
+func (h *Handlers) apiCreateEvent(w http.ResponseWriter, r *http.Request, c *Caller) {
+	var req ApiEventRequest
+	err := decodeApiRequest(r, &req)
+	if err == nil {
+		err = requireApiUser(c)
+	}
+	if err == nil && req.ChannelId == "" {
+		err = invalidError("Please provide the channelId of the event")
+	}
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	// The bot learns how to reach the participants of Teams events from the
+	// message that initializes them.
+	if c.Platform == PlatformTeams {
+		h.writeApiFailure(w, invalidError("Teams events need to be initialized in Teams"))
+		return
+	}
+
+	// Settings given in chat are picked out of the text, so unknown ones
+	// are never seen there; here they are most likely a mistake.
+	known := make(map[string]bool)
+	for _, key := range settingKeys {
+		known[key] = true
+	}
+	for key := range req.Settings {
+		if !known[key] {
+			h.writeApiFailure(w, invalidError("Unknown setting "+key+", the settings are "+strings.Join(settingKeys, ", ")))
+			return
+		}
+	}
+
+	c.ChannelId = String(req.ChannelId)
+	e, err := h.createEvent(r.Context(), c, req.Name, strings.TrimSpace(req.Address), req.Organize, req.Settings)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusCreated, apiEvent(e))
+}
+
+func (h *Handlers) apiGetEvent(w http.ResponseWriter, r *http.Request, c *Caller) {
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusOK, apiEvent(e))
+}
+
+// apiEnroll enrolls the calling user in the event.
+func (h *Handlers) apiEnroll(w http.ResponseWriter, r *http.Request, c *Caller) {
+	var req ApiEnrollRequest
+	err := decodeApiRequest(r, &req)
+	if err == nil {
+		err = requireApiUser(c)
+	}
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	email, err := parseEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err == nil {
+		err = checkEventActive(e)
+	}
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	p, err := h.enroll(r.Context(), c, e, strings.TrimSpace(req.Address), email)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusCreated, apiParticipant(p))
+}
+
+// apiListParticipants shows hosts who has enrolled in the event, sorted
+// by user like /santa status.
+func (h *Handlers) apiListParticipants(w http.ResponseWriter, r *http.Request, c *Caller) {
+	_, participants, err := h.apiRoster(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	list := []ApiParticipant{}
+	for i := range participants {
+		list = append(list, apiParticipant(&participants[i]))
+	}
+	writeApiJson(w, http.StatusOK, list)
+}
+
+func (h *Handlers) apiGetStatus(w http.ResponseWriter, r *http.Request, c *Caller) {
+	e, participants, err := h.apiRoster(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	writeApiJson(w, http.StatusOK, apiStatus(e, participants))
+}
+
+func apiStatus(e *Event, participants []Participant) *ApiStatus {
+	counts := countParticipants(participants)
+	return &ApiStatus{
+		Enrolled:            len(participants),
+		GiftsPurchased:      counts.purchased,
+		GiftsReceived:       counts.received,
+		GiftsShipped:        counts.shipped,
+		Matched:             counts.matched,
+		NotificationsFailed: counts.failed,
+		Notified:            counts.notified,
+		Status:              apiEvent(e).Status,
+		WithoutAddress:      counts.noAddress,
+	}
+}
+
+// apiRoster returns the event and its participants if the caller may view
+// its status.
+func (h *Handlers) apiRoster(ctx context.Context, c *Caller, id string) (*Event, []Participant, error) {
+	err := requireApiUser(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e, err := h.workspaceEvent(ctx, c, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = authorizeHost(e, c.UserId, HostActionViewStatus)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	participants, err := h.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserId < participants[j].UserId
+	})
+	return e, participants, nil
+}
+
+// apiExport exports the event for its owner as JSON, or as a CSV roster
+// with format=csv. With assignments=true the giftees are included once
+// the pairs have been revealed. As exports hold everybody's address, they
+// need a key bound to the owner.
+func (h *Handlers) apiExport(w http.ResponseWriter, r *http.Request, c *Caller) {
+	_, err := h.requireUserKey(r, "Events can be exported")
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	export, err := h.hostExport(r.Context(), c, e, r.URL.Query().Get("assignments") == "true")
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	if format == ExportFormatJson {
+		writeApiJson(w, http.StatusOK, export)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+e.Id+".csv\"")
+	w.WriteHeader(http.StatusOK)
+	err = WriteRosterCsv(w, export)
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// apiImport enrolls the participants of the CSV roster in the request
+// body. With dryRun=true nobody is enrolled, but the report tells what
+// an import would do.
+func (h *Handlers) apiImport(w http.ResponseWriter, r *http.Request, c *Caller) {
+	err := requireApiUser(c)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, RosterSizeLimit)
+	report, err := h.hostImport(r.Context(), c, e, body, r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusOK, report)
+}
+
+// apiDraw draws the pairs of the event. Everybody is sent their match as
+// when drawing in chat, and the response carries the draw's commitment.
+// Like exports, draws need a key bound to the host drawing.
+func (h *Handlers) apiDraw(w http.ResponseWriter, r *http.Request, c *Caller) {
+	_, err := h.requireUserKey(r, "Pairs can be drawn")
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err == nil {
+		err = checkEventActive(e)
+	}
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	announce := func(e *Event, d *Draw) {
+		_, err := h.poster.Post(r.Context(), e, userMention(e, c.UserId, c.UserName)+" is drawing the pairs of "+eventTitle(e)+". The draw's commitment is `"+d.Commitment+"`, its seed will be revealed on reveal day.", "")
+		if err != nil {
+			h.logger.Println(err)
+		}
+	}
+	e, err = h.draw(r.Context(), c, e, announce)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	_, err = h.poster.Post(r.Context(), e, channelNotice(e, eventTitle(e)+" pairs have been randomized!"), "")
+	if err != nil {
+		h.logger.Println(err)
+	}
+	writeApiJson(w, http.StatusOK, apiEvent(e))
+}
+
+// apiGetAssignment returns the giftees of the user the API key is bound
+// to. Workspace keys could name any user, so they cannot read them.
+func (h *Handlers) apiGetAssignment(w http.ResponseWriter, r *http.Request, c *Caller) {
+	ws, err := h.requireUserKey(r, "Giftees can be read")
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	e, err := h.workspaceEvent(r.Context(), c, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	p, err := h.repo.GetParticipantById(r.Context(), e.Id, c.UserId)
+	if err != nil {
+		h.writeApiFailure(w, notFoundError("You are not taking part in "+eventTitle(e)))
+		return
+	}
+
+	a, err := h.assignment(r.Context(), e, p)
+	if err != nil {
+		h.writeApiFailure(w, err)
+		return
+	}
+
+	h.audit(r.Context(), e, c.UserId, ApiActionReadAssignment, c.UserId, "key "+ws.keyId)
+
+	resp := &ApiAssignment{Event: apiEvent(a.Event), Giftees: []ApiGiftee{}}
+	for _, m := range giftees(a.Participant) {
+		resp.Giftees = append(resp.Giftees, ApiGiftee{
+			Address:  m.Address,
+			Name:     m.Name,
+			UserId:   m.UserId,
+			Wishlist: apiWishlist(a.Wishlists[m.UserId]),
+		})
+	}
+	writeApiJson(w, http.StatusOK, resp)
+}
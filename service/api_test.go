@@ -0,0 +1,189 @@
+// api_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestNewApiKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		key     string
+		want    apiWorkspace
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "not configured", keys: " , ", wantNil: true},
+		{name: "slack by default", keys: "T0123:s3cret", key: "s3cret", want: apiWorkspace{platform: PlatformSlack, teamId: "T0123"}},
+		{name: "platform", keys: "T0123:s3cret, teams/7a9c:0th3r", key: "0th3r", want: apiWorkspace{platform: PlatformTeams, teamId: "7a9c"}},
+		{name: "key with colon", keys: "T0123:a:b", key: "a:b", want: apiWorkspace{platform: PlatformSlack, teamId: "T0123"}},
+		{name: "bound to a user", keys: "T0123:s3cret, teams/7a9c@U0456:m1ne", key: "m1ne", want: apiWorkspace{platform: PlatformTeams, teamId: "7a9c", userId: "U0456"}},
+		{name: "no key", keys: "T0123:", wantErr: true},
+		{name: "no user", keys: "T0123@:s3cret", wantErr: true},
+		{name: "user without team", keys: "@U0456:s3cret", wantErr: true},
+		{name: "no team", keys: ":s3cret", wantErr: true},
+		{name: "unknown platform", keys: "irc/T0123:s3cret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewApiKeys(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewApiKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (k == nil) != (tt.wantNil || tt.wantErr) {
+				t.Fatalf("NewApiKeys() = %v", k)
+			}
+			if k == nil {
+				return
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/events", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+			ws, ok := k.workspace(r)
+			tt.want.keyId = hashApiKey(tt.key)[:8]
+			if !ok || ws != tt.want {
+				t.Errorf("workspace() = %+v, %v, want %+v", ws, ok, tt.want)
+			}
+
+			r.Header.Set("Authorization", "Bearer wrong")
+			if _, ok := k.workspace(r); ok {
+				t.Error("workspace() accepted a wrong key")
+			}
+		})
+	}
+}
+
+func TestApiHandler(t *testing.T) {
+	keys, err := NewApiKeys("T0123:s3cret, T0123@U2:m1ne")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		keys       *ApiKeys
+		auth       string
+		userId     string
+		wantStatus int
+		wantUserId string
+	}{
+		{"api disabled", nil, "Bearer s3cret", "U1", http.StatusNotFound, ""},
+		{"no key", keys, "", "U1", http.StatusUnauthorized, ""},
+		{"wrong key", keys, "Bearer wrong", "U1", http.StatusUnauthorized, ""},
+		{"workspace key", keys, "Bearer s3cret", " U1 ", http.StatusOK, "U1"},
+		{"user key", keys, "Bearer m1ne", "", http.StatusOK, "U2"},
+		{"user key naming its user", keys, "Bearer m1ne", "U2", http.StatusOK, "U2"},
+		{"user key naming another user", keys, "Bearer m1ne", "U1", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handlers{SecretSanta: &SecretSanta{logger: log.New(io.Discard, "", 0)}, apiKeys: tt.keys}
+			var caller *Caller
+			handler := h.apiHandler(func(w http.ResponseWriter, r *http.Request, c *Caller) {
+				caller = c
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/events", nil)
+			r.Header.Set("Authorization", tt.auth)
+			r.Header.Set(apiUserIdHeader, tt.userId)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && (caller.Platform != PlatformSlack || *caller.TeamId != "T0123" || caller.UserId != tt.wantUserId) {
+				t.Errorf("caller = %+v", caller)
+			}
+		})
+	}
+}
+
+func TestWriteApiFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{conflictError("Already enrolled"), http.StatusConflict},
+		{forbiddenError("Not a host"), http.StatusForbidden},
+		{invalidError("Bad date"), http.StatusBadRequest},
+		{ErrEventNotFound, http.StatusNotFound},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	h := &Handlers{SecretSanta: &SecretSanta{logger: log.New(io.Discard, "", 0)}}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.writeApiFailure(w, tt.err)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestApiKeyScopes checks that keys not bound to a user, which may name
+// any user including the owner, can neither read whom somebody gives to
+// nor take the owner's place in drawing or exporting.
+func TestApiKeyScopes(t *testing.T) {
+	keys, err := NewApiKeys("T0123:s3cret, T0123@U1:own3r, T0123@U2:m1ne")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		handler    func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller)
+		key        string
+		wantStatus int
+	}{
+		{"assignment with workspace key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiGetAssignment }, "s3cret", http.StatusForbidden},
+		{"draw with workspace key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiDraw }, "s3cret", http.StatusForbidden},
+		{"draw with another user's key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiDraw }, "m1ne", http.StatusForbidden},
+		{"draw with owner's key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiDraw }, "own3r", http.StatusOK},
+		{"export with workspace key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiExport }, "s3cret", http.StatusForbidden},
+		{"export with another user's key", func(h *Handlers) func(w http.ResponseWriter, r *http.Request, c *Caller) { return h.apiExport }, "m1ne", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepo()
+			repo.events["E1"] = &Event{Id: "E1", OwnerId: "U1", Status: EventStatusOpen, TeamId: String("T0123")}
+			for _, uid := range []string{"U1", "U2", "U3"} {
+				repo.participants["E1"] = append(repo.participants["E1"], Participant{UserId: uid, UserName: uid})
+			}
+			s := newTestSanta(repo)
+			s.poster = posterFunc(func(ctx context.Context, e *Event, msg string, replyTo string) (string, error) { return "", nil })
+			h := &Handlers{SecretSanta: s, apiKeys: keys}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/events/E1", nil)
+			r = mux.SetURLVars(r, map[string]string{"eventId": "E1"})
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+			if tt.key == "s3cret" {
+				r.Header.Set(apiUserIdHeader, "U1")
+			}
+			w := httptest.NewRecorder()
+			h.apiHandler(tt.handler(h))(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if drawn := repo.events["E1"].Draw != nil; drawn != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("pairs drawn = %v", drawn)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// assignments.go
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const breakGlassUsage string = "Usage: /santa breakglass <reason> | /santa breakglass confirm <code> <reason>"
+
+// storeMatches stores the giftees of a santa, sealed if assignment keys
+// are configured.
+func (s *SecretSanta) storeMatches(ctx context.Context, e *Event, santa *Participant, giftees []Participant) error {
+	if s.keys == nil {
+		return s.repo.UpdateParticipantMatches(ctx, e.Id, santa, giftees)
+	}
+
+	var matches []Match
+	var tags []string
+	for _, g := range giftees {
+		matches = append(matches, Match{Address: g.Address, Name: g.UserName, UserId: g.UserId})
+		tags = append(tags, s.keys.santaTag(e.Id, g.UserId))
+	}
+
+	sealed, err := s.keys.sealMatches(e.Id, santa.UserId, matches)
+	if err != nil {
+		return err
+	}
+	return s.repo.SealParticipantMatches(ctx, e.Id, santa.UserId, sealed, tags)
+}
+
+// openMatches fills in the giftees of a participant. It must only be used
+// on behalf of the participant themselves, or when the pairs are meant to
+// come out, e.g. on reveal day.
+func (s *SecretSanta) openMatches(e *Event, p *Participant) {
+	err := s.keys.openMatches(e.Id, p)
+	if err != nil {
+		s.logger.Println("could not open the matches of", p.UserId, "in", e.Id+":", err)
+	}
+}
+
+func (s *SecretSanta) openAllMatches(e *Event, participants []Participant) {
+	for i := range participants {
+		s.openMatches(e, &participants[i])
+	}
+}
+
+func (s *SecretSanta) getSantas(ctx context.Context, e *Event, gifteeId string) ([]Participant, error) {
+	return s.repo.GetSantas(ctx, e.Id, gifteeId, s.keys.santaTag(e.Id, gifteeId))
+}
+
+// pickGiftee finds which of their giftees a santa means. A mention of one
+// of them in front of the arguments picks them; a santa with only one
+// giftee need not mention them. It returns the arguments left over.
+func pickGiftee(e *Event, p *Participant, args []string) (*Match, []string, error) {
+	matches := giftees(p)
+	if len(args) > 0 {
+		if uid, err := parseUserMention(args[0]); err == nil {
+			for i := range matches {
+				if matches[i].UserId == uid {
+					return &matches[i], args[1:], nil
+				}
+			}
+			if len(matches) > 1 {
+				return nil, nil, errors.New("<@" + uid + "> is not one of your giftees in " + eventTitle(e))
+			}
+		}
+	}
+	if len(matches) == 1 {
+		return &matches[0], args, nil
+	}
+
+	var mentions []string
+	for _, m := range matches {
+		mentions = append(mentions, "<@"+m.UserId+">")
+	}
+	return nil, nil, errors.New("You give gifts to " + strings.Join(mentions, ", ") + " in " + eventTitle(e) + ". Please mention which of them you mean first, e.g. @jane")
+}
+
+// pickSanta finds which of their santas a giftee means by the thread ID
+// they were given in front of the arguments, which does not give away who
+// the santa is. A giftee with only one santa need not give it. It returns
+// the arguments left over.
+func (s *SecretSanta) pickSanta(e *Event, santas []Participant, gifteeId string, args []string) (*Participant, []string, error) {
+	if len(args) > 0 {
+		for i := range santas {
+			if strings.EqualFold(args[0], s.threadId(e.Id, santas[i].UserId, gifteeId)) {
+				return &santas[i], args[1:], nil
+			}
+		}
+	}
+	if len(santas) == 1 {
+		return &santas[0], args, nil
+	}
+	return nil, nil, errors.New("You have " + strconv.Itoa(len(santas)) + " Secret Santas in " + eventTitle(e) + ". Please start with the thread ID from the message of the one you mean, e.g. T1A2B3C")
+}
+
+// drawSeed returns the seed of the draw of the event, opening it if it has
+// been sealed until reveal day.
+func (s *SecretSanta) drawSeed(e *Event) (string, error) {
+	d := e.Draw
+	if d.Seed != "" || d.SealedSeed == "" || s.keys == nil {
+		return d.Seed, nil
+	}
+	return s.keys.openSeed(e.Id, d.SealedSeed)
+}
+
+// breakGlassCommand is the one way to see the pairs before reveal day,
+// e.g. when a gift has gone missing. Only the owner may use it, it needs
+// a reason, and both the audit log and the channel record that it was
+// used.
+func (h *Handlers) breakGlassCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionBreakGlass)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	confirming := len(args) > 0 && strings.ToLower(args[0]) == "confirm"
+	var confirmation, rest []string
+	if confirming {
+		if len(args) < 2 {
+			writeSlackMessage(w, ResponseTypeEphemeral, breakGlassUsage)
+			return
+		}
+		confirmation, rest = args[:2], args[2:]
+	} else {
+		rest = args
+	}
+	reason := strings.Join(rest, " ")
+	if reason == "" {
+		writeSlackMessage(w, ResponseTypeEphemeral, breakGlassUsage)
+		return
+	}
+
+	code, err := h.confirmAction(r.Context(), e, req.UserId, HostActionBreakGlass, confirmation)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if code != "" {
+		writeSlackMessage(w, ResponseTypeEphemeral, "This shows you all pairs of "+eventTitle(e)+" and tells the channel that you looked. To go ahead, type `/santa breakglass confirm "+code+" "+reason+"` within 5 minutes.")
+		return
+	}
+
+	participants, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	h.openAllMatches(e, participants)
+
+	h.audit(r.Context(), e, req.UserId, HostActionBreakGlass, "", reason)
+
+	err = SendSlackMessage(req.ResponseUrl, ResponseTypeInChannel, "<@"+req.UserId+"> looked at the pairs of "+eventTitle(e)+" before reveal day: "+reason)
+	if err != nil {
+		h.logger.Println(err)
+	}
+
+	var lines []string
+	for i := range participants {
+		var mentions []string
+		for _, m := range giftees(&participants[i]) {
+			mentions = append(mentions, "<@"+m.UserId+">")
+		}
+		if len(mentions) > 0 {
+			lines = append(lines, "<@"+participants[i].UserId+"> → "+strings.Join(mentions, ", "))
+		}
+	}
+	sort.Strings(lines)
+
+	writeSlackMessage(w, ResponseTypeEphemeral, eventTitle(e)+" pairs:\n"+strings.Join(lines, "\n"))
+}
@@ -0,0 +1,25 @@
+// audit.go
+package service
+
+import (
+	"context"
+	"time"
+)
+
+const auditPageSize int64 = 50
+
+// audit records what a host did to an event. Failing to record it is
+// logged but does not undo the action.
+func (s *SecretSanta) audit(ctx context.Context, e *Event, actorId string, action string, targetId string, details string) {
+	err := s.repo.AddAuditEntry(ctx, &AuditEntry{
+		Action:   action,
+		ActorId:  actorId,
+		At:       time.Now(),
+		Details:  details,
+		EventId:  e.Id,
+		TargetId: targetId,
+	})
+	if err != nil {
+		s.logger.Println(err)
+	}
+}
@@ -0,0 +1,326 @@
+// commands.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const dateLayout string = "2006-01-02"
+
+// SantaHandler serves the /santa command, which groups everything beyond
+// the four basic commands as subcommands, e.g. "/santa reminders".
+func (h *Handlers) SantaHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
+		return
+	}
+
+	req := newSlackRequest(r)
+
+	// Every subcommand may pick one of several events with event="<name>".
+	text, opts := parseOptions(*req.Text, []string{eventOptionKey})
+	eventName := opts[eventOptionKey]
+
+	sub, args := splitCommand(text)
+	switch sub {
+	case "reminders":
+		h.remindersCommand(w, r, req, eventName, args)
+	case "settings":
+		h.settingsCommand(w, r, req, eventName, args)
+	case "hosts":
+		h.hostsCommand(w, r, req, eventName, args)
+	case "cohost":
+		h.cohostCommand(w, r, req, eventName, args)
+	case "transfer":
+		h.transferCommand(w, r, req, eventName, args)
+	case "audit":
+		h.auditCommand(w, r, req, eventName, args)
+	case "breakglass":
+		h.breakGlassCommand(w, r, req, eventName, args)
+	case "cancel":
+		h.cancelCommand(w, r, req, eventName, args)
+	case "reset":
+		h.resetCommand(w, r, req, eventName, args)
+	case "verify":
+		h.verifyCommand(w, r, req, eventName, args)
+	case "email":
+		h.emailCommand(w, r, req, eventName, args)
+	case "wishlist":
+		h.wishlistCommand(w, r, req, eventName, args)
+	case "ask":
+		h.askCommand(w, r, req, eventName, args)
+	case "reply":
+		h.replyCommand(w, r, req, eventName, args)
+	case "gift":
+		h.giftCommand(w, r, req, eventName, args)
+	case "regions":
+		h.regionsCommand(w, r, req, eventName, args)
+	case "reveal":
+		h.revealCommand(w, r, req, eventName, args)
+	case "exclude":
+		h.excludeCommand(w, r, req, eventName, args)
+	case "invite":
+		h.inviteCommand(w, r, req, eventName, args)
+	case "status":
+		h.statusCommand(w, r, req, eventName, args)
+	case "messages":
+		h.messagesCommand(w, r, req, eventName, args)
+	case "hide":
+		h.hideCommand(w, r, req, eventName, args)
+	case "my-data":
+		h.myDataCommand(w, r, req, eventName, args)
+	case "forget-me":
+		h.forgetMeCommand(w, r, req, eventName, args)
+	default:
+		writeSlackMessage(w, ResponseTypeEphemeral, "Usage: /santa wishlist|email|ask|reply|gift|reminders|settings|hosts|cohost|transfer|audit|exclude|invite|status|regions|reveal|cancel|reset|breakglass|messages|hide|verify|my-data|forget-me")
+	}
+}
+
+func isOrganizerKeyword(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == "organize" || s == "organise"
+}
+
+func splitCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(fields[0]), fields[1:]
+}
+
+const eventOptionKey string = "event"
+
+func defaultEventName(y int) string {
+	return "Secret Santa " + strconv.Itoa(y)
+}
+
+func newEvent(c *Caller, name string, y int) *Event {
+	return &Event{
+		Id:           primitive.NewObjectID().Hex(),
+		ChannelId:    c.ChannelId,
+		EnterpriseId: c.EnterpriseId,
+		Name:         name,
+		OwnerId:      c.UserId,
+		Platform:     c.Platform,
+		ServiceUrl:   c.ServiceUrl,
+		Status:       EventStatusOpen,
+		TeamId:       c.TeamId,
+		Year:         y,
+		Reminders: Reminders{
+			EnrollmentDaysBefore: 1,
+		},
+	}
+}
+
+// eventTitle names the event in messages. Events created before they could
+// be named are called after their year.
+func eventTitle(e *Event) string {
+	if e.Name == "" {
+		return defaultEventName(e.Year)
+	}
+	return e.Name
+}
+
+func isActiveEvent(e *Event) bool {
+	return e.Status == "" || e.Status == EventStatusOpen || e.Status == EventStatusMatched
+}
+
+// channelEvents returns the events of the channel, newest first. Events
+// initialized before events were stored on their own only have a yearly
+// participants collection, so an event is created for the current year's
+// collection on first use.
+func (s *SecretSanta) channelEvents(ctx context.Context, c *Caller) ([]Event, error) {
+	events, err := s.repo.FindEvents(ctx, c.ChannelId, c.EnterpriseId, c.TeamId)
+	if err != nil {
+		return nil, err
+	}
+
+	y := time.Now().Year()
+	legacyId := collectionName(c.ChannelId, c.EnterpriseId, c.TeamId, y)
+	legacyFound := false
+	for i := range events {
+		err = s.backfillOwner(ctx, &events[i])
+		if err != nil {
+			return nil, err
+		}
+		legacyFound = legacyFound || events[i].Id == legacyId
+	}
+	if legacyFound {
+		return events, nil
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, legacyId)
+	if err != nil {
+		return nil, err
+	}
+	if len(participants) < 1 {
+		return events, nil
+	}
+
+	e := Event{
+		Id:           legacyId,
+		ChannelId:    c.ChannelId,
+		EnterpriseId: c.EnterpriseId,
+		Status:       EventStatusOpen,
+		TeamId:       c.TeamId,
+		Year:         y,
+		Reminders: Reminders{
+			EnrollmentDaysBefore: 1,
+		},
+	}
+	err = s.backfillOwner(ctx, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Event{e}, events...), nil
+}
+
+// backfillOwner sets the owner of events stored before events had one: the
+// participant who initialized them.
+func (s *SecretSanta) backfillOwner(ctx context.Context, e *Event) error {
+	if e.OwnerId != "" {
+		return nil
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return err
+	}
+	for _, participant := range participants {
+		if participant.IsHost {
+			e.OwnerId = participant.UserId
+		}
+	}
+
+	return s.repo.SaveEvent(ctx, e)
+}
+
+// findEvent returns the active event of the channel with the given name,
+// or, if no name is given, the only active event of the channel.
+func (s *SecretSanta) findEvent(ctx context.Context, c *Caller, name string) (*Event, error) {
+	events, err := s.channelEvents(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var active []Event
+	for _, e := range events {
+		if isActiveEvent(&e) {
+			active = append(active, e)
+		}
+	}
+
+	if name != "" {
+		for i := range active {
+			if strings.EqualFold(eventTitle(&active[i]), name) {
+				return &active[i], nil
+			}
+		}
+		return nil, notFoundError("There is no open Secret Santa event named \"" + name + "\" in this channel")
+	}
+
+	switch len(active) {
+	case 0:
+		return nil, notFoundError("Secret Santa has not been initialized yet")
+	case 1:
+		return &active[0], nil
+	default:
+		return nil, invalidError("There are several Secret Santa events in this channel: " + eventNames(active) + ". Please pick one by adding event=\"<name>\" to the command")
+	}
+}
+
+// findUserEvent returns the event of the channel the user takes part in,
+// together with their participant record. Without a name, only events of
+// the given year are considered.
+func (s *SecretSanta) findUserEvent(ctx context.Context, c *Caller, name string, y int) (*Event, *Participant, error) {
+	events, err := s.channelEvents(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Events of past years may predate the events collection.
+	legacyId := collectionName(c.ChannelId, c.EnterpriseId, c.TeamId, y)
+	legacyFound := false
+	for i := range events {
+		legacyFound = legacyFound || events[i].Id == legacyId
+	}
+	if !legacyFound {
+		events = append(events, Event{
+			Id:           legacyId,
+			ChannelId:    c.ChannelId,
+			EnterpriseId: c.EnterpriseId,
+			TeamId:       c.TeamId,
+			Year:         y,
+		})
+	}
+
+	var found []Event
+	var participants []*Participant
+	var organized *Event
+	for i := range events {
+		e := &events[i]
+		if e.Status == EventStatusCancelled {
+			continue
+		}
+		if name != "" && !strings.EqualFold(eventTitle(e), name) {
+			continue
+		}
+		if name == "" && e.Year != y {
+			continue
+		}
+
+		p, err := s.repo.GetParticipantById(ctx, e.Id, c.UserId)
+		if err != nil {
+			if authorizeHost(e, c.UserId, HostActionRandomize) == nil {
+				organized = e
+			}
+			continue
+		}
+		found = append(found, *e)
+		participants = append(participants, p)
+	}
+
+	switch len(found) {
+	case 0:
+		if organized != nil {
+			return nil, nil, notFoundError("You are organizing " + eventTitle(organized) + " without taking part in the exchange, so you have no match")
+		}
+		if name != "" {
+			return nil, nil, notFoundError("You are not taking part in " + name + " in this channel")
+		}
+		return nil, nil, notFoundError("You are not taking part in Secret Santa " + strconv.Itoa(y) + " in this channel")
+	case 1:
+		return &found[0], participants[0], nil
+	default:
+		return nil, nil, invalidError("You take part in several Secret Santa events in this channel: " + eventNames(found) + ". Please pick one by adding event=\"<name>\" to the command")
+	}
+}
+
+func eventNames(events []Event) string {
+	var names []string
+	for i := range events {
+		names = append(names, "\""+eventTitle(&events[i])+"\"")
+	}
+	return strings.Join(names, ", ")
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return t, errors.New("Please provide a date as YYYY-MM-DD")
+	}
+	return t, nil
+}
@@ -0,0 +1,78 @@
+// commands_test.go
+package service
+
+import "testing"
+
+func TestIsOrganizerKeyword(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"organize", true},
+		{" Organise ", true},
+		{"ORGANIZE", true},
+		{"organizer", false},
+		{"1 Organize St", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := isOrganizerKeyword(tt.text); got != tt.want {
+				t.Errorf("isOrganizerKeyword(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventNames(t *testing.T) {
+	events := []Event{
+		{Year: 2025},
+		{Name: "Office party", Year: 2026},
+	}
+
+	if got, want := eventNames(events), `"Secret Santa 2025", "Office party"`; got != want {
+		t.Errorf("eventNames() = %s, want %s", got, want)
+	}
+}
+
+func TestIsActiveEvent(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{"", true},
+		{EventStatusOpen, true},
+		{EventStatusMatched, true},
+		{"archived", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := isActiveEvent(&Event{Status: tt.status}); got != tt.want {
+				t.Errorf("isActiveEvent(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs int
+	}{
+		{"", "", 0},
+		{"  Settings  budget=25 ", "settings", 1},
+		{"cohost add <@U1>", "cohost", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, args := splitCommand(tt.text)
+			if name != tt.wantName || len(args) != tt.wantArgs {
+				t.Errorf("splitCommand(%q) = %q, %v", tt.text, name, args)
+			}
+		})
+	}
+}
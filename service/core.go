@@ -0,0 +1,403 @@
+// core.go
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	PlatformDiscord    string = "discord"
+	PlatformMattermost string = "mattermost"
+	PlatformSlack      string = "slack"
+	PlatformTeams      string = "teams"
+)
+
+// eventPlatform returns the chat platform the event is run on. Events
+// created before there was a choice are run on Slack.
+func eventPlatform(e *Event) string {
+	if e == nil || e.Platform == "" {
+		return PlatformSlack
+	}
+	return e.Platform
+}
+
+// SecretSanta runs Secret Santa events whatever chat platform they are run
+// on: the platforms translate their commands to calls of its methods, and
+// tell their users about the outcome in their own way. Breaking the rules,
+// e.g. by enrolling twice, returns a DomainError.
+type SecretSanta struct {
+	logger    *log.Logger
+	repo      SecretSantaRepository
+	keys      *AssignmentKeys
+	threadKey []byte
+	notifier  Notifier
+	poster    ChannelPoster
+}
+
+// NewSecretSanta returns the service. Without assignment keys, a thread
+// key is needed, see threadId.
+func NewSecretSanta(l *log.Logger, r SecretSantaRepository, keys *AssignmentKeys, threadKey []byte, notifier Notifier, poster ChannelPoster) (*SecretSanta, error) {
+	if keys == nil && threadKey == nil {
+		return nil, errors.New("a thread key is needed without an assignment master key, so that message threads cannot be traced back to their pairs")
+	}
+	return &SecretSanta{
+		logger:    l,
+		repo:      r,
+		keys:      keys,
+		threadKey: threadKey,
+		notifier:  notifier,
+		poster:    poster,
+	}, nil
+}
+
+// Assignment is what a santa needs to know about their giftees.
+type Assignment struct {
+	Event       *Event
+	Participant *Participant
+	Wishlists   map[string]*Wishlist
+}
+
+// CreateEvent creates an event in the channel of the caller, with the
+// caller as its owner. The text is the owner's postal address, or
+// "organize", followed by the event's settings and name if any. The
+// returned flag tells whether the owner only organizes the event.
+func (s *SecretSanta) CreateEvent(ctx context.Context, c *Caller, text string) (*Event, bool, error) {
+	// Event settings may follow the address, e.g. "... budget=25 currency=EUR",
+	// as may the name of the event, e.g. event="Lunar New Year".
+	address, opts := parseOptions(text, append([]string{eventOptionKey}, settingKeys...))
+
+	// "/initialize organize" sets up an event the host runs without taking
+	// part in the exchange, so no address is needed.
+	organizerOnly := isOrganizerKeyword(address)
+
+	name := opts[eventOptionKey]
+	delete(opts, eventOptionKey)
+
+	e, err := s.createEvent(ctx, c, name, address, organizerOnly, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return e, organizerOnly, nil
+}
+
+// createEvent creates an event with the given name and settings, which
+// is named after the current year if no name is given.
+func (s *SecretSanta) createEvent(ctx context.Context, c *Caller, name string, address string, organizerOnly bool, settings map[string]string) (*Event, error) {
+	if !organizerOnly && len(address) < 5 {
+		return nil, invalidError("Please provide a valid postal address by typing it after the command")
+	}
+
+	y := time.Now().Year()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultEventName(y)
+	}
+
+	e := newEvent(c, name, y)
+	err := applySettings(e, settings)
+	if err != nil {
+		return nil, invalidError(err.Error())
+	}
+
+	// Several events may run in a channel at once, as long as their names differ.
+	if _, err := s.findEvent(ctx, c, name); err == nil {
+		return nil, conflictError(name + " has already been initialized for this channel")
+	}
+
+	// The check above races with commands running at the same time, the
+	// unique name index of the events does not.
+	err = s.repo.SaveEvent(ctx, e)
+	if err == ErrDuplicateEvent {
+		return nil, conflictError(name + " has already been initialized for this channel")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !organizerOnly {
+		p := &Participant{Address: String(address),
+			ChannelId:    c.ChannelId,
+			EnterpriseId: c.EnterpriseId,
+			IsHost:       true,
+			ResponseUrl:  c.ResponseUrl,
+			TeamId:       c.TeamId,
+			UserId:       c.UserId,
+			UserName:     c.UserName,
+		}
+		err = s.repo.RegisterParticipant(ctx, e.Id, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Settings given on creation may already call for reminders, e.g. an
+	// exchange date on which the pairs are revealed.
+	err = s.scheduleReminders(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Enroll registers the caller in the event of their channel and confirms
+// it to them. The text is their postal address, followed by their email
+// address and the event's name if any.
+func (s *SecretSanta) Enroll(ctx context.Context, c *Caller, text string) (*Event, *Participant, error) {
+	address, opts := parseOptions(text, []string{emailOptionKey, eventOptionKey})
+
+	email, err := parseEmail(opts[emailOptionKey])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The event exists even if its organizer is not taking part, so there
+	// may be no participants yet.
+	e, err := s.findEvent(ctx, c, opts[eventOptionKey])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := s.enroll(ctx, c, e, address, email)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, p, nil
+}
+
+// enroll registers the caller in the event while enrollment is open.
+func (s *SecretSanta) enroll(ctx context.Context, c *Caller, e *Event, address string, email *string) (*Participant, error) {
+	if len(address) < 5 {
+		return nil, invalidError("Please provide a valid postal address by typing it after the command")
+	}
+
+	err := checkEnrollmentOpen(e, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Participant{Address: String(address),
+		ChannelId:    c.ChannelId,
+		Email:        email,
+		EnterpriseId: c.EnterpriseId,
+		ResponseUrl:  c.ResponseUrl,
+		TeamId:       c.TeamId,
+		UserId:       c.UserId,
+		UserName:     c.UserName,
+	}
+	err = s.repo.RegisterParticipant(ctx, e.Id, p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.notifier.Notify(ctx, enrollmentNotice(e, p))
+	if err != nil {
+		s.logger.Println(err)
+	}
+	return p, nil
+}
+
+// Draw matches the participants of the event of the caller's channel and
+// tells each of them who their giftees are. Only hosts may draw. The text
+// may pick the event by name. announce is called with the draw once the
+// pairs are stored, to publish its commitment.
+func (s *SecretSanta) Draw(ctx context.Context, c *Caller, text string, announce func(e *Event, d *Draw)) (*Event, error) {
+	_, opts := parseOptions(text, []string{eventOptionKey})
+
+	e, err := s.findEvent(ctx, c, opts[eventOptionKey])
+	if err != nil {
+		return nil, err
+	}
+	return s.draw(ctx, c, e, announce)
+}
+
+// draw matches the participants of the event on behalf of the caller.
+func (s *SecretSanta) draw(ctx context.Context, c *Caller, e *Event, announce func(e *Event, d *Draw)) (*Event, error) {
+	err := authorizeHost(e, c.UserId, HostActionRandomize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep a concurrent /randomize or reset from interfering with the matching.
+	e, err = s.lockEvent(ctx, e.Id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlockEvent(ctx, e.Id, nil)
+
+	pCount, err := s.repo.CountAllParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if pCount < 2 {
+		return nil, conflictError(eventTitle(e) + " needs at least two participants before pairs can be randomized")
+	}
+
+	mCount, err := s.repo.CountMatchedParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if mCount > 0 && mCount == pCount {
+		return nil, conflictError(eventTitle(e) + " pairs for this channel have already been matched")
+	}
+
+	poolA, err := s.repo.GetUnmatchedParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(poolA) < 2 {
+		return nil, conflictError(eventTitle(e) + " needs at least two unmatched participants before pairs can be randomized")
+	}
+
+	// The draw is fixed by a random seed whose hash is published with the
+	// draw and the seed itself on reveal day, so that anybody can check the
+	// draw and a host cannot quietly draw again.
+	d, err := newDraw(e, poolA)
+	if err != nil {
+		return nil, err
+	}
+
+	// Draw before anything is stored, so that a draw the exclusions rule
+	// out leaves the event as it was.
+	matches, err := runDraw(d, poolA)
+	if err != nil {
+		return nil, err
+	}
+
+	// The seed is all it takes to work out the pairs, so it is sealed
+	// until reveal day like the pairs themselves.
+	stored := *d
+	if s.keys != nil {
+		stored.SealedSeed, err = s.keys.sealSeed(e.Id, d.Seed)
+		if err != nil {
+			return nil, err
+		}
+		stored.Seed = ""
+	}
+
+	byId := make(map[string]Participant)
+	for _, p := range poolA {
+		byId[p.UserId] = p
+	}
+
+	for _, uid := range d.ParticipantIds {
+		var giftees []Participant
+		for _, gifteeId := range matches[uid] {
+			giftees = append(giftees, byId[gifteeId])
+		}
+		santa := byId[uid]
+		err := s.storeMatches(ctx, e, &santa, giftees)
+		if err != nil {
+			s.undoMatches(ctx, e, d.ParticipantIds)
+			return nil, err
+		}
+	}
+
+	// The draw is only recorded, and its commitment announced, once all
+	// of its matches are stored.
+	matched, err := s.updateEvent(ctx, e.Id, func(e *Event) error {
+		e.Draw = &stored
+		e.Status = EventStatusMatched
+		return nil
+	})
+	if err != nil {
+		s.undoMatches(ctx, e, d.ParticipantIds)
+		return nil, err
+	}
+	e = matched
+
+	s.audit(ctx, e, c.UserId, HostActionRandomize, "", "commitment "+d.Commitment)
+	announce(e, d)
+
+	matchedParticipants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+	s.openAllMatches(e, matchedParticipants)
+
+	wishlists := make(map[string]*Wishlist)
+	for _, participant := range matchedParticipants {
+		wishlists[participant.UserId] = participant.Wishlist
+	}
+
+	for _, participant := range matchedParticipants {
+		s.notifyMatch(ctx, e, &participant, wishlists)
+	}
+
+	return e, nil
+}
+
+// undoMatches throws away the matches of a draw that could not be
+// recorded, so that its participants can be drawn again.
+func (s *SecretSanta) undoMatches(ctx context.Context, e *Event, uids []string) {
+	err := s.repo.ResetMatches(ctx, e.Id, uids)
+	if err != nil {
+		s.logger.Println("could not undo the matches of", e.Id+":", err)
+	}
+}
+
+// notifyMatch tells a santa who their giftees are and records whether it
+// reached them, so hosts can see on /santa status whether everybody got
+// their match.
+func (s *SecretSanta) notifyMatch(ctx context.Context, e *Event, p *Participant, wishlists map[string]*Wishlist) error {
+	n := &Notification{At: time.Now(), Delivered: true}
+	notifyErr := s.notifier.Notify(ctx, matchNotice(e, p, wishlists))
+	if notifyErr != nil {
+		s.logger.Println(notifyErr)
+		// The channels that failed are kept even when another one
+		// reached the santa.
+		n.Delivered = partiallyDelivered(notifyErr)
+		n.Error = notifyErr.Error()
+	}
+	err := s.repo.UpdateNotification(ctx, e.Id, p.UserId, n)
+	if err != nil {
+		s.logger.Println(err)
+	}
+	if n.Delivered {
+		return nil
+	}
+	return notifyErr
+}
+
+// GetAssignment returns the giftees of the caller in the event of their
+// channel. The text may pick the event by year or name.
+func (s *SecretSanta) GetAssignment(ctx context.Context, c *Caller, text string) (*Assignment, error) {
+	text, opts := parseOptions(text, []string{eventOptionKey})
+
+	y := time.Now().Year()
+	if len(text) >= 4 {
+		t, err := time.Parse("2006", text)
+		if err == nil {
+			y = t.Year()
+		}
+	}
+
+	e, p, err := s.findUserEvent(ctx, c, opts[eventOptionKey], y)
+	if err != nil {
+		return nil, err
+	}
+	return s.assignment(ctx, e, p)
+}
+
+// assignment returns the giftees of the participant in the event.
+func (s *SecretSanta) assignment(ctx context.Context, e *Event, p *Participant) (*Assignment, error) {
+	s.openMatches(e, p)
+	if !p.IsMatched || p.YourMatchId == nil {
+		return nil, conflictError(eventTitle(e) + " pairs have not been matched yet for this channel")
+	}
+
+	wishlists := make(map[string]*Wishlist)
+	for _, m := range giftees(p) {
+		if match, err := s.repo.GetParticipantById(ctx, e.Id, m.UserId); err == nil {
+			wishlists[m.UserId] = match.Wishlist
+		}
+	}
+	return &Assignment{Event: e, Participant: p, Wishlists: wishlists}, nil
+}
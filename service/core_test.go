@@ -0,0 +1,294 @@
+// core_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memoryRepo keeps events, participants and jobs in memory. Methods it does
+// not implement panic through the nil SecretSantaRepository it embeds.
+type memoryRepo struct {
+	SecretSantaRepository
+	audit        []AuditEntry
+	events       map[string]*Event
+	jobs         map[string]*Job
+	participants map[string][]Participant
+
+	// failMatches fails storing the matches of the given santa.
+	failMatches string
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{
+		events:       make(map[string]*Event),
+		jobs:         make(map[string]*Job),
+		participants: make(map[string][]Participant),
+	}
+}
+
+func (r *memoryRepo) FindEvents(ctx context.Context, chid *string, eid *string, tid *string) ([]Event, error) {
+	var events []Event
+	for _, e := range r.events {
+		if value(e.ChannelId) == value(chid) && value(e.TeamId) == value(tid) {
+			events = append(events, *e)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryRepo) GetAllParticipants(ctx context.Context, eventId string) ([]Participant, error) {
+	return append([]Participant(nil), r.participants[eventId]...), nil
+}
+
+func (r *memoryRepo) GetEvent(ctx context.Context, id string) (*Event, error) {
+	e, ok := r.events[id]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+	loaded := *e
+	return &loaded, nil
+}
+
+func (r *memoryRepo) SaveEvent(ctx context.Context, e *Event) error {
+	saved := *e
+	r.events[e.Id] = &saved
+	return nil
+}
+
+func (r *memoryRepo) RegisterParticipant(ctx context.Context, eventId string, p *Participant) error {
+	r.participants[eventId] = append(r.participants[eventId], *p)
+	return nil
+}
+
+func (r *memoryRepo) CountAllParticipants(ctx context.Context, eventId string) (int64, error) {
+	return int64(len(r.participants[eventId])), nil
+}
+
+func (r *memoryRepo) CountMatchedParticipants(ctx context.Context, eventId string) (int64, error) {
+	n := int64(0)
+	for _, p := range r.participants[eventId] {
+		if p.IsMatched {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memoryRepo) GetUnmatchedParticipants(ctx context.Context, eventId string) ([]Participant, error) {
+	var participants []Participant
+	for _, p := range r.participants[eventId] {
+		if !p.IsMatched {
+			participants = append(participants, p)
+		}
+	}
+	return participants, nil
+}
+
+func (r *memoryRepo) participant(eventId string, uid string) *Participant {
+	for i := range r.participants[eventId] {
+		if r.participants[eventId][i].UserId == uid {
+			return &r.participants[eventId][i]
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) UpdateParticipantMatches(ctx context.Context, eventId string, p *Participant, matches []Participant) error {
+	if p.UserId == r.failMatches {
+		return errors.New("connection reset")
+	}
+	stored := r.participant(eventId, p.UserId)
+	stored.IsMatched = true
+	stored.YourMatches = nil
+	for _, m := range matches {
+		stored.YourMatches = append(stored.YourMatches, Match{Address: m.Address, Name: m.UserName, UserId: m.UserId})
+	}
+	return nil
+}
+
+func (r *memoryRepo) ResetMatches(ctx context.Context, eventId string, uids []string) error {
+	for i := range r.participants[eventId] {
+		p := &r.participants[eventId][i]
+		if uids == nil || containsUser(uids, p.UserId) {
+			p.IsMatched = false
+			p.YourMatches = nil
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) UpdateNotification(ctx context.Context, eventId string, uid string, n *Notification) error {
+	r.participant(eventId, uid).Notification = n
+	return nil
+}
+
+func (r *memoryRepo) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	r.audit = append(r.audit, *entry)
+	return nil
+}
+
+func (r *memoryRepo) CancelPendingJobs(ctx context.Context, eventId string, kind string) error {
+	for id, job := range r.jobs {
+		if job.EventId == eventId && job.Kind == kind && job.Status == JobStatusPending {
+			delete(r.jobs, id)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) ScheduleJob(ctx context.Context, job *Job) error {
+	scheduled := *job
+	scheduled.Status = JobStatusPending
+	r.jobs[job.Id] = &scheduled
+	return nil
+}
+
+func newTestSanta(repo SecretSantaRepository) *SecretSanta {
+	notifier := notifierFunc(func(ctx context.Context, n *Notice) error { return nil })
+	return &SecretSanta{logger: log.New(io.Discard, "", 0), notifier: notifier, repo: repo}
+}
+
+func TestCreateEventSchedulesReminders(t *testing.T) {
+	next := strconv.Itoa(time.Now().Year() + 1)
+	tests := []struct {
+		name     string
+		settings map[string]string
+		want     map[string]string
+	}{
+		{"no settings", nil, map[string]string{}},
+		{
+			"exchange date",
+			map[string]string{"exchange": next + "-12-20"},
+			map[string]string{JobKindRevealReminder: next + "-12-20T09:00:00Z"},
+		},
+		{"exchange date passed", map[string]string{"exchange": "2020-12-20"}, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepo()
+			s := newTestSanta(repo)
+			c := &Caller{ChannelId: String("C1"), Platform: PlatformSlack, TeamId: String("T1"), UserId: "U1", UserName: "ann"}
+
+			e, err := s.createEvent(context.Background(), c, "", "1 Main Street", false, tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			for _, job := range repo.jobs {
+				if job.EventId != e.Id || job.Status != JobStatusPending {
+					t.Errorf("job %+v is not a pending job of the event", job)
+				}
+				got[job.Kind] = job.RunAt.Format(time.RFC3339)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("jobs = %v, want %v", got, tt.want)
+			}
+			for kind, runAt := range tt.want {
+				if got[kind] != runAt {
+					t.Errorf("%s job runs at %q, want %q", kind, got[kind], runAt)
+				}
+			}
+		})
+	}
+}
+
+func TestDraw(t *testing.T) {
+	tests := []struct {
+		name        string
+		failMatches string
+		wantErr     bool
+	}{
+		{"stores matches before the draw", "", false},
+		{"undoes matches it could not finish", "U3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepo()
+			repo.failMatches = tt.failMatches
+			repo.events["E1"] = &Event{Id: "E1", OwnerId: "U1", Status: EventStatusOpen}
+			for _, uid := range []string{"U1", "U2", "U3", "U4"} {
+				repo.participants["E1"] = append(repo.participants["E1"], Participant{UserId: uid, UserName: uid})
+			}
+			s := newTestSanta(repo)
+
+			announced := false
+			announce := func(e *Event, d *Draw) {
+				announced = true
+				if e.Draw == nil || e.Status != EventStatusMatched {
+					t.Errorf("announced %+v before the draw was recorded", e)
+				}
+				if n, _ := repo.CountMatchedParticipants(context.Background(), "E1"); n != 4 {
+					t.Errorf("announced with %d of 4 participants matched", n)
+				}
+			}
+
+			_, err := s.draw(context.Background(), &Caller{UserId: "U1"}, repo.events["E1"], announce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("draw() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			e := repo.events["E1"]
+			matched, _ := repo.CountMatchedParticipants(context.Background(), "E1")
+			if tt.wantErr {
+				if announced || len(repo.audit) > 0 {
+					t.Error("a failed draw was announced or audited")
+				}
+				if e.Draw != nil || e.Status != EventStatusOpen || matched != 0 {
+					t.Errorf("a failed draw left status %s, draw %v and %d matches", e.Status, e.Draw, matched)
+				}
+				return
+			}
+			if !announced || len(repo.audit) != 1 || repo.audit[0].Action != HostActionRandomize {
+				t.Errorf("draw was announced %v with audit log %+v", announced, repo.audit)
+			}
+			if e.Draw == nil || e.Status != EventStatusMatched || matched != 4 {
+				t.Errorf("draw left status %s, draw %v and %d matches", e.Status, e.Draw, matched)
+			}
+		})
+	}
+}
+
+func TestNotifyMatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantDelivered bool
+		wantErr       bool
+	}{
+		{"delivered", nil, true, false},
+		{"partially delivered", &DeliveryError{Failures: []string{"email: timeout"}, Partial: true}, true, false},
+		{"not reached", errNotReached, false, true},
+		{"failed", &DeliveryError{Failures: []string{"Slack: channel_not_found"}}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepo()
+			repo.participants["E1"] = []Participant{{UserId: "U1"}}
+			s := newTestSanta(repo)
+			s.notifier = notifierFunc(func(ctx context.Context, n *Notice) error { return tt.err })
+
+			p := repo.participants["E1"][0]
+			err := s.notifyMatch(context.Background(), &Event{Id: "E1"}, &p, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("notifyMatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			n := repo.participant("E1", "U1").Notification
+			if n == nil || n.Delivered != tt.wantDelivered {
+				t.Fatalf("notification = %+v, want delivered %v", n, tt.wantDelivered)
+			}
+			if (n.Error != "") != (tt.err != nil) {
+				t.Errorf("notification error = %q, want %v", n.Error, tt.err)
+			}
+		})
+	}
+}
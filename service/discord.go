@@ -0,0 +1,331 @@
+// discord.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+const discordApiUrl string = "https://discord.com/api/v10"
+
+const (
+	discordInteractionPing    int = 1
+	discordInteractionCommand int = 2
+)
+
+const (
+	discordResponsePong     int = 1
+	discordResponseMessage  int = 4
+	discordResponseDeferred int = 5
+)
+
+// discordFlagEphemeral makes a response visible to the user of the command
+// only, like Slack's ephemeral messages.
+const discordFlagEphemeral int = 64
+
+const discordOptionString int = 3
+
+// DiscordClient talks to Discord: it checks that interactions come from
+// Discord, and sends messages on behalf of the bot.
+type DiscordClient struct {
+	appId     string
+	botToken  string
+	publicKey ed25519.PublicKey
+}
+
+// NewDiscordClient returns a client for the Discord application with the
+// given ID and hex encoded public key, or nil if no public key is
+// configured.
+func NewDiscordClient(appId string, publicKey string, botToken string) (*DiscordClient, error) {
+	if publicKey == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("the Discord public key must be a hex encoded Ed25519 key")
+	}
+
+	return &DiscordClient{appId: appId, botToken: botToken, publicKey: key}, nil
+}
+
+// verify checks the Ed25519 signature Discord signs interactions with,
+// which covers the timestamp header followed by the body.
+func (c *DiscordClient) verify(r *http.Request, body []byte) error {
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("the Discord request has no valid signature")
+	}
+	msg := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	if !ed25519.Verify(c.publicKey, msg, sig) {
+		return errors.New("the Discord request signature does not match")
+	}
+	return nil
+}
+
+// callDiscordApi calls the Discord API on behalf of the bot, and decodes
+// its response into v unless v is nil.
+func (c *DiscordClient) callDiscordApi(method string, path string, args interface{}, v interface{}) error {
+	jsonData := new(bytes.Buffer)
+	json.NewEncoder(jsonData).Encode(args)
+	req, err := http.NewRequest(method, discordApiUrl+path, jsonData)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bot "+c.botToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(method + " " + path + " failed: " + resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RegisterCommands sets up the slash commands of the application. Each
+// takes its text as one option, the same text as the Slack commands.
+func (c *DiscordClient) RegisterCommands() error {
+	commands := []map[string]interface{}{
+		discordCommand("initialize", "Start a Secret Santa event in this channel", "Your postal address or organize, then settings such as budget=25", true),
+		discordCommand("participate", "Take part in the Secret Santa event of this channel", "Your postal address, then email=... or event=\"...\" if need be", true),
+		discordCommand("randomize", "Draw the Secret Santa pairs", "event=\"...\" if there are several events", false),
+		discordCommand("get", "Show who you are buying for", "The year or event=\"...\" of the event", false),
+	}
+	return c.callDiscordApi(http.MethodPut, "/applications/"+c.appId+"/commands", commands, nil)
+}
+
+func discordCommand(name string, description string, textDescription string, required bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"options": []DiscordOption{{
+			Description: textDescription,
+			Name:        "text",
+			Required:    required,
+			Type:        discordOptionString,
+		}},
+	}
+}
+
+// editResponse replaces the response to an interaction, e.g. a deferred
+// one.
+func (c *DiscordClient) editResponse(token string, msg string) error {
+	return c.callDiscordApi(http.MethodPatch, "/webhooks/"+c.appId+"/"+token+"/messages/@original", &DiscordMessage{Content: msg}, nil)
+}
+
+// followUp posts another message in response to an interaction.
+func (c *DiscordClient) followUp(token string, msg string) error {
+	return c.callDiscordApi(http.MethodPost, "/webhooks/"+c.appId+"/"+token, &DiscordMessage{Content: msg}, nil)
+}
+
+// sendDirect sends a direct message to a user.
+func (c *DiscordClient) sendDirect(uid string, msg string) error {
+	var channel struct {
+		Id string `json:"id"`
+	}
+	err := c.callDiscordApi(http.MethodPost, "/users/@me/channels", map[string]string{"recipient_id": uid}, &channel)
+	if err != nil {
+		return err
+	}
+	return c.callDiscordApi(http.MethodPost, "/channels/"+channel.Id+"/messages", &DiscordMessage{Content: msg}, nil)
+}
+
+// postChannel posts a message to a channel, in reply to the given message
+// if any, and returns the ID of the new message.
+func (c *DiscordClient) postChannel(channelId string, replyTo string, msg string) (string, error) {
+	args := map[string]interface{}{"content": msg}
+	if replyTo != "" {
+		args["message_reference"] = map[string]string{"message_id": replyTo}
+	}
+	var res struct {
+		Id string `json:"id"`
+	}
+	err := c.callDiscordApi(http.MethodPost, "/channels/"+channelId+"/messages", args, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.Id, nil
+}
+
+// DiscordNotifier sends notices to the participants of Discord events in
+// a direct message. Mentions are written the same way as on Slack, so
+// notices read the same.
+type DiscordNotifier struct {
+	client *DiscordClient
+}
+
+func NewDiscordNotifier(client *DiscordClient) *DiscordNotifier {
+	return &DiscordNotifier{client: client}
+}
+
+func (n *DiscordNotifier) Notify(ctx context.Context, notice *Notice) error {
+	if eventPlatform(notice.Event) != PlatformDiscord {
+		return errNotReached
+	}
+	return n.client.sendDirect(notice.To.UserId, notice.Text)
+}
+
+// DiscordPoster posts to the channels of Discord events.
+type DiscordPoster struct {
+	client *DiscordClient
+}
+
+func NewDiscordPoster(client *DiscordClient) *DiscordPoster {
+	return &DiscordPoster{client: client}
+}
+
+func (p *DiscordPoster) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	if eventPlatform(e) != PlatformDiscord {
+		return "", errNotPosted
+	}
+	return p.client.postChannel(value(e.ChannelId), replyTo, msg)
+}
+
+// discordRequest returns the caller of an interaction and the text of its
+// command. Discord events belong to the channel of the interaction and to
+// its server.
+func discordRequest(in *DiscordInteraction) (*Caller, string) {
+	user := in.User
+	if in.Member != nil {
+		user = in.Member.User
+	}
+	text := ""
+	for _, opt := range in.Data.Options {
+		if opt.Name == "text" {
+			text = opt.Value
+		}
+	}
+
+	return &Caller{
+		ChannelId: String(in.ChannelId),
+		Platform:  PlatformDiscord,
+		TeamId:    String(in.GuildId),
+		UserId:    user.Id,
+		UserName:  user.Username,
+	}, text
+}
+
+func writeDiscordMessage(w http.ResponseWriter, flags int, msg string) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&DiscordResponse{Data: &DiscordMessage{Content: msg, Flags: flags}, Type: discordResponseMessage})
+}
+
+// DiscordHandler receives the interactions of the Discord application's
+// slash commands: /initialize, /participate, /randomize and /get, which
+// work like their Slack counterparts.
+func (h *Handlers) DiscordHandler(w http.ResponseWriter, r *http.Request) {
+	if h.discord == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Discord checks that invalid signatures are turned down before it
+	// accepts the interactions endpoint.
+	err = h.discord.verify(r, body)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var in DiscordInteraction
+	err = json.Unmarshal(body, &in)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if in.Type == discordInteractionPing {
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&DiscordResponse{Type: discordResponsePong})
+		return
+	}
+	if in.Type != discordInteractionCommand || in.Data == nil || (in.Member == nil && in.User == nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c, text := discordRequest(&in)
+	switch in.Data.Name {
+	case "initialize":
+		e, organizerOnly, err := h.CreateEvent(r.Context(), c, text)
+		if err != nil {
+			h.logger.Println(err)
+			writeDiscordMessage(w, discordFlagEphemeral, err.Error())
+			return
+		}
+		msg := "<@" + c.UserId + "> just initiated " + eventTitle(e) + " for the channel <#" + in.ChannelId + ">"
+		if organizerOnly {
+			msg += " and is organizing it without taking part in the exchange"
+		}
+		writeDiscordMessage(w, 0, msg+eventDetails(e))
+	case "participate":
+		e, p, err := h.Enroll(r.Context(), c, text)
+		if err != nil {
+			h.logger.Println(err)
+			writeDiscordMessage(w, discordFlagEphemeral, err.Error())
+			return
+		}
+		writeDiscordMessage(w, 0, "<@"+p.UserId+"> just enrolled in "+eventTitle(e)+" for the channel <#"+in.ChannelId+">")
+	case "randomize":
+		// Discord wants an answer within 3 seconds, which a draw may take
+		// longer than, so it goes on after answering.
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&DiscordResponse{Type: discordResponseDeferred})
+		go h.discordRandomize(in.Token, c, text)
+	case "get":
+		a, err := h.GetAssignment(r.Context(), c, text)
+		if err != nil {
+			h.logger.Println(err)
+			writeDiscordMessage(w, discordFlagEphemeral, err.Error())
+			return
+		}
+		writeDiscordMessage(w, discordFlagEphemeral, assignmentMessage(a.Event, a.Participant, a.Wishlists))
+	default:
+		writeDiscordMessage(w, discordFlagEphemeral, "Usage: /initialize, /participate, /randomize or /get")
+	}
+}
+
+func (h *Handlers) discordRandomize(token string, c *Caller, text string) {
+	e, err := h.Draw(context.Background(), c, text, func(e *Event, d *Draw) {
+		err := h.discord.editResponse(token, "<@"+c.UserId+"> is drawing the pairs of "+eventTitle(e)+". The draw's commitment is `"+d.Commitment+"`, its seed will be revealed on reveal day.")
+		if err != nil {
+			h.logger.Println(err)
+		}
+	})
+	if err != nil {
+		h.logger.Println(err)
+		err = h.discord.editResponse(token, err.Error())
+		if err != nil {
+			h.logger.Println(err)
+		}
+		return
+	}
+
+	err = h.discord.followUp(token, eventTitle(e)+" pairs have been randomized! Everybody has been sent their match in a direct message.")
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
@@ -0,0 +1,124 @@
+// discord_test.go
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestNewDiscordClient(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		publicKey string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{"not configured", "", true, false},
+		{"not hex", "not a key", true, true},
+		{"too short", hex.EncodeToString(pub[:16]), true, true},
+		{"valid", hex.EncodeToString(pub), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewDiscordClient("APP", tt.publicKey, "token")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDiscordClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (c == nil) != tt.wantNil {
+				t.Errorf("NewDiscordClient() = %v, want nil %v", c, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestDiscordVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDiscordClient("APP", hex.EncodeToString(pub), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"type":1}`)
+	sign := func(key ed25519.PrivateKey, timestamp string, body []byte) string {
+		return hex.EncodeToString(ed25519.Sign(key, append([]byte(timestamp), body...)))
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		wantErr   bool
+	}{
+		{"valid", sign(priv, "1700000000", body), "1700000000", false},
+		{"other timestamp", sign(priv, "1700000000", body), "1700000001", true},
+		{"other body", sign(priv, "1700000000", []byte(`{"type":2}`)), "1700000000", true},
+		{"other key", sign(otherPriv, "1700000000", body), "1700000000", true},
+		{"no signature", "", "1700000000", true},
+		{"not hex", "zz", "1700000000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/discord", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("X-Signature-Ed25519", tt.signature)
+			r.Header.Set("X-Signature-Timestamp", tt.timestamp)
+
+			err = c.verify(r, body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscordRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       DiscordInteraction
+		wantUser string
+		wantText string
+	}{
+		{
+			name:     "in a server",
+			in:       DiscordInteraction{ChannelId: "C1", GuildId: "G1", Member: &DiscordMember{User: &DiscordUser{Id: "U1"}}, Data: &DiscordCommandData{Name: "participate", Options: []DiscordOption{{Name: "text", Value: "1 Main St"}}}},
+			wantUser: "U1",
+			wantText: "1 Main St",
+		},
+		{
+			name:     "in a direct message",
+			in:       DiscordInteraction{ChannelId: "C1", User: &DiscordUser{Id: "U2"}, Data: &DiscordCommandData{Name: "get"}},
+			wantUser: "U2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, text := discordRequest(&tt.in)
+			if caller.UserId != tt.wantUser || *caller.ChannelId != tt.in.ChannelId || *caller.TeamId != tt.in.GuildId || caller.Platform != PlatformDiscord {
+				t.Errorf("discordRequest() = %+v", caller)
+			}
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// draw.go
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// drawSource is a random source fully determined by a seed: its numbers are
+// taken from SHA-256(seed || counter), the counter being a big-endian
+// uint64 starting at 0, of which the first 8 bytes are read as a
+// big-endian uint64. Unlike the sources of math/rand, it and the shuffles
+// drawn from it can be reimplemented anywhere to verify a draw.
+type drawSource struct {
+	seed    []byte
+	counter uint64
+}
+
+func (s *drawSource) Uint64() uint64 {
+	block := make([]byte, len(s.seed)+8)
+	copy(block, s.seed)
+	binary.BigEndian.PutUint64(block[len(s.seed):], s.counter)
+	s.counter++
+
+	sum := sha256.Sum256(block)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// intn returns a number in [0, n). Numbers of the source at or above the
+// largest multiple of n below 2^64 are skipped, so that the remainder of
+// the first one that is not, divided by n, is unbiased.
+func (s *drawSource) intn(n int) int {
+	// rem is 2^64 mod n, and -rem wraps around to the largest multiple.
+	rem := (math.MaxUint64%uint64(n) + 1) % uint64(n)
+	for {
+		v := s.Uint64()
+		if rem == 0 || v < -rem {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// Shuffle is the Fisher-Yates shuffle: for i from n-1 down to 1, it swaps
+// i with intn(i+1).
+func (s *drawSource) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, s.intn(i+1))
+	}
+}
+
+// Perm returns 0 to n-1 in the order Shuffle puts them in.
+func (s *drawSource) Perm(n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	s.Shuffle(n, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+	return perm
+}
+
+// newDrawSeed returns a random seed, hex encoded.
+func newDrawSeed() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// drawCommitment is published before the draw, so that the seed revealed
+// afterwards can be checked against it.
+func drawCommitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// runDraw matches the participants of a draw. Given the same seed,
+// participants and options it always returns the same matches. Matching by
+// region uses the countries recorded with the draw, so that it can still
+// be verified once addresses have changed or been erased; draws from
+// before they were recorded fall back to the addresses.
+func runDraw(d *Draw, participants []Participant) (map[string][]string, error) {
+	var uids []string
+	for _, p := range participants {
+		uids = append(uids, p.UserId)
+	}
+	sort.Strings(uids)
+
+	rnd := &drawSource{seed: []byte(d.Seed)}
+	rules := &Event{Exclusions: d.Exclusions}
+	excluded := func(santa string, giftee string) bool {
+		return isExcluded(rules, santa, giftee)
+	}
+	if d.MatchByRegion {
+		countries := d.Regions
+		if countries == nil {
+			countries = participantCountries(participants)
+		}
+		return matchByRegion(rnd, uids, countries, d.GifteesEach, excluded)
+	}
+	return matchParticipants(rnd, uids, d.GifteesEach, excluded)
+}
+
+// newDraw sets up a draw of the given participants with a fresh seed.
+func newDraw(e *Event, participants []Participant) (*Draw, error) {
+	seed, err := newDrawSeed()
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	for _, p := range participants {
+		uids = append(uids, p.UserId)
+	}
+	sort.Strings(uids)
+
+	var regions map[string]string
+	if e.MatchByRegion {
+		regions = participantCountries(participants)
+	}
+
+	return &Draw{
+		At:             time.Now(),
+		Commitment:     drawCommitment(seed),
+		Exclusions:     e.Exclusions,
+		GifteesEach:    e.GifteesEach,
+		MatchByRegion:  e.MatchByRegion,
+		ParticipantIds: uids,
+		Regions:        regions,
+		Seed:           seed,
+	}, nil
+}
+
+// verifyCommand checks the draw of a revealed event: that its seed is the
+// one committed to before the draw, and that drawing again with it gives
+// the same matches.
+func (h *Handlers) verifyCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	events, err := h.channelEvents(r.Context(), &req.Caller)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	// Seeds stay secret until reveal day, so only archived events can be
+	// verified. Without a name the most recent one is.
+	var e *Event
+	for i := range events {
+		if events[i].Status != EventStatusArchived || events[i].Draw == nil {
+			continue
+		}
+		if eventName == "" || strings.EqualFold(eventTitle(&events[i]), eventName) {
+			e = &events[i]
+			break
+		}
+	}
+	if e == nil {
+		err = errors.New("There is no revealed Secret Santa event in this Slack channel to verify")
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	d := e.Draw
+	if drawCommitment(d.Seed) != d.Commitment {
+		writeSlackMessage(w, ResponseTypeEphemeral, ":x: The seed of "+eventTitle(e)+" does not match the commitment published before the draw.")
+		return
+	}
+
+	all, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	h.openAllMatches(e, all)
+	byId := make(map[string]Participant)
+	for _, p := range all {
+		byId[p.UserId] = p
+	}
+	var participants []Participant
+	for _, uid := range d.ParticipantIds {
+		p, ok := byId[uid]
+		if !ok {
+			writeSlackMessage(w, ResponseTypeEphemeral, ":x: <@"+uid+"> took part in the draw of "+eventTitle(e)+" but is no longer enrolled, so it cannot be verified.")
+			return
+		}
+		participants = append(participants, p)
+	}
+
+	matches, err := runDraw(d, participants)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	for _, p := range participants {
+		var stored []string
+		for _, m := range giftees(&p) {
+			stored = append(stored, m.UserId)
+		}
+		if strings.Join(stored, ",") != strings.Join(matches[p.UserId], ",") {
+			writeSlackMessage(w, ResponseTypeEphemeral, ":x: The matches of "+eventTitle(e)+" differ from what its seed gives, starting with the giftees of <@"+p.UserId+">.")
+			return
+		}
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, ":white_check_mark: The draw of "+eventTitle(e)+" checks out: seed `"+d.Seed+"` hashes to the commitment `"+d.Commitment+"` published before the draw, and drawing again with it gives the same matches.")
+}
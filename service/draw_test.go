@@ -0,0 +1,133 @@
+// draw_test.go
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDrawCommitment(t *testing.T) {
+	want := "19b25856e1c150ca834cffc8b59b23adbd0ec0389e58eb22b3b64768098d002b"
+	if got := drawCommitment("seed"); got != want {
+		t.Errorf("drawCommitment() = %s, want %s", got, want)
+	}
+}
+
+// TestRunDraw pins the matches of a fixed seed. Draws are verified by
+// drawing again, so a change to them breaks the verification of every
+// event drawn before it; the expected matches may only change along with
+// the algorithm described in the README.
+func TestRunDraw(t *testing.T) {
+	var participants []Participant
+	for _, uid := range []string{"U6", "U1", "U4", "U2", "U5", "U3"} {
+		participants = append(participants, Participant{UserId: uid})
+	}
+
+	tests := []struct {
+		name string
+		draw Draw
+		want map[string][]string
+	}{
+		{
+			name: "one gift each",
+			draw: Draw{Seed: "seed", GifteesEach: 1},
+			want: map[string][]string{
+				"U1": {"U3"},
+				"U2": {"U4"},
+				"U3": {"U6"},
+				"U4": {"U5"},
+				"U5": {"U1"},
+				"U6": {"U2"},
+			},
+		},
+		{
+			name: "two gifts each with an exclusion",
+			draw: Draw{Seed: "seed", GifteesEach: 2, Exclusions: []Exclusion{{FirstId: "U1", SecondId: "U2"}}},
+			want: map[string][]string{
+				"U1": {"U3", "U6"},
+				"U2": {"U4", "U5"},
+				"U3": {"U6", "U2"},
+				"U4": {"U5", "U1"},
+				"U5": {"U1", "U3"},
+				"U6": {"U2", "U4"},
+			},
+		},
+		{
+			name: "by the recorded regions",
+			draw: Draw{
+				Seed:          "seed",
+				GifteesEach:   1,
+				MatchByRegion: true,
+				Regions: map[string]string{
+					"U1": "germany",
+					"U2": "germany",
+					"U3": "germany",
+					"U4": "france",
+					"U5": "france",
+					"U6": "spain",
+				},
+			},
+			want: map[string][]string{
+				"U1": {"U2"},
+				"U2": {"U3"},
+				"U3": {"U1"},
+				"U4": {"U5"},
+				"U5": {"U6"},
+				"U6": {"U4"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runDraw(&tt.draw, participants)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runDraw() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDrawSource pins the random numbers of a seed, which the README
+// describes for anybody verifying a draw on their own.
+func TestDrawSource(t *testing.T) {
+	s := &drawSource{seed: []byte("seed")}
+	if got := s.Uint64(); got != 1887241067122477493 {
+		t.Errorf("Uint64() = %d, want 1887241067122477493", got)
+	}
+	if got := s.intn(10); got != 7 {
+		t.Errorf("intn(10) = %d, want 7", got)
+	}
+	if got, want := s.Perm(5), []int{3, 0, 1, 4, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Perm(5) = %v, want %v", got, want)
+	}
+}
+
+func TestNewDraw(t *testing.T) {
+	e := &Event{GifteesEach: 2, Exclusions: []Exclusion{{FirstId: "U1", SecondId: "U2"}}}
+	d, err := newDraw(e, []Participant{{UserId: "U3"}, {UserId: "U1"}, {UserId: "U2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Commitment != drawCommitment(d.Seed) {
+		t.Errorf("commitment %s does not match seed %s", d.Commitment, d.Seed)
+	}
+	if want := []string{"U1", "U2", "U3"}; !reflect.DeepEqual(d.ParticipantIds, want) {
+		t.Errorf("ParticipantIds = %v, want %v", d.ParticipantIds, want)
+	}
+	if d.GifteesEach != 2 || len(d.Exclusions) != 1 {
+		t.Errorf("draw does not record the event's rules: %+v", d)
+	}
+
+	other, err := newDraw(e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Seed == d.Seed {
+		t.Errorf("newDraw() reused seed %s", d.Seed)
+	}
+}
@@ -0,0 +1,49 @@
+// errors.go
+package service
+
+import "errors"
+
+const (
+	ErrorKindConflict  string = "conflict"
+	ErrorKindForbidden string = "forbidden"
+	ErrorKindInvalid   string = "invalid"
+	ErrorKindNotFound  string = "notFound"
+)
+
+// DomainError is an error of the Secret Santa rules, such as enrolling
+// twice, as opposed to e.g. the database failing. Its message is meant
+// for users, and its kind lets each platform answer it in its own way.
+type DomainError struct {
+	Kind    string
+	Message string
+}
+
+func (e *DomainError) Error() string {
+	return e.Message
+}
+
+func conflictError(msg string) error {
+	return &DomainError{Kind: ErrorKindConflict, Message: msg}
+}
+
+func forbiddenError(msg string) error {
+	return &DomainError{Kind: ErrorKindForbidden, Message: msg}
+}
+
+func invalidError(msg string) error {
+	return &DomainError{Kind: ErrorKindInvalid, Message: msg}
+}
+
+func notFoundError(msg string) error {
+	return &DomainError{Kind: ErrorKindNotFound, Message: msg}
+}
+
+// ErrorKind returns the kind of a domain error, or an empty string if err
+// is not one.
+func ErrorKind(err error) string {
+	var de *DomainError
+	if errors.As(err, &de) {
+		return de.Kind
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+// errors_test.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorKind(t *testing.T) {
+	closes := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"conflict", conflictError("Already enrolled"), ErrorKindConflict},
+		{"forbidden", forbiddenError("Not a host"), ErrorKindForbidden},
+		{"invalid", invalidError("Bad date"), ErrorKindInvalid},
+		{"not found", notFoundError("No such event"), ErrorKindNotFound},
+		{"wrapped", fmt.Errorf("randomize: %w", notFoundError("No such event")), ErrorKindNotFound},
+		{"not a domain error", errors.New("connection refused"), ""},
+		{"nil", nil, ""},
+		{"authorizeHost", authorizeHost(&Event{OwnerId: "U1"}, "U2", HostActionConfigure), ErrorKindForbidden},
+		{"checkEnrollmentOpen", checkEnrollmentOpen(&Event{Reminders: Reminders{EnrollmentClosesAt: &closes}}, closes.AddDate(0, 0, 2)), ErrorKindConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorKind(tt.err); got != tt.want {
+				t.Errorf("ErrorKind(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainErrorMessage(t *testing.T) {
+	err := invalidError("Please provide a date as YYYY-MM-DD")
+	if err.Error() != "Please provide a date as YYYY-MM-DD" {
+		t.Errorf("Error() = %q, want the message for users", err.Error())
+	}
+}
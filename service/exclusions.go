@@ -0,0 +1,122 @@
+// exclusions.go
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+const exclusionsUsage string = "Usage: /santa exclude | /santa exclude @user @user | /santa exclude remove @user @user"
+
+// isExcluded reports whether the two users must not be matched, in either
+// direction, e.g. because they live together.
+func isExcluded(e *Event, a string, b string) bool {
+	for _, x := range e.Exclusions {
+		if (x.FirstId == a && x.SecondId == b) || (x.FirstId == b && x.SecondId == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// changeExclusion adds or removes the exclusion of two users from each
+// other, who are called pair in error messages.
+func changeExclusion(e *Event, a string, b string, remove bool, pair string) error {
+	if e.Status != "" && e.Status != EventStatusOpen {
+		return conflictError(eventTitle(e) + " pairs have already been matched, reset them first to change exclusions")
+	}
+	if remove {
+		if !isExcluded(e, a, b) {
+			return invalidError(pair + " are not excluded from each other")
+		}
+		var rest []Exclusion
+		for _, x := range e.Exclusions {
+			if !((x.FirstId == a && x.SecondId == b) || (x.FirstId == b && x.SecondId == a)) {
+				rest = append(rest, x)
+			}
+		}
+		e.Exclusions = rest
+		return nil
+	}
+	if isExcluded(e, a, b) {
+		return conflictError(pair + " are already excluded from each other")
+	}
+	e.Exclusions = append(e.Exclusions, Exclusion{FirstId: a, SecondId: b})
+	return nil
+}
+
+func (h *Handlers) excludeCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionExclude)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if len(args) == 0 {
+		lines := []string{eventTitle(e) + " exclusions:"}
+		for _, x := range e.Exclusions {
+			lines = append(lines, "• <@"+x.FirstId+"> and <@"+x.SecondId+">")
+		}
+		if len(e.Exclusions) == 0 {
+			lines = append(lines, "None. "+exclusionsUsage)
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+		return
+	}
+
+	remove := strings.ToLower(args[0]) == "remove"
+	if remove {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		writeSlackMessage(w, ResponseTypeEphemeral, exclusionsUsage)
+		return
+	}
+
+	var uids []string
+	for _, arg := range args {
+		uid, err := parseUserMention(arg)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		uids = append(uids, uid)
+	}
+	a, b := uids[0], uids[1]
+	if a == b {
+		writeSlackMessage(w, ResponseTypeEphemeral, "Please mention two different users")
+		return
+	}
+
+	pair := "<@" + a + "> and <@" + b + ">"
+	e, err = h.updateEvent(r.Context(), e.Id, func(e *Event) error {
+		return changeExclusion(e, a, b, remove, pair)
+	})
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	msg := pair + " will not be matched with each other."
+	if remove {
+		msg = pair + " may be matched again."
+	}
+
+	details := "added"
+	if remove {
+		details = "removed"
+	}
+	h.audit(r.Context(), e, req.UserId, HostActionExclude, a, details+" exclusion with "+b)
+
+	writeSlackMessage(w, ResponseTypeEphemeral, msg)
+}
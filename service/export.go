@@ -0,0 +1,372 @@
+// export.go
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatCsv  string = "csv"
+	ExportFormatJson string = "json"
+)
+
+// RosterSizeLimit is the largest CSV roster accepted over HTTP.
+const RosterSizeLimit int64 = 1 << 20
+
+// rosterColumns are the columns of CSV rosters. Exports write all of them,
+// giftees only with the assignments; imports only need userId and address
+// and skip the columns they do not know, so an export of one event can be
+// imported into another.
+var rosterColumns = []string{"userId", "userName", "address", "email", "isHost", "isMatched", "giftStatus", "items", "links", "sizes", "allergies", "noThanks", "giftees"}
+
+// ParseExportFormat checks the format an export is asked for in, JSON by
+// default.
+func ParseExportFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", ExportFormatJson:
+		return ExportFormatJson, nil
+	case ExportFormatCsv:
+		return ExportFormatCsv, nil
+	default:
+		return "", invalidError("Events can be exported as json or csv, not " + s)
+	}
+}
+
+// ExportEvent exports an event for the operators, see exportEvent.
+func (s *SecretSanta) ExportEvent(ctx context.Context, id string, assignments bool) (*EventExport, error) {
+	e, err := s.repo.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.exportEvent(ctx, e, OperatorId, assignments)
+}
+
+// hostExport exports an event for its owner, see exportEvent.
+func (s *SecretSanta) hostExport(ctx context.Context, c *Caller, e *Event, assignments bool) (*EventExport, error) {
+	err := authorizeHost(e, c.UserId, HostActionExport)
+	if err != nil {
+		return nil, err
+	}
+	return s.exportEvent(ctx, e, c.UserId, assignments)
+}
+
+// exportEvent returns the event's settings and everything its participants
+// have told about themselves, sorted by user ID. Who gives to whom is only
+// included if asked for, and only once the pairs have been revealed. As
+// the export holds everybody's address, it is recorded in the audit log.
+func (s *SecretSanta) exportEvent(ctx context.Context, e *Event, actorId string, assignments bool) (*EventExport, error) {
+	if assignments && e.Status != EventStatusArchived {
+		return nil, conflictError("The pairs of " + eventTitle(e) + " can only be exported once they have been revealed")
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserId < participants[j].UserId
+	})
+	if assignments {
+		s.openAllMatches(e, participants)
+	}
+
+	export := &EventExport{
+		Event:        apiEvent(e),
+		Participants: []ExportParticipant{},
+	}
+	for i := range participants {
+		export.Participants = append(export.Participants, exportParticipant(&participants[i], assignments))
+	}
+
+	details := strconv.Itoa(len(participants)) + " participants"
+	if assignments {
+		details += " with their giftees"
+	}
+	s.audit(ctx, e, actorId, HostActionExport, "", details)
+	return export, nil
+}
+
+// exportParticipant returns what the participant has told about
+// themselves, with their giftees if asked for and their matches are open.
+func exportParticipant(p *Participant, assignments bool) ExportParticipant {
+	x := ExportParticipant{
+		Address:    p.Address,
+		Email:      p.Email,
+		GiftStatus: giftStatus(p),
+		IsHost:     p.IsHost,
+		IsMatched:  p.IsMatched,
+		UserId:     p.UserId,
+		UserName:   p.UserName,
+		Wishlist:   apiWishlist(p.Wishlist),
+	}
+	if assignments {
+		for _, m := range giftees(p) {
+			x.GifteeIds = append(x.GifteeIds, m.UserId)
+		}
+	}
+	return x
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, which a
+// name or wishlist starting with e.g. "=" would otherwise be, by putting a
+// quote in front. csvValue takes it off again on import.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsAny(s[:1], "=+-@\t\r") {
+		return "'" + s
+	}
+	return s
+}
+
+func csvValue(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsAny(s[1:2], "=+-@\t\r") {
+		return s[1:]
+	}
+	return s
+}
+
+// WriteRosterCsv writes the participants of an export as a CSV roster, one
+// row each. Several giftees are separated by semicolons.
+func WriteRosterCsv(w io.Writer, x *EventExport) error {
+	withGiftees := false
+	for _, p := range x.Participants {
+		withGiftees = withGiftees || len(p.GifteeIds) > 0
+	}
+
+	columns := rosterColumns
+	if !withGiftees {
+		columns = columns[:len(columns)-1]
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(columns)
+	if err != nil {
+		return err
+	}
+	for _, p := range x.Participants {
+		wl := p.Wishlist
+		if wl == nil {
+			wl = &ApiWishlist{}
+		}
+		row := []string{
+			csvCell(p.UserId),
+			csvCell(p.UserName),
+			csvCell(value(p.Address)),
+			csvCell(value(p.Email)),
+			strconv.FormatBool(p.IsHost),
+			strconv.FormatBool(p.IsMatched),
+			p.GiftStatus,
+			csvCell(value(wl.Items)),
+			csvCell(value(wl.Links)),
+			csvCell(value(wl.Sizes)),
+			csvCell(value(wl.Allergies)),
+			csvCell(value(wl.NoThanks)),
+		}
+		if withGiftees {
+			row = append(row, csvCell(strings.Join(p.GifteeIds, ";")))
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportRoster enrolls the participants of a CSV roster in an event for
+// the operators, see importRoster.
+func (s *SecretSanta) ImportRoster(ctx context.Context, id string, r io.Reader, dryRun bool) (*ImportReport, error) {
+	e, err := s.repo.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.importRoster(ctx, e, OperatorId, r, dryRun)
+}
+
+// hostImport enrolls the participants of a CSV roster in an event for its
+// hosts, see importRoster.
+func (s *SecretSanta) hostImport(ctx context.Context, c *Caller, e *Event, r io.Reader, dryRun bool) (*ImportReport, error) {
+	err := authorizeHost(e, c.UserId, HostActionImport)
+	if err != nil {
+		return nil, err
+	}
+	return s.importRoster(ctx, e, c.UserId, r, dryRun)
+}
+
+// rosterRow is a participant read from a CSV roster.
+type rosterRow struct {
+	address  string
+	email    *string
+	row      int
+	userId   string
+	userName string
+}
+
+// importRoster enrolls everybody on a CSV roster, e.g. a list of remote
+// staff from HR, as if they had enrolled themselves, and tells them so.
+// Rows that cannot be enrolled are left out and reported, the others are
+// enrolled all the same; a dry run only reports what an import would do.
+// A roster that cannot be read at all, e.g. without a userId column, is
+// rejected as a whole.
+func (s *SecretSanta) importRoster(ctx context.Context, e *Event, actorId string, r io.Reader, dryRun bool) (*ImportReport, error) {
+	rows, report, err := readRoster(r)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = dryRun
+
+	if !dryRun {
+		// Keep the pairs from being drawn halfway through the import.
+		e, err = s.lockEvent(ctx, e.Id, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer s.unlockEvent(ctx, e.Id, nil)
+	}
+	if e.Status != "" && e.Status != EventStatusOpen {
+		return nil, conflictError("Participants can only be imported into " + eventTitle(e) + " before its pairs are drawn")
+	}
+
+	for _, row := range rows {
+		if containsUser(e.OptedOutIds, row.userId) {
+			report.problem(row.row, row.userId, row.userId+" has declined to take part in "+eventTitle(e))
+			continue
+		}
+		if _, err := s.repo.GetParticipantById(ctx, e.Id, row.userId); err == nil {
+			report.problem(row.row, row.userId, row.userId+" is already taking part in "+eventTitle(e))
+			continue
+		}
+		if dryRun {
+			report.Enrolled = append(report.Enrolled, row.userId)
+			continue
+		}
+
+		p := &Participant{Address: String(row.address),
+			ChannelId:    e.ChannelId,
+			Email:        row.email,
+			EnterpriseId: e.EnterpriseId,
+			TeamId:       e.TeamId,
+			UserId:       row.userId,
+			UserName:     row.userName,
+		}
+		err = s.repo.RegisterParticipant(ctx, e.Id, p)
+		if err == ErrAlreadyEnrolled {
+			report.problem(row.row, row.userId, row.userId+" is already taking part in "+eventTitle(e))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Enrolled = append(report.Enrolled, row.userId)
+
+		err = s.notifier.Notify(ctx, enrollmentNotice(e, p))
+		if err != nil {
+			s.logger.Println(err)
+		}
+	}
+
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		return report.Problems[i].Row < report.Problems[j].Row
+	})
+
+	if !dryRun && len(report.Enrolled) > 0 {
+		details := strconv.Itoa(len(report.Enrolled)) + " of " + strconv.Itoa(report.Rows) + " rows enrolled"
+		s.audit(ctx, e, actorId, HostActionImport, "", details)
+	}
+	return report, nil
+}
+
+func (report *ImportReport) problem(row int, uid string, msg string) {
+	report.Problems = append(report.Problems, ImportProblem{Message: msg, Row: row, UserId: uid})
+}
+
+// readRoster reads the rows of a CSV roster, leaving out and reporting
+// those that are not valid on their own. Blank rows are skipped.
+func readRoster(r io.Reader) ([]rosterRow, *ImportReport, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, invalidError("The roster is empty")
+	}
+	if err != nil {
+		return nil, nil, invalidError("The roster could not be read: " + err.Error())
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheets tend to start their CSV files with a byte order mark.
+		name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")
+		columns[strings.ToLower(name)] = i
+	}
+	for _, name := range []string{"userId", "address"} {
+		if _, ok := columns[strings.ToLower(name)]; !ok {
+			return nil, nil, invalidError("The roster needs a " + name + " column, next to userName and email if known")
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[strings.ToLower(name)]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return csvValue(strings.TrimSpace(record[i]))
+	}
+
+	report := &ImportReport{Enrolled: []string{}, Problems: []ImportProblem{}}
+	var rows []rosterRow
+	seen := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, invalidError("The roster could not be read: " + err.Error())
+		}
+		// Quoted fields may span lines, so rows are told by the line
+		// they start on.
+		line, _ := cr.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		report.Rows++
+
+		row := rosterRow{
+			address:  field(record, "address"),
+			row:      line,
+			userId:   field(record, "userId"),
+			userName: field(record, "userName"),
+		}
+		if row.userId == "" {
+			report.problem(line, "", "The user ID is missing")
+			continue
+		}
+		if first, ok := seen[row.userId]; ok {
+			report.problem(line, row.userId, row.userId+" is already on row "+strconv.Itoa(first))
+			continue
+		}
+		seen[row.userId] = line
+
+		if len(row.address) < 5 {
+			report.problem(line, row.userId, "Please provide a valid postal address for "+row.userId)
+			continue
+		}
+		row.email, err = parseEmail(field(record, "email"))
+		if err != nil {
+			report.problem(line, row.userId, err.Error())
+			continue
+		}
+		if row.userName == "" {
+			row.userName = row.userId
+		}
+		rows = append(rows, row)
+	}
+	return rows, report, nil
+}
@@ -0,0 +1,224 @@
+// export_test.go
+package service
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExportFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"default", "", ExportFormatJson, false},
+		{"json", "json", ExportFormatJson, false},
+		{"csv upper case", "CSV", ExportFormatCsv, false},
+		{"unknown", "xlsx", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExportFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExportFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if tt.wantErr && ErrorKind(err) != ErrorKindInvalid {
+				t.Errorf("ParseExportFormat(%q) error kind = %q, want %q", tt.in, ErrorKind(err), ErrorKindInvalid)
+			}
+			if got != tt.want {
+				t.Errorf("ParseExportFormat(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRoster(t *testing.T) {
+	tests := []struct {
+		name         string
+		csv          string
+		wantIds      []string
+		wantProblems []int
+		wantRows     int
+		wantErr      bool
+	}{
+		{
+			name:    "empty",
+			csv:     "",
+			wantErr: true,
+		},
+		{
+			name:    "no address column",
+			csv:     "userId,userName\nU1,Ann\n",
+			wantErr: true,
+		},
+		{
+			name:     "valid rows",
+			csv:      "userId,userName,address\nU1,Ann,1 Main Street\nU2,,2 Main Street\n",
+			wantIds:  []string{"U1", "U2"},
+			wantRows: 2,
+		},
+		{
+			name:     "byte order mark and case",
+			csv:      "\ufeffUserID,ADDRESS\nU1,1 Main Street\n",
+			wantIds:  []string{"U1"},
+			wantRows: 1,
+		},
+		{
+			name:     "blank rows are skipped",
+			csv:      "userId,address\n\n,\nU1,1 Main Street\n",
+			wantIds:  []string{"U1"},
+			wantRows: 1,
+		},
+		{
+			name:         "invalid rows are reported",
+			csv:          "userId,address,email\n,1 Main Street,\nU1,1 Main Street,\nU1,2 Main Street,\nU2,x,\nU3,3 Main Street,not an email\nU4,4 Main Street,u4@example.com\n",
+			wantIds:      []string{"U1", "U4"},
+			wantProblems: []int{2, 4, 5, 6},
+			wantRows:     6,
+		},
+		{
+			name:         "problems by file line",
+			csv:          "userId,address\n\nU1,\"1 Main Street\nSpringfield\"\nU2,x\n",
+			wantIds:      []string{"U1"},
+			wantProblems: []int{5},
+			wantRows:     2,
+		},
+		{
+			name:     "escaped formula",
+			csv:      "userId,address\n'=U1,1 Main Street\n",
+			wantIds:  []string{"=U1"},
+			wantRows: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, report, err := readRoster(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRoster() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if ErrorKind(err) != ErrorKindInvalid {
+					t.Errorf("readRoster() error kind = %q, want %q", ErrorKind(err), ErrorKindInvalid)
+				}
+				return
+			}
+
+			var ids []string
+			for _, row := range rows {
+				ids = append(ids, row.userId)
+				if row.userName == "" {
+					t.Errorf("row %d has no user name", row.row)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("readRoster() user IDs = %q, want %q", ids, tt.wantIds)
+			}
+			var problems []int
+			for _, p := range report.Problems {
+				problems = append(problems, p.Row)
+			}
+			if !reflect.DeepEqual(problems, tt.wantProblems) {
+				t.Errorf("readRoster() problem rows = %v, want %v", problems, tt.wantProblems)
+			}
+			if report.Rows != tt.wantRows {
+				t.Errorf("readRoster() rows = %d, want %d", report.Rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestWriteRosterCsv(t *testing.T) {
+	address := "1 Main Street"
+	items := "Socks"
+	tests := []struct {
+		name   string
+		export *EventExport
+		want   string
+	}{
+		{
+			name: "without giftees",
+			export: &EventExport{Participants: []ExportParticipant{
+				{Address: &address, IsHost: true, UserId: "U1", UserName: "Ann", Wishlist: &ApiWishlist{Items: &items}},
+			}},
+			want: "userId,userName,address,email,isHost,isMatched,giftStatus,items,links,sizes,allergies,noThanks\n" +
+				"U1,Ann,1 Main Street,,true,false,,Socks,,,,\n",
+		},
+		{
+			name: "with giftees",
+			export: &EventExport{Participants: []ExportParticipant{
+				{GifteeIds: []string{"U2", "U3"}, IsMatched: true, UserId: "U1", UserName: "Ann"},
+				{UserId: "U2", UserName: "Bob"},
+			}},
+			want: "userId,userName,address,email,isHost,isMatched,giftStatus,items,links,sizes,allergies,noThanks,giftees\n" +
+				"U1,Ann,,,false,true,,,,,,,U2;U3\n" +
+				"U2,Bob,,,false,false,,,,,,,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteRosterCsv(&buf, tt.export)
+			if err != nil {
+				t.Fatalf("WriteRosterCsv() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("WriteRosterCsv() =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCsvCell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"Ann", "Ann"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+1 555", "'+1 555"},
+		{"-", "'-"},
+		{"@U1", "'@U1"},
+		{"\tAnn", "'\tAnn"},
+		{"'quoted", "'quoted"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := csvCell(tt.in)
+			if got != tt.want {
+				t.Errorf("csvCell(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if back := csvValue(got); back != tt.in {
+				t.Errorf("csvValue(%q) = %q, want %q", got, back, tt.in)
+			}
+		})
+	}
+}
+
+func TestWriteRosterCsvRoundTrip(t *testing.T) {
+	address := "1 Main Street, Springfield"
+	export := &EventExport{Participants: []ExportParticipant{
+		{Address: &address, UserId: "U1", UserName: "=Ann \"the host\""},
+	}}
+
+	var buf bytes.Buffer
+	err := WriteRosterCsv(&buf, export)
+	if err != nil {
+		t.Fatalf("WriteRosterCsv() error = %v", err)
+	}
+	rows, report, err := readRoster(&buf)
+	if err != nil {
+		t.Fatalf("readRoster() error = %v", err)
+	}
+	if len(report.Problems) != 0 || len(rows) != 1 {
+		t.Fatalf("readRoster() = %d rows, problems %v", len(rows), report.Problems)
+	}
+	if rows[0].address != address || rows[0].userName != export.Participants[0].UserName {
+		t.Errorf("readRoster() = %+v, want the exported participant back", rows[0])
+	}
+}
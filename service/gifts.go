@@ -0,0 +1,243 @@
+// gifts.go
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	GiftStatusPurchased string = "purchased"
+	GiftStatusShipped   string = "shipped"
+	GiftStatusReceived  string = "received"
+)
+
+const giftUsage string = `Usage: /santa gift purchased [@giftee] | /santa gift shipped [@giftee] [carrier="DHL"] [tracking="123456"] | /santa gift received [<thread ID>]`
+
+var giftKeys = []string{"carrier", "tracking"}
+
+// giftRanks orders the gift statuses by how far a gift has come.
+var giftRanks = map[string]int{
+	"":                  0,
+	GiftStatusPurchased: 1,
+	GiftStatusShipped:   2,
+	GiftStatusReceived:  3,
+}
+
+// giftProgress is how far a single gift has come.
+func giftProgress(g *Gift) string {
+	switch {
+	case g == nil:
+		return ""
+	case g.ReceivedAt != nil:
+		return GiftStatusReceived
+	case g.ShippedAt != nil:
+		return GiftStatusShipped
+	case g.PurchasedAt != nil:
+		return GiftStatusPurchased
+	}
+	return ""
+}
+
+// gifteeCount is how many giftees a santa has. Santas whose giftees are
+// sealed only tell it by their santa tags.
+func gifteeCount(p *Participant) int {
+	if len(p.SantaTags) > 0 {
+		return len(p.SantaTags)
+	}
+	return len(giftees(p))
+}
+
+// santaGifts returns the gifts a santa has got going, one per giftee.
+// Santas of events from before there could be several giftees kept their
+// one gift in the single gift field, which does not name whom it is for,
+// so it only counts while they have exactly one giftee.
+func santaGifts(p *Participant) []Gift {
+	if len(p.Gifts) == 0 && p.Gift != nil && gifteeCount(p) == 1 {
+		return []Gift{*p.Gift}
+	}
+	return p.Gifts
+}
+
+// giftStatus is how far the gifts of a santa have come, which is as far as
+// the one furthest behind.
+func giftStatus(p *Participant) string {
+	gifts := santaGifts(p)
+	if len(gifts) == 0 || len(gifts) < gifteeCount(p) {
+		return ""
+	}
+
+	status := GiftStatusReceived
+	for i := range gifts {
+		if s := giftProgress(&gifts[i]); giftRanks[s] < giftRanks[status] {
+			status = s
+		}
+	}
+	return status
+}
+
+// isGiftSent tells whether a santa has sent off the gifts to all of their
+// giftees.
+func isGiftSent(p *Participant) bool {
+	status := giftStatus(p)
+	return status == GiftStatusShipped || status == GiftStatusReceived
+}
+
+// giftKey names the giftee a gift is for. With assignment keys it is their
+// santa tag, so that the santa's record does not give away whom they give
+// to.
+func (s *SecretSanta) giftKey(eventId string, gifteeId string) string {
+	if s.keys != nil {
+		return s.keys.santaTag(eventId, gifteeId)
+	}
+	return gifteeId
+}
+
+// giftFor returns a copy of the gift the santa gives to the given giftee,
+// or a new one if they have not started on it. A gift that does not name
+// its giftee is only theirs if the santa has no other giftee.
+func (s *SecretSanta) giftFor(eventId string, p *Participant, gifteeId string) *Gift {
+	key := s.giftKey(eventId, gifteeId)
+	gift := Gift{For: key}
+	for _, g := range santaGifts(p) {
+		if g.For == key || (g.For == "" && gifteeCount(p) == 1) {
+			gift = g
+			gift.For = key
+			break
+		}
+	}
+	return &gift
+}
+
+func trackingDetails(g *Gift) string {
+	var parts []string
+	if g.Carrier != nil {
+		parts = append(parts, *g.Carrier)
+	}
+	if g.TrackingNumber != nil {
+		parts = append(parts, "tracking number "+*g.TrackingNumber)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func (h *Handlers) giftCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, giftUsage)
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	switch strings.ToLower(args[0]) {
+	case GiftStatusPurchased, GiftStatusShipped:
+		p, err := h.repo.GetParticipantById(r.Context(), e.Id, req.UserId)
+		if err == nil {
+			h.openMatches(e, p)
+		}
+		if err != nil || !p.IsMatched || len(giftees(p)) == 0 {
+			err = errors.New("You have no match in " + eventTitle(e) + " to send a gift to yet")
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+
+		shipped := strings.ToLower(args[0]) == GiftStatusShipped
+		rest, opts := parseOptions(strings.Join(args[1:], " "), giftKeys)
+		m, extra, err := pickGiftee(e, p, strings.Fields(rest))
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		if len(extra) > 0 || (!shipped && len(opts) > 0) {
+			writeSlackMessage(w, ResponseTypeEphemeral, giftUsage)
+			return
+		}
+
+		gift := h.giftFor(e.Id, p, m.UserId)
+		if gift.PurchasedAt == nil {
+			gift.PurchasedAt = &now
+		}
+
+		msg := "Your gift for <@" + m.UserId + "> is marked as purchased."
+		if shipped {
+			if _, ok := opts["carrier"]; ok {
+				gift.Carrier = optionalString(strings.TrimSpace(opts["carrier"]))
+			}
+			if _, ok := opts["tracking"]; ok {
+				gift.TrackingNumber = optionalString(strings.TrimSpace(opts["tracking"]))
+			}
+			gift.ShippedAt = &now
+			msg = "Your gift for <@" + m.UserId + "> is marked as shipped" + trackingDetails(gift) + "."
+		}
+
+		err = h.repo.UpdateGift(r.Context(), e.Id, req.UserId, gift)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+
+		if shipped {
+			// The thread ID tells the giftee's santas apart without
+			// giving away who they are.
+			notice := "Your " + eventTitle(e) + " Secret Santa has shipped your gift" + trackingDetails(gift) + ". Once it arrives, let them know with `/santa gift received " + h.threadId(e.Id, req.UserId, m.UserId) + "`."
+			_, err = PostSlackMessage(h.botToken, m.UserId, notice)
+			if err != nil {
+				h.logger.Println(err)
+			}
+		}
+
+		writeSlackMessage(w, ResponseTypeEphemeral, msg)
+	case GiftStatusReceived:
+		santas, err := h.getSantas(r.Context(), e, req.UserId)
+		if err != nil || len(santas) == 0 {
+			err = errors.New("Nobody has been matched to give you a gift in " + eventTitle(e) + " yet")
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+
+		santa, extra, err := h.pickSanta(e, santas, req.UserId, args[1:])
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		if len(extra) > 0 {
+			writeSlackMessage(w, ResponseTypeEphemeral, giftUsage)
+			return
+		}
+
+		gift := h.giftFor(e.Id, santa, req.UserId)
+		gift.ReceivedAt = &now
+
+		err = h.repo.UpdateGift(r.Context(), e.Id, santa.UserId, gift)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+
+		_, err = PostSlackMessage(h.botToken, santa.UserId, "<@"+req.UserId+"> has received your "+eventTitle(e)+" gift. Well done, Santa!")
+		if err != nil {
+			h.logger.Println(err)
+		}
+
+		writeSlackMessage(w, ResponseTypeEphemeral, "Thank you! Your Secret Santa has been told that your gift arrived.")
+	default:
+		writeSlackMessage(w, ResponseTypeEphemeral, giftUsage)
+	}
+}
@@ -0,0 +1,103 @@
+// gifts_test.go
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGiftStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		gift     *Gift
+		want     string
+		wantSent bool
+	}{
+		{"no gift", nil, "", false},
+		{"nothing done", &Gift{}, "", false},
+		{"purchased", &Gift{PurchasedAt: &now}, GiftStatusPurchased, false},
+		{"shipped", &Gift{PurchasedAt: &now, ShippedAt: &now}, GiftStatusShipped, true},
+		{"received", &Gift{PurchasedAt: &now, ShippedAt: &now, ReceivedAt: &now}, GiftStatusReceived, true},
+		{"received without shipping", &Gift{ReceivedAt: &now}, GiftStatusReceived, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			giftee := "U2"
+			p := &Participant{Gift: tt.gift, IsMatched: true, YourMatchId: &giftee}
+			if got := giftStatus(p); got != tt.want {
+				t.Errorf("giftStatus() = %q, want %q", got, tt.want)
+			}
+			if got := isGiftSent(p); got != tt.wantSent {
+				t.Errorf("isGiftSent() = %v, want %v", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+// TestGiftFor checks that a gift from before santas could have several
+// giftees only counts for the one giftee it must have been meant for.
+func TestGiftFor(t *testing.T) {
+	now := time.Now()
+	legacy := &Gift{PurchasedAt: &now}
+	u2 := "U2"
+	tests := []struct {
+		name       string
+		p          *Participant
+		gifteeId   string
+		wantBought bool
+		wantStatus string
+	}{
+		{"legacy gift of one giftee", &Participant{Gift: legacy, IsMatched: true, YourMatchId: &u2}, "U2", true, GiftStatusPurchased},
+		{
+			"legacy gift of several giftees",
+			&Participant{Gift: legacy, IsMatched: true, YourMatches: []Match{{UserId: "U2"}, {UserId: "U3"}}},
+			"U3", false, "",
+		},
+		{
+			"unnamed gift among several giftees",
+			&Participant{Gifts: []Gift{{PurchasedAt: &now}}, IsMatched: true, YourMatches: []Match{{UserId: "U2"}, {UserId: "U3"}}},
+			"U2", false, "",
+		},
+		{
+			"named gift",
+			&Participant{Gifts: []Gift{{For: "U3", PurchasedAt: &now}}, IsMatched: true, YourMatches: []Match{{UserId: "U2"}, {UserId: "U3"}}},
+			"U3", true, "",
+		},
+	}
+
+	s := &SecretSanta{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := s.giftFor("E1", tt.p, tt.gifteeId)
+			if g.For != tt.gifteeId || (g.PurchasedAt != nil) != tt.wantBought {
+				t.Errorf("giftFor(%q) = %+v, want bought %v", tt.gifteeId, g, tt.wantBought)
+			}
+			if got := giftStatus(tt.p); got != tt.wantStatus {
+				t.Errorf("giftStatus() = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTrackingDetails(t *testing.T) {
+	tests := []struct {
+		name string
+		gift Gift
+		want string
+	}{
+		{"nothing", Gift{}, ""},
+		{"carrier", Gift{Carrier: optionalString("DHL")}, " (DHL)"},
+		{"tracking number", Gift{TrackingNumber: optionalString("123456")}, " (tracking number 123456)"},
+		{"both", Gift{Carrier: optionalString("DHL"), TrackingNumber: optionalString("123456")}, " (DHL, tracking number 123456)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trackingDetails(&tt.gift); got != tt.want {
+				t.Errorf("trackingDetails() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
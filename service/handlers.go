@@ -2,36 +2,63 @@
 package service
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
+	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// Handlers serves the chat platforms on top of the SecretSanta service.
 type Handlers struct {
-	logger *log.Logger
-	repo   ServiceRepo
+	*SecretSanta
+	botToken      string
+	signingSecret string
+	apiKeys       *ApiKeys
+	web           *WebUI
+	teams         *TeamsClient
+	discord       *DiscordClient
+	mattermost    *MattermostClient
 }
 
-func NewHandlers(l *log.Logger, r ServiceRepo) *Handlers {
+// NewHandlers returns the handlers of every platform. Slack requests are
+// only served if they are signed with the signing secret of the Slack app.
+func NewHandlers(santa *SecretSanta, botToken string, signingSecret string, apiKeys *ApiKeys, web *WebUI, teams *TeamsClient, discord *DiscordClient, mattermost *MattermostClient) *Handlers {
 	return &Handlers{
-		logger: l,
-		repo:   r,
+		SecretSanta:   santa,
+		botToken:      botToken,
+		signingSecret: signingSecret,
+		apiKeys:       apiKeys,
+		web:           web,
+		teams:         teams,
+		discord:       discord,
+		mattermost:    mattermost,
 	}
 }
 
 func (h *Handlers) SetupRoutes(mux *mux.Router) {
 	loggingMiddleware := LoggingMiddleware(h.logger)
 	mux.Use(loggingMiddleware)
-	mux.HandleFunc("/get", h.GetHandler).Methods(http.MethodPost)
-	mux.HandleFunc("/initialize", h.InitializeHandler).Methods(http.MethodPost)
-	mux.HandleFunc("/participate", h.ParticipateHandler).Methods(http.MethodPost)
-	mux.HandleFunc("/randomize", h.RandomizeHandler).Methods(http.MethodPost)
+	mux.HandleFunc("/discord/interactions", h.DiscordHandler).Methods(http.MethodPost)
+	mux.HandleFunc("/get", h.verifySlack(h.GetHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/initialize", h.verifySlack(h.InitializeHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/interactions", h.verifySlack(h.InteractionsHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/mattermost/commands", h.MattermostHandler).Methods(http.MethodPost)
+	mux.HandleFunc("/participate", h.verifySlack(h.ParticipateHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/randomize", h.verifySlack(h.RandomizeHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/santa", h.verifySlack(h.SantaHandler)).Methods(http.MethodPost)
+	mux.HandleFunc("/teams/messages", h.TeamsHandler).Methods(http.MethodPost)
+	h.setupApiRoutes(mux)
+	h.setupWebRoutes(mux)
+}
+
+func (h *Handlers) SetupJobs(s *Scheduler) {
+	s.Register(JobKindEnrollmentReminder, h.EnrollmentReminderJob)
+	s.Register(JobKindGiftReminder, h.GiftReminderJob)
+	s.Register(JobKindRevealReminder, h.RevealReminderJob)
 }
 
 func (h *Handlers) GetHandler(w http.ResponseWriter, r *http.Request) {
@@ -43,33 +70,9 @@ func (h *Handlers) GetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := &SlackRequest{ChannelId: String(r.PostForm.Get("channel_id")),
-		ChannelName:    String(r.PostForm.Get("channel_name")),
-		Command:        String(r.PostForm.Get("command")),
-		EnterpriseId:   nil,
-		EnterpriseName: nil,
-		ResponseUrl:    r.PostForm.Get("response_url"),
-		TeamDomain:     String(r.PostForm.Get("team_domain")),
-		TeamId:         String(r.PostForm.Get("team_id")),
-		Text:           String(r.PostForm.Get("text")),
-		Token:          String(r.PostForm.Get("token")),
-		TriggerId:      String(r.PostForm.Get("trigger_id")),
-		UserId:         r.PostForm.Get("user_id"),
-		UserName:       r.PostForm.Get("user_name"),
-	}
-
-	t := time.Now()
-	y := t.Year()
-	
-	if req.Text != nil && len(*req.Text) >= 4 {
-		layout := "2006"
-		t, err = time.Parse(layout, *req.Text)
-		if err == nil {
-			y = t.Year()
-		}
-	}
+	req := newSlackRequest(r)
 
-	p, err := h.repo.GetParticipantById(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, req.UserId, y)
+	a, err := h.GetAssignment(r.Context(), &req.Caller, *req.Text)
 	if err != nil {
 		h.logger.Println(err)
 		w.WriteHeader(http.StatusOK)
@@ -77,28 +80,8 @@ func (h *Handlers) GetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !p.IsMatched || p.YourMatchId == nil {
-		channelId := ""
-		if req.ChannelId != nil {
-			channelId = *req.ChannelId
-		}
-		err = errors.New("Secret Santa " + strconv.Itoa(y) + " pairs have not been matched yet for the Slack channel <#" + channelId + ">")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
 	// Slack
-	yourMatchId := ""
-	if p.YourMatchId != nil {
-		yourMatchId = *p.YourMatchId
-	}
-	yourMatchAddress := ""
-	if p.YourMatchAddress != nil {
-		yourMatchAddress = *p.YourMatchAddress
-	}
-	msg := "Your match is <@" + yourMatchId + ">. Prepare your gift and send it to " + yourMatchAddress + ". Thank you and happy New Year!"
+	msg := assignmentMessage(a.Event, a.Participant, a.Wishlists)
 	err = SendSlackMessage(req.ResponseUrl, ResponseTypeEphemeral, msg)
 	if err != nil {
 		h.logger.Println(err)
@@ -117,55 +100,9 @@ func (h *Handlers) InitializeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := &SlackRequest{ChannelId: String(r.PostForm.Get("channel_id")),
-		ChannelName:    String(r.PostForm.Get("channel_name")),
-		Command:        String(r.PostForm.Get("command")),
-		EnterpriseId:   nil,
-		EnterpriseName: nil,
-		ResponseUrl:    r.PostForm.Get("response_url"),
-		TeamDomain:     String(r.PostForm.Get("team_domain")),
-		TeamId:         String(r.PostForm.Get("team_id")),
-		Text:           String(r.PostForm.Get("text")),
-		Token:          String(r.PostForm.Get("token")),
-		TriggerId:      String(r.PostForm.Get("trigger_id")),
-		UserId:         r.PostForm.Get("user_id"),
-		UserName:       r.PostForm.Get("user_name"),
-	}
-
-	if req.Text == nil || (req.Text != nil && len(*req.Text) < 5) {
-		err = errors.New("Please provide a valid postal address by typing it after the command")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	t := time.Now()
-	y := t.Year()
-
-	pCount, _ := h.repo.CountAllParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
-	if pCount > 0 {
-		err := errors.New("Secret Santa " + strconv.Itoa(y) + " has already been initialized for this Slack channel")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
+	req := newSlackRequest(r)
 
-	p := &Participant{req.Text,
-		req.ChannelId,
-		req.EnterpriseId,
-		true,
-		false,
-		req.ResponseUrl,
-		req.TeamId,
-		req.UserId,
-		req.UserName,
-		nil,
-		nil,
-		nil,
-	}
-	err = h.repo.RegisterParticipant(r.Context(), p, y)
+	e, organizerOnly, err := h.CreateEvent(r.Context(), &req.Caller, *req.Text)
 	if err != nil {
 		h.logger.Println(err)
 		w.WriteHeader(http.StatusOK)
@@ -178,7 +115,11 @@ func (h *Handlers) InitializeHandler(w http.ResponseWriter, r *http.Request) {
 	if req.ChannelId != nil {
 		channelId = *req.ChannelId
 	}
-	msg := "<@" + req.UserId + "> just initiated Secret Santa " + strconv.Itoa(y) + " for the Slack channel <#" + channelId + ">"
+	msg := "<@" + req.UserId + "> just initiated " + eventTitle(e) + " for the Slack channel <#" + channelId + ">"
+	if organizerOnly {
+		msg += " and is organizing it without taking part in the exchange"
+	}
+	msg += eventDetails(e)
 	err = SendSlackMessage(req.ResponseUrl, ResponseTypeInChannel, msg)
 	if err != nil {
 		h.logger.Println(err.Error())
@@ -197,50 +138,9 @@ func (h *Handlers) ParticipateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := &SlackRequest{ChannelId: String(r.PostForm.Get("channel_id")),
-		ChannelName:    String(r.PostForm.Get("channel_name")),
-		Command:        String(r.PostForm.Get("command")),
-		EnterpriseId:   nil,
-		EnterpriseName: nil,
-		ResponseUrl:    r.PostForm.Get("response_url"),
-		TeamDomain:     String(r.PostForm.Get("team_domain")),
-		TeamId:         String(r.PostForm.Get("team_id")),
-		Text:           String(r.PostForm.Get("text")),
-		Token:          String(r.PostForm.Get("token")),
-		TriggerId:      String(r.PostForm.Get("trigger_id")),
-		UserId:         r.PostForm.Get("user_id"),
-		UserName:       r.PostForm.Get("user_name"),
-	}
+	req := newSlackRequest(r)
 
-	if req.Text == nil || (req.Text != nil && len(*req.Text) < 5) {
-		err = errors.New("Please provide a valid postal address by typing it after the command")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	t := time.Now()
-	y := t.Year()
-
-	pCount, err := h.repo.CountAllParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
-	if err != nil {
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	if pCount < 1 {
-		err := errors.New("Secret Santa has not been initialized yet")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	p := &Participant{req.Text, req.ChannelId, req.EnterpriseId, false, false, req.ResponseUrl, req.TeamId, req.UserId, req.UserName, nil, nil, nil}
-	err = h.repo.RegisterParticipant(r.Context(), p, y)
+	e, p, err := h.Enroll(r.Context(), &req.Caller, *req.Text)
 	if err != nil {
 		h.logger.Println(err)
 		w.WriteHeader(http.StatusOK)
@@ -253,7 +153,7 @@ func (h *Handlers) ParticipateHandler(w http.ResponseWriter, r *http.Request) {
 	if p.ChannelId != nil {
 		channelId = *p.ChannelId
 	}
-	msg := "<@" + p.UserId + "> just enrolled in Secret Santa " + strconv.Itoa(y) + " for the Slack channel <#" + channelId + ">"
+	msg := "<@" + p.UserId + "> just enrolled in " + eventTitle(e) + " for the Slack channel <#" + channelId + ">"
 	err = SendSlackMessage(p.ResponseUrl, ResponseTypeInChannel, msg)
 	if err != nil {
 		h.logger.Println(err.Error())
@@ -272,129 +172,14 @@ func (h *Handlers) RandomizeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := &SlackRequest{ChannelId: String(r.PostForm.Get("channel_id")),
-		ChannelName:    String(r.PostForm.Get("channel_name")),
-		Command:        String(r.PostForm.Get("command")),
-		EnterpriseId:   nil,
-		EnterpriseName: nil,
-		ResponseUrl:    r.PostForm.Get("response_url"),
-		TeamDomain:     String(r.PostForm.Get("team_domain")),
-		TeamId:         String(r.PostForm.Get("team_id")),
-		Text:           String(r.PostForm.Get("text")),
-		Token:          String(r.PostForm.Get("token")),
-		TriggerId:      String(r.PostForm.Get("trigger_id")),
-		UserId:         r.PostForm.Get("user_id"),
-		UserName:       r.PostForm.Get("user_name"),
-	}
-
-	t := time.Now()
-	y := t.Year()
+	req := newSlackRequest(r)
 
-	p, err := h.repo.GetParticipantById(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, req.UserId, y)
-	if err != nil {
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	if !p.IsHost {
-		err := errors.New("You are not the host of this secret santa party, hence cannot randomize pairs")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	pCount, err := h.repo.CountAllParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
-	if err != nil {
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	if pCount < 1 {
-		err := errors.New("Secret Santa " + strconv.Itoa(y) + " has not been initialized yet for this Slack channel")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	mCount, err := h.repo.CountMatchedParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
-	if err != nil {
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	if mCount > 0 && mCount == pCount {
-		err := errors.New("Secret Santa " + strconv.Itoa(y) + " pairs for this Slack channel have already been matched")
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-
-	poolA, err := h.repo.GetUnmatchedParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
-	if err != nil {
-		h.logger.Println(err)
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-		return
-	}
-	
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(poolA), func(i, j int) { poolA[i], poolA[j] = poolA[j], poolA[i] })
-	for key, value := range poolA {
-		if key == len(poolA) - 1 {
-			err := h.repo.UpdateParticipantMatch(r.Context(), &poolA[0], &value, y)
-			if err != nil {
-				h.logger.Println(err)
-				w.WriteHeader(http.StatusOK)
-				_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-				return
-			}
-		} else {
-			err := h.repo.UpdateParticipantMatch(r.Context(), &poolA[key+1], &value, y)
-			if err != nil {
-				h.logger.Println(err)
-				w.WriteHeader(http.StatusOK)
-				_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-				return
-			}
-		}
-	}
-
-	/*
-	poolB := make([]Participant, len(poolA))
-	copy(poolB, poolA)
-	rand.Seed(time.Now().UnixNano())
-	for len(poolA) > 0 {
-		participantA := poolA[0]
-		if !participantA.IsMatched && participantA.YourMatchId == nil {
-			i := rand.Intn(len(poolB))
-			participantB := poolB[i]
-			if participantA == participantB && len(poolA) != 1 {
-				continue
-			}
-			err := h.repo.UpdateParticipantMatch(r.Context(), &participantB, &participantA, y)
-			if err != nil {
-				h.logger.Println(err)
-				w.WriteHeader(http.StatusOK)
-				_ = json.NewEncoder(w).Encode(&SlackMessage{ResponseTypeEphemeral, err.Error()})
-				return
-			}
-
-			poolA = append(poolA[:0], poolA[1:]...)
-			poolB = append(poolB[:i], poolB[i+1:]...)
+	e, err := h.Draw(r.Context(), &req.Caller, *req.Text, func(e *Event, d *Draw) {
+		err := SendSlackMessage(req.ResponseUrl, ResponseTypeInChannel, "<@"+req.UserId+"> is drawing the pairs of "+eventTitle(e)+". The draw's commitment is `"+d.Commitment+"`, its seed will be revealed on reveal day.")
+		if err != nil {
+			h.logger.Println(err)
 		}
-	}
-	*/
-	
-	matchedParticipants, err := h.repo.GetAllParticipants(r.Context(), req.ChannelId, req.EnterpriseId, req.TeamId, y)
+	})
 	if err != nil {
 		h.logger.Println(err)
 		w.WriteHeader(http.StatusOK)
@@ -402,24 +187,7 @@ func (h *Handlers) RandomizeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Slack
-	for _, participant := range matchedParticipants {
-		yourMatchId := ""
-		if participant.YourMatchId != nil {
-			yourMatchId = *participant.YourMatchId
-		}
-		yourMatchAddress := ""
-		if participant.YourMatchAddress != nil {
-			yourMatchAddress = *participant.YourMatchAddress
-		}
-		msg := "<@" + participant.UserId + ">, your match is <@" + yourMatchId + ">. Prepare your gift and send it to " + yourMatchAddress + ". Thank you and happy New Year!"
-		err = SendSlackMessage(participant.ResponseUrl, ResponseTypeEphemeral, msg)
-		if err != nil {
-			h.logger.Println(err)
-		}
-	}
-
-	err = SendSlackMessage(p.ResponseUrl, ResponseTypeInChannel, "<!channel> Secret Santa pairs have been randomized!")
+	err = SendSlackMessage(req.ResponseUrl, ResponseTypeInChannel, "<!channel> "+eventTitle(e)+" pairs have been randomized!")
 	if err != nil {
 		h.logger.Println(err)
 	}
@@ -439,3 +207,28 @@ func LoggingMiddleware(logger *log.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(fn)
 	}
 }
+
+// verifySlack only lets requests through that Slack has signed with the
+// signing secret of the app, as the user and channel of a command are
+// taken from the request as they are. Requests signed more than
+// slackRequestMaxAge ago are turned down too, so they cannot be replayed.
+func (h *Handlers) verifySlack(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, slackRequestSizeLimit))
+		if err != nil {
+			h.logger.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = verifySlackSignature(h.signingSecret, r.Header, body, time.Now())
+		if err != nil {
+			h.logger.Println(err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fn(w, r)
+	}
+}
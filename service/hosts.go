@@ -0,0 +1,295 @@
+// hosts.go
+package service
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	HostActionAddCoHost       string = "addCoHost"
+	HostActionBreakGlass      string = "breakGlass"
+	HostActionCancel          string = "cancel"
+	HostActionConfigure       string = "configure"
+	HostActionExclude         string = "exclude"
+	HostActionExport          string = "export"
+	HostActionImport          string = "import"
+	HostActionInvite          string = "invite"
+	HostActionModerate        string = "moderate"
+	HostActionRandomize       string = "randomize"
+	HostActionRemoveCoHost    string = "removeCoHost"
+	HostActionReset           string = "reset"
+	HostActionReveal          string = "reveal"
+	HostActionTransfer        string = "transfer"
+	HostActionUpdateReminders string = "updateReminders"
+	HostActionViewAudit       string = "viewAudit"
+	HostActionViewPairs       string = "viewPairs"
+	HostActionViewStatus      string = "viewStatus"
+)
+
+// hostActions describes what each host action does, for error messages,
+// and whether only the owner of the event may perform it.
+var hostActions = map[string]struct {
+	description string
+	ownerOnly   bool
+}{
+	HostActionAddCoHost:       {"add co-hosts", false},
+	HostActionBreakGlass:      {"look at its pairs before reveal day", true},
+	HostActionCancel:          {"cancel it", true},
+	HostActionReset:           {"reset its matches", false},
+	HostActionReveal:          {"reveal its pairs", false},
+	HostActionConfigure:       {"change its settings", false},
+	HostActionExclude:         {"manage its exclusions", false},
+	HostActionExport:          {"export its participants", true},
+	HostActionImport:          {"import participants", false},
+	HostActionInvite:          {"invite the channel", false},
+	HostActionModerate:        {"moderate its messages", false},
+	HostActionRandomize:       {"randomize pairs", false},
+	HostActionRemoveCoHost:    {"remove co-hosts", true},
+	HostActionTransfer:        {"transfer it", true},
+	HostActionUpdateReminders: {"configure reminders", false},
+	HostActionViewAudit:       {"view its audit log", false},
+	HostActionViewPairs:       {"view its pairs", false},
+	HostActionViewStatus:      {"view its status", false},
+}
+
+const hostsUsage string = "Usage: /santa hosts | /santa cohost add|remove @user | /santa transfer @user | /santa audit"
+
+var userMentionRegexp = regexp.MustCompile(`^<@([A-Z0-9]+)(\|[^>]*)?>$`)
+
+// authorizeHost is the single place deciding whether a user may manage an
+// event: the owner may do everything, co-hosts everything but changing
+// who is in charge.
+func authorizeHost(e *Event, uid string, action string) error {
+	a, ok := hostActions[action]
+	if !ok {
+		return errors.New("unknown host action " + action)
+	}
+
+	if uid != "" && uid == e.OwnerId {
+		return nil
+	}
+	if !a.ownerOnly && isCoHost(e, uid) {
+		return nil
+	}
+
+	if a.ownerOnly {
+		return forbiddenError("You are not the owner of this secret santa party, hence cannot " + a.description)
+	}
+	return forbiddenError("You are not a host of this secret santa party, hence cannot " + a.description)
+}
+
+func isCoHost(e *Event, uid string) bool {
+	for _, id := range e.CoHostIds {
+		if id == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutUser(ids []string, uid string) []string {
+	var rest []string
+	for _, id := range ids {
+		if id != uid {
+			rest = append(rest, id)
+		}
+	}
+	return rest
+}
+
+func parseUserMention(s string) (string, error) {
+	m := userMentionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return "", errors.New("Please mention the user, e.g. @jane")
+	}
+	return m[1], nil
+}
+
+func (h *Handlers) hostsCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	pCount, err := h.repo.CountAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	msg := eventTitle(e) + " is hosted by <@" + e.OwnerId + ">"
+	if _, err := h.repo.GetParticipantById(r.Context(), e.Id, e.OwnerId); err != nil {
+		msg += " (organizing only)"
+	}
+	if len(e.CoHostIds) > 0 {
+		var cohosts []string
+		for _, id := range e.CoHostIds {
+			cohosts = append(cohosts, "<@"+id+">")
+		}
+		msg += " with co-hosts " + strings.Join(cohosts, ", ")
+	}
+	msg += ". " + strconv.FormatInt(pCount, 10) + " people take part in the exchange."
+	writeSlackMessage(w, ResponseTypeEphemeral, msg)
+}
+
+func (h *Handlers) cohostCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) != 2 {
+		writeSlackMessage(w, ResponseTypeEphemeral, hostsUsage)
+		return
+	}
+
+	uid, err := parseUserMention(args[1])
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	var action, msg string
+	switch strings.ToLower(args[0]) {
+	case "add":
+		action = HostActionAddCoHost
+		err = authorizeHost(e, req.UserId, action)
+		if err == nil && (uid == e.OwnerId || isCoHost(e, uid)) {
+			err = errors.New("<@" + uid + "> is already a host of this secret santa party")
+		}
+		if err == nil {
+			e.CoHostIds = append(e.CoHostIds, uid)
+		}
+		msg = "<@" + req.UserId + "> made <@" + uid + "> a co-host of " + eventTitle(e)
+	case "remove":
+		action = HostActionRemoveCoHost
+		err = authorizeHost(e, req.UserId, action)
+		if err == nil && !isCoHost(e, uid) {
+			err = errors.New("<@" + uid + "> is not a co-host of this secret santa party")
+		}
+		if err == nil {
+			e.CoHostIds = withoutUser(e.CoHostIds, uid)
+		}
+		msg = "<@" + req.UserId + "> removed <@" + uid + "> from the co-hosts of " + eventTitle(e)
+	default:
+		writeSlackMessage(w, ResponseTypeEphemeral, hostsUsage)
+		return
+	}
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = h.repo.SaveEvent(r.Context(), e)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, action, uid, "")
+
+	writeSlackMessage(w, ResponseTypeInChannel, msg)
+}
+
+func (h *Handlers) transferCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) != 1 {
+		writeSlackMessage(w, ResponseTypeEphemeral, hostsUsage)
+		return
+	}
+
+	uid, err := parseUserMention(args[0])
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionTransfer)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if uid == e.OwnerId {
+		writeSlackMessage(w, ResponseTypeEphemeral, "<@"+uid+"> already owns this secret santa party")
+		return
+	}
+
+	// The new owner no longer needs to be a co-host.
+	e.CoHostIds = withoutUser(e.CoHostIds, uid)
+	e.OwnerId = uid
+
+	err = h.repo.SaveEvent(r.Context(), e)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionTransfer, uid, "")
+
+	writeSlackMessage(w, ResponseTypeInChannel, "<@"+req.UserId+"> handed "+eventTitle(e)+" over to <@"+uid+">")
+}
+
+func (h *Handlers) auditCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionViewAudit)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	entries, err := h.repo.GetAuditEntries(r.Context(), e.Id, auditPageSize)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	lines := []string{eventTitle(e) + " audit log:"}
+	for _, entry := range entries {
+		actor := "<@" + entry.ActorId + ">"
+		if entry.ActorId == OperatorId {
+			actor = "an operator"
+		}
+		line := entry.At.Format("2006-01-02 15:04") + " " + actor + " " + entry.Action
+		if entry.TargetId != "" {
+			line += " <@" + entry.TargetId + ">"
+		}
+		if entry.Details != "" {
+			line += " (" + entry.Details + ")"
+		}
+		lines = append(lines, line)
+	}
+	if len(entries) == 0 {
+		lines = append(lines, "Nothing has been recorded yet.")
+	}
+	writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+}
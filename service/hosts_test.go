@@ -0,0 +1,67 @@
+// hosts_test.go
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthorizeHost(t *testing.T) {
+	e := &Event{OwnerId: "UOWNER", CoHostIds: []string{"UCOHOST"}}
+
+	tests := []struct {
+		name    string
+		uid     string
+		action  string
+		wantErr bool
+	}{
+		{"owner", "UOWNER", HostActionTransfer, false},
+		{"co-host", "UCOHOST", HostActionRandomize, false},
+		{"co-host owner only", "UCOHOST", HostActionRemoveCoHost, true},
+		{"participant", "UOTHER", HostActionConfigure, true},
+		{"nobody", "", HostActionConfigure, true},
+		{"unknown action", "UOWNER", "launch", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeHost(e, tt.uid, tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("authorizeHost(%s, %s) error = %v, wantErr %v", tt.uid, tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseUserMention(t *testing.T) {
+	tests := []struct {
+		mention string
+		want    string
+		wantErr bool
+	}{
+		{"<@U123ABC>", "U123ABC", false},
+		{"<@U123ABC|jane>", "U123ABC", false},
+		{"@jane", "", true},
+		{"<@u123>", "", true},
+		{"<@U123> <@U456>", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mention, func(t *testing.T) {
+			got, err := parseUserMention(tt.mention)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUserMention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseUserMention() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutUser(t *testing.T) {
+	got := withoutUser([]string{"U1", "U2", "U1", "U3"}, "U1")
+	if want := []string{"U2", "U3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutUser() = %v, want %v", got, want)
+	}
+}
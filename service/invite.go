@@ -0,0 +1,303 @@
+// invite.go
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	inviteActionDecline string = "invite_decline"
+	inviteActionJoin    string = "invite_join"
+	enrollViewCallback  string = "enroll"
+	enrollAddressBlock  string = "address"
+)
+
+// checkEnrollmentOpen returns an error if enrollment in the event closed
+// before t.
+func checkEnrollmentOpen(e *Event, t time.Time) error {
+	if e.Reminders.EnrollmentClosesAt != nil && !t.Before(e.Reminders.EnrollmentClosesAt.AddDate(0, 0, 1)) {
+		return conflictError("Enrollment in " + eventTitle(e) + " closed on " + e.Reminders.EnrollmentClosesAt.Format(dateLayout))
+	}
+	return nil
+}
+
+func containsUser(ids []string, uid string) bool {
+	for _, id := range ids {
+		if id == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func inviteBlocks(e *Event, hostId string) []SlackBlock {
+	text := "<@" + hostId + "> invites you to *" + eventTitle(e) + "*! Everybody buys a gift for somebody else in the channel without them knowing who it is from." + eventDetails(e)
+	return []SlackBlock{
+		markdownSection(text),
+		{Type: "actions", Elements: []interface{}{
+			SlackElement{
+				ActionId: inviteActionJoin,
+				Style:    "primary",
+				Text:     &SlackText{Type: "plain_text", Text: "Join"},
+				Type:     "button",
+				Value:    e.Id,
+			},
+			SlackElement{
+				ActionId: inviteActionDecline,
+				Text:     &SlackText{Type: "plain_text", Text: "No, thanks"},
+				Type:     "button",
+				Value:    e.Id,
+			},
+		}},
+	}
+}
+
+// inviteCommand DMs every member of the channel who has neither enrolled
+// nor opted out an invitation with buttons to join or decline.
+func (h *Handlers) inviteCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionInvite)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = checkEnrollmentOpen(e, time.Now())
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	members, err := GetChannelMembers(h.botToken, *req.ChannelId)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	participants, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	enrolled := make(map[string]bool)
+	for _, p := range participants {
+		enrolled[p.UserId] = true
+	}
+
+	var invited []string
+	failed := 0
+	blocks := inviteBlocks(e, req.UserId)
+	for _, uid := range members {
+		if uid == req.UserId || enrolled[uid] || containsUser(e.OptedOutIds, uid) {
+			continue
+		}
+
+		// Bots are members of channels too, DMs to them fail.
+		_, err = PostSlackBlocks(h.botToken, uid, "You are invited to "+eventTitle(e), blocks)
+		if err != nil {
+			h.logger.Println(err)
+			failed++
+			continue
+		}
+		invited = append(invited, uid)
+	}
+
+	e, err = h.updateEvent(r.Context(), e.Id, func(e *Event) error {
+		for _, uid := range invited {
+			if !containsUser(e.InvitedIds, uid) {
+				e.InvitedIds = append(e.InvitedIds, uid)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionInvite, "", strconv.Itoa(len(invited))+" invited")
+
+	joined := 0
+	for _, uid := range e.InvitedIds {
+		if enrolled[uid] {
+			joined++
+		}
+	}
+
+	msg := "Invited " + strconv.Itoa(len(invited)) + " channel members to " + eventTitle(e) + "."
+	if failed > 0 {
+		msg += " " + strconv.Itoa(failed) + " could not be reached."
+	}
+	msg += " So far " + strconv.Itoa(joined) + " of the " + strconv.Itoa(len(e.InvitedIds)) + " invited have joined and " + strconv.Itoa(len(e.OptedOutIds)) + " have opted out."
+	writeSlackMessage(w, ResponseTypeEphemeral, msg)
+}
+
+// InteractionsHandler receives the button clicks and modal submissions of
+// the invitations.
+func (h *Handlers) InteractionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var in SlackInteraction
+	err = json.Unmarshal([]byte(r.PostForm.Get("payload")), &in)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch in.Type {
+	case "block_actions":
+		for _, action := range in.Actions {
+			switch action.ActionId {
+			case inviteActionJoin:
+				h.openEnrollView(r, &in, action.Value)
+			case inviteActionDecline:
+				h.declineInvite(r, &in, action.Value)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	case "view_submission":
+		if in.View.CallbackId != enrollViewCallback {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		h.submitEnrollView(w, r, &in)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *Handlers) openEnrollView(r *http.Request, in *SlackInteraction, eventId string) {
+	e, err := h.repo.GetEvent(r.Context(), eventId)
+	if err != nil {
+		h.logger.Println(err)
+		return
+	}
+
+	view := &SlackView{
+		Blocks: []SlackBlock{
+			{
+				BlockId: enrollAddressBlock,
+				Element: &SlackElement{ActionId: enrollAddressBlock, Multiline: true, Type: "plain_text_input"},
+				Label:   &SlackText{Type: "plain_text", Text: "Postal address for your gift"},
+				Type:    "input",
+			},
+		},
+		CallbackId:      enrollViewCallback,
+		PrivateMetadata: e.Id,
+		Submit:          &SlackText{Type: "plain_text", Text: "Join"},
+		Title:           &SlackText{Type: "plain_text", Text: "Secret Santa"},
+		Type:            "modal",
+	}
+	err = OpenSlackView(h.botToken, in.TriggerId, view)
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+func (h *Handlers) declineInvite(r *http.Request, in *SlackInteraction, eventId string) {
+	e, err := h.updateEvent(r.Context(), eventId, func(e *Event) error {
+		if !containsUser(e.OptedOutIds, in.User.Id) {
+			e.OptedOutIds = append(e.OptedOutIds, in.User.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Println(err)
+		return
+	}
+
+	err = UpdateSlackMessage(h.botToken, in.Container.ChannelId, in.Container.MessageTs, "No problem, you will not be invited to "+eventTitle(e)+" again.")
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// submitEnrollView enrolls the user with the address from the modal.
+// Errors are shown in the modal, which stays open.
+func (h *Handlers) submitEnrollView(w http.ResponseWriter, r *http.Request, in *SlackInteraction) {
+	fail := func(err error) {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"response_action": "errors",
+			"errors":          map[string]string{enrollAddressBlock: err.Error()},
+		})
+	}
+
+	address := strings.TrimSpace(in.View.State.Values[enrollAddressBlock][enrollAddressBlock].Value)
+	if len(address) < 5 {
+		fail(errors.New("Please provide a valid postal address"))
+		return
+	}
+
+	e, err := h.repo.GetEvent(r.Context(), in.View.PrivateMetadata)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !isActiveEvent(e) {
+		fail(errors.New(eventTitle(e) + " is no longer open"))
+		return
+	}
+	err = checkEnrollmentOpen(e, time.Now())
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var enterpriseId *string
+	if in.Enterprise != nil {
+		enterpriseId = String(in.Enterprise.Id)
+	}
+	p := &Participant{
+		Address:      String(address),
+		ChannelId:    e.ChannelId,
+		EnterpriseId: enterpriseId,
+		TeamId:       String(in.Team.Id),
+		UserId:       in.User.Id,
+		UserName:     in.User.Username,
+	}
+	err = h.repo.RegisterParticipant(r.Context(), e.Id, p)
+	if err != nil {
+		fail(errors.New("You could not be enrolled, maybe you already are"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	channelId := ""
+	if e.ChannelId != nil {
+		channelId = *e.ChannelId
+	}
+	_, err = PostSlackMessage(h.botToken, channelId, "<@"+p.UserId+"> just enrolled in "+eventTitle(e)+" for the Slack channel <#"+channelId+">")
+	if err != nil {
+		h.logger.Println(err)
+	}
+
+	err = h.notifier.Notify(r.Context(), enrollmentNotice(e, p))
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
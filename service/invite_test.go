@@ -0,0 +1,52 @@
+// invite_test.go
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckEnrollmentOpen(t *testing.T) {
+	closes := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		closes  *time.Time
+		at      time.Time
+		wantErr bool
+	}{
+		{"no closing date", nil, closes.AddDate(1, 0, 0), false},
+		{"before", &closes, closes.AddDate(0, 0, -1), false},
+		{"on the closing day", &closes, closes.Add(23 * time.Hour), false},
+		{"the day after", &closes, closes.AddDate(0, 0, 1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Reminders: Reminders{EnrollmentClosesAt: tt.closes}}
+			err := checkEnrollmentOpen(e, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkEnrollmentOpen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInviteBlocks(t *testing.T) {
+	e := &Event{Id: "E1", Year: 2026}
+	blocks := inviteBlocks(e, "UHOST")
+	if len(blocks) != 2 || blocks[1].Type != "actions" {
+		t.Fatalf("inviteBlocks() = %+v, want a section and actions", blocks)
+	}
+
+	want := []string{inviteActionJoin, inviteActionDecline}
+	if len(blocks[1].Elements) != len(want) {
+		t.Fatalf("inviteBlocks() has %d buttons, want %d", len(blocks[1].Elements), len(want))
+	}
+	for i, element := range blocks[1].Elements {
+		button, ok := element.(SlackElement)
+		if !ok || button.ActionId != want[i] || button.Value != e.Id {
+			t.Errorf("button %d = %+v, want %s for %s", i, element, want[i], e.Id)
+		}
+	}
+}
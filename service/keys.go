@@ -0,0 +1,168 @@
+// keys.go
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// AssignmentKeys keeps assignments host-blind: the giftees of each
+// participant are encrypted with a key derived from a master key, which
+// only the service knows, for that participant alone. Neither hosts nor
+// anybody browsing the database can read who gives to whom.
+type AssignmentKeys struct {
+	master []byte
+}
+
+// NewAssignmentKeys returns the keys derived from the base64 encoded
+// master key, or nil if no master key is configured, in which case
+// assignments are stored in the clear.
+func NewAssignmentKeys(master string) (*AssignmentKeys, error) {
+	if master == "" {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(master)
+	if err != nil {
+		return nil, errors.New("the assignment master key is not base64 encoded: " + err.Error())
+	}
+	if len(b) < 32 {
+		return nil, errors.New("the assignment master key must be at least 32 bytes long")
+	}
+
+	return &AssignmentKeys{master: b}, nil
+}
+
+// NewThreadKey decodes the base64 encoded key message threads are named
+// with when there is no assignment master key, or returns nil if none is
+// configured.
+func NewThreadKey(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("the thread key is not base64 encoded: " + err.Error())
+	}
+	if len(b) < 32 {
+		return nil, errors.New("the thread key must be at least 32 bytes long")
+	}
+	return b, nil
+}
+
+func (k *AssignmentKeys) derive(purpose string, eventId string, uid string) []byte {
+	mac := hmac.New(sha256.New, k.master)
+	mac.Write([]byte(purpose + "\x00" + eventId + "\x00" + uid))
+	return mac.Sum(nil)
+}
+
+// seal encrypts data with the key of the given purpose, event and user.
+func (k *AssignmentKeys) seal(purpose string, eventId string, uid string, data []byte) (string, error) {
+	block, err := aes.NewCipher(k.derive(purpose, eventId, uid))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, data, []byte(eventId+"/"+uid))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *AssignmentKeys) open(purpose string, eventId string, uid string, sealed string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k.derive(purpose, eventId, uid))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], []byte(eventId+"/"+uid))
+}
+
+// sealMatches encrypts the giftees of a participant for them alone.
+func (k *AssignmentKeys) sealMatches(eventId string, uid string, matches []Match) (string, error) {
+	data, err := json.Marshal(matches)
+	if err != nil {
+		return "", err
+	}
+	return k.seal("matches", eventId, uid, data)
+}
+
+// openMatches fills in the match fields of a participant from their
+// sealed giftees. Participants without sealed giftees are left alone.
+func (k *AssignmentKeys) openMatches(eventId string, p *Participant) error {
+	if k == nil || p.SealedMatches == "" {
+		return nil
+	}
+
+	data, err := k.open("matches", eventId, p.UserId, p.SealedMatches)
+	if err != nil {
+		return err
+	}
+
+	var matches []Match
+	err = json.Unmarshal(data, &matches)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	p.YourMatches = matches
+	p.YourMatchAddress = matches[0].Address
+	p.YourMatchId = String(matches[0].UserId)
+	p.YourMatchName = String(matches[0].Name)
+	return nil
+}
+
+// sealSeed encrypts the seed of a draw until reveal day, as the seed is
+// all it takes to work out the pairs.
+func (k *AssignmentKeys) sealSeed(eventId string, seed string) (string, error) {
+	return k.seal("seed", eventId, "", []byte(seed))
+}
+
+func (k *AssignmentKeys) openSeed(eventId string, sealed string) (string, error) {
+	data, err := k.open("seed", eventId, "", sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// santaTag lets the service find the santas of a giftee without storing
+// who they are: santas are stored with the tags of their giftees, which
+// cannot be computed without the master key. It is empty without keys.
+func (k *AssignmentKeys) santaTag(eventId string, gifteeId string) string {
+	if k == nil {
+		return ""
+	}
+	return hex.EncodeToString(k.derive("santa", eventId, gifteeId))
+}
@@ -0,0 +1,117 @@
+// keys_test.go
+package service
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testAssignmentKeys(t *testing.T, fill byte) *AssignmentKeys {
+	k, err := NewAssignmentKeys(base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestNewAssignmentKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		master  string
+		wantNil bool
+		wantErr bool
+	}{
+		{"not configured", "", true, false},
+		{"not base64", "not a key!", true, true},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), true, true},
+		{"valid", base64.StdEncoding.EncodeToString(make([]byte, 32)), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewAssignmentKeys(tt.master)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAssignmentKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (k == nil) != tt.wantNil {
+				t.Errorf("NewAssignmentKeys() = %v, want nil %v", k, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestSealMatches(t *testing.T) {
+	k := testAssignmentKeys(t, 'a')
+	matches := []Match{{Address: optionalString("1 Main St"), Name: "Jane", UserId: "U2"}, {Name: "Joe", UserId: "U3"}}
+
+	sealed, err := k.sealMatches("E1", "U1", matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := base64.StdEncoding.DecodeString(sealed); strings.Contains(string(b), "U2") {
+		t.Fatalf("sealed matches %q give away the giftee", sealed)
+	}
+
+	p := &Participant{UserId: "U1", SealedMatches: sealed}
+	if err := k.openMatches("E1", p); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.YourMatches, matches) || p.YourMatchId == nil || *p.YourMatchId != "U2" {
+		t.Errorf("openMatches() = %+v, want %+v", p.YourMatches, matches)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	tests := []struct {
+		name    string
+		keys    *AssignmentKeys
+		eventId string
+		p       Participant
+	}{
+		{"other participant", k, "E1", Participant{UserId: "U9", SealedMatches: sealed}},
+		{"other event", k, "E2", Participant{UserId: "U1", SealedMatches: sealed}},
+		{"other master key", testAssignmentKeys(t, 'b'), "E1", Participant{UserId: "U1", SealedMatches: sealed}},
+		{"tampered", k, "E1", Participant{UserId: "U1", SealedMatches: string(tampered)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.keys.openMatches(tt.eventId, &tt.p); err == nil {
+				t.Errorf("openMatches() opened %+v", tt.p.YourMatches)
+			}
+		})
+	}
+}
+
+func TestSealSeed(t *testing.T) {
+	k := testAssignmentKeys(t, 'a')
+	sealed, err := k.sealSeed("E1", "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed, err := k.openSeed("E1", sealed)
+	if err != nil || seed != "seed" {
+		t.Errorf("openSeed() = %q, %v, want seed", seed, err)
+	}
+	if _, err := k.openSeed("E2", sealed); err == nil {
+		t.Error("openSeed() opened the seed of another event")
+	}
+}
+
+func TestSantaTag(t *testing.T) {
+	var none *AssignmentKeys
+	if got := none.santaTag("E1", "U1"); got != "" {
+		t.Errorf("santaTag() without keys = %q, want empty", got)
+	}
+
+	k := testAssignmentKeys(t, 'a')
+	tag := k.santaTag("E1", "U1")
+	if tag != k.santaTag("E1", "U1") {
+		t.Error("santaTag() is not stable")
+	}
+	if tag == k.santaTag("E1", "U2") || tag == k.santaTag("E2", "U1") || tag == testAssignmentKeys(t, 'b').santaTag("E1", "U1") {
+		t.Error("santaTag() is the same for another giftee, event or master key")
+	}
+}
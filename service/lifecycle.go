@@ -0,0 +1,278 @@
+// lifecycle.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	confirmationTimeout time.Duration = 5 * time.Minute
+	eventLease          time.Duration = 5 * time.Minute
+	eventUpdateRetries  int           = 3
+)
+
+const lifecycleUsage string = "Usage: /santa cancel [confirm <code>] | /santa reset [confirm <code>]"
+
+var errEventBusy = conflictError("Another command is changing this event right now, please try again in a moment")
+
+// updateEvent applies fn to the latest stored version of the event and
+// saves it, starting over if someone else saved the event in between.
+func (s *SecretSanta) updateEvent(ctx context.Context, id string, fn func(e *Event) error) (*Event, error) {
+	for i := 0; ; i++ {
+		e, err := s.repo.GetEvent(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		err = fn(e)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.repo.SaveEvent(ctx, e)
+		if err == ErrConcurrentUpdate && i < eventUpdateRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+}
+
+// lockEvent keeps other commands from changing the participants of the
+// event, e.g. randomizing while matches are being reset. The lock expires
+// by itself in case its holder dies before calling unlockEvent.
+func (s *SecretSanta) lockEvent(ctx context.Context, id string, fn func(e *Event) error) (*Event, error) {
+	return s.updateEvent(ctx, id, func(e *Event) error {
+		if e.LockedUntil.After(time.Now()) {
+			return errEventBusy
+		}
+		if fn != nil {
+			err := fn(e)
+			if err != nil {
+				return err
+			}
+		}
+		e.LockedUntil = time.Now().Add(eventLease)
+		return nil
+	})
+}
+
+func (s *SecretSanta) unlockEvent(ctx context.Context, id string, fn func(e *Event) error) (*Event, error) {
+	e, err := s.updateEvent(ctx, id, func(e *Event) error {
+		if fn != nil {
+			err := fn(e)
+			if err != nil {
+				return err
+			}
+		}
+		e.LockedUntil = time.Time{}
+		return nil
+	})
+	if err != nil {
+		s.logger.Println(err)
+	}
+	return e, err
+}
+
+// randomCode returns a code that is easy to type, e.g. for confirmations.
+func randomCode(length int) (string, error) {
+	const letters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = letters[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// confirmAction implements the two steps of destructive commands: without
+// a code it stores a new confirmation code on the event and returns it,
+// with a code it checks the code and returns an empty string.
+func (h *Handlers) confirmAction(ctx context.Context, e *Event, uid string, action string, args []string) (string, error) {
+	if len(args) == 0 {
+		code, err := randomCode(4)
+		if err != nil {
+			return "", err
+		}
+		_, err = h.updateEvent(ctx, e.Id, func(e *Event) error {
+			e.Pending = &Confirmation{
+				Action:    action,
+				Code:      code,
+				ExpiresAt: time.Now().Add(confirmationTimeout),
+				UserId:    uid,
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return code, nil
+	}
+
+	if len(args) != 2 || strings.ToLower(args[0]) != "confirm" {
+		return "", invalidError(lifecycleUsage)
+	}
+
+	_, err := h.updateEvent(ctx, e.Id, func(e *Event) error {
+		err := checkConfirmation(e.Pending, uid, action, args[1], time.Now())
+		if err != nil {
+			return err
+		}
+		e.Pending = nil
+		return nil
+	})
+	return "", err
+}
+
+// checkConfirmation checks a code sent back by the user against the
+// pending confirmation of the event.
+func checkConfirmation(c *Confirmation, uid string, action string, code string, now time.Time) error {
+	if c == nil || c.Action != action || c.UserId != uid || !strings.EqualFold(c.Code, code) {
+		return invalidError("This confirmation code is not valid, please run the command again without it to get a new one")
+	}
+	if now.After(c.ExpiresAt) {
+		return invalidError("This confirmation code has expired, please run the command again without it to get a new one")
+	}
+	return nil
+}
+
+// cancelEvent cancels the event for good on behalf of the actor, drops
+// its pending reminders and sends its participants the text.
+func (s *SecretSanta) cancelEvent(ctx context.Context, e *Event, actorId string, details string, text string) (*Event, error) {
+	e, err := s.lockEvent(ctx, e.Id, func(e *Event) error {
+		if e.Status == EventStatusCancelled {
+			return conflictError(eventTitle(e) + " has already been cancelled")
+		}
+		e.Status = EventStatusCancelled
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlockEvent(ctx, e.Id, nil)
+
+	s.audit(ctx, e, actorId, HostActionCancel, "", details)
+
+	for _, kind := range []string{JobKindEnrollmentReminder, JobKindGiftReminder, JobKindRevealReminder} {
+		err = s.repo.CancelPendingJobs(ctx, e.Id, kind)
+		if err != nil {
+			s.logger.Println(err)
+		}
+	}
+
+	participants, err := s.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		s.logger.Println(err)
+	}
+	for _, participant := range participants {
+		err = s.notifier.Notify(ctx, cancellationNotice(e, &participant, text))
+		if err != nil {
+			s.logger.Println(err)
+		}
+	}
+
+	return e, nil
+}
+
+func (h *Handlers) cancelCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionCancel)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	code, err := h.confirmAction(r.Context(), e, req.UserId, HostActionCancel, args)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if code != "" {
+		writeSlackMessage(w, ResponseTypeEphemeral, "This cancels "+eventTitle(e)+" for good and lets all participants know. To go ahead, type `/santa cancel confirm "+code+"` within 5 minutes.")
+		return
+	}
+
+	msg := eventTitle(e) + " has been cancelled by <@" + req.UserId + ">. Sorry, there will be no gift exchange this time."
+	e, err = h.cancelEvent(r.Context(), e, req.UserId, "", msg)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeInChannel, "<@"+req.UserId+"> cancelled "+eventTitle(e))
+}
+
+func (h *Handlers) resetCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionReset)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	code, err := h.confirmAction(r.Context(), e, req.UserId, HostActionReset, args)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if code != "" {
+		writeSlackMessage(w, ResponseTypeEphemeral, "This throws away all matches of "+eventTitle(e)+" and reopens enrollment. To go ahead, type `/santa reset confirm "+code+"` within 5 minutes.")
+		return
+	}
+
+	e, err = h.lockEvent(r.Context(), e.Id, nil)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = h.repo.ResetMatches(r.Context(), e.Id, nil)
+	if err != nil {
+		h.unlockEvent(r.Context(), e.Id, nil)
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	e, err = h.unlockEvent(r.Context(), e.Id, func(e *Event) error {
+		e.Draw = nil
+		e.Status = EventStatusOpen
+		return nil
+	})
+	if err != nil {
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionReset, "", "")
+
+	writeSlackMessage(w, ResponseTypeInChannel, "<!channel> <@"+req.UserId+"> reset the matches of "+eventTitle(e)+". Enrollment is open again and pairs will be randomized anew.")
+}
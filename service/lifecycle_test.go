@@ -0,0 +1,60 @@
+// lifecycle_test.go
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRandomCode(t *testing.T) {
+	for _, length := range []int{4, 6, 12} {
+		code, err := randomCode(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != length || strings.ContainsAny(code, "01IO") || strings.ToUpper(code) != code {
+			t.Errorf("randomCode(%d) = %q", length, code)
+		}
+	}
+}
+
+func TestCheckConfirmation(t *testing.T) {
+	now := time.Now()
+	pending := &Confirmation{
+		Action:    HostActionReset,
+		Code:      "K7QX",
+		ExpiresAt: now.Add(confirmationTimeout),
+		UserId:    "U1",
+	}
+
+	tests := []struct {
+		name    string
+		c       *Confirmation
+		uid     string
+		action  string
+		code    string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", pending, "U1", HostActionReset, "K7QX", now, false},
+		{"lower case", pending, "U1", HostActionReset, "k7qx", now, false},
+		{"nothing pending", nil, "U1", HostActionReset, "K7QX", now, true},
+		{"wrong code", pending, "U1", HostActionReset, "K7QY", now, true},
+		{"other user", pending, "U2", HostActionReset, "K7QX", now, true},
+		{"other action", pending, "U1", HostActionCancel, "K7QX", now, true},
+		{"expired", pending, "U1", HostActionReset, "K7QX", now.Add(confirmationTimeout + time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConfirmation(tt.c, tt.uid, tt.action, tt.code, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkConfirmation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && ErrorKind(err) != ErrorKindInvalid {
+				t.Errorf("checkConfirmation() error kind = %q, want %q", ErrorKind(err), ErrorKindInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// matcher.go
+package service
+
+import (
+	"strconv"
+)
+
+// matchAttempts bounds how often the matcher draws anew when exclusions
+// rule out a draw.
+const matchAttempts int = 1000
+
+// shuffler is the randomness the matcher draws with. *rand.Rand is one,
+// and drawSource is one whose draws can be repeated anywhere.
+type shuffler interface {
+	Perm(n int) []int
+	Shuffle(n int, swap func(i, j int))
+}
+
+// matchParticipants assigns each of the given users k giftees, so that
+// everybody also has k santas, nobody gives to themselves or twice to the
+// same person, and no excluded pair is matched.
+//
+// The users are put in a random circle and each gives to the users at k
+// distinct distances ahead of them. With k = 1 and a distance of 1 this is
+// the classic single chain. Draws that match an excluded pair are thrown
+// away and drawn again.
+func matchParticipants(rnd shuffler, uids []string, k int, excluded func(santa string, giftee string) bool) (map[string][]string, error) {
+	n := len(uids)
+	if k < 1 {
+		k = 1
+	}
+	if n < k+1 {
+		return nil, conflictError("Everybody giving " + strconv.Itoa(k) + " gifts needs at least " + strconv.Itoa(k+1) + " participants")
+	}
+
+	circle := make([]string, n)
+	for attempt := 0; attempt < matchAttempts; attempt++ {
+		copy(circle, uids)
+		rnd.Shuffle(n, func(i, j int) { circle[i], circle[j] = circle[j], circle[i] })
+
+		// Without exclusions the first draw always works, so keep the
+		// familiar single chain for it.
+		var distances []int
+		if attempt == 0 {
+			for d := 1; d <= k; d++ {
+				distances = append(distances, d)
+			}
+		} else {
+			distances = rnd.Perm(n - 1)[:k]
+			for i := range distances {
+				distances[i]++
+			}
+		}
+
+		matches := make(map[string][]string)
+		ok := true
+		for i := 0; i < n && ok; i++ {
+			for _, d := range distances {
+				santa, giftee := circle[i], circle[(i+d)%n]
+				if excluded != nil && excluded(santa, giftee) {
+					ok = false
+					break
+				}
+				matches[santa] = append(matches[santa], giftee)
+			}
+		}
+		if ok {
+			return matches, nil
+		}
+	}
+
+	return nil, conflictError("No draw could be found that respects all exclusions, please remove some with /santa exclude remove")
+}
+
+// giftees returns everybody the participant gives a gift to. Matches made
+// before participants could have several giftees only fill in the single
+// match fields.
+func giftees(p *Participant) []Match {
+	if len(p.YourMatches) > 0 {
+		return p.YourMatches
+	}
+	if p.YourMatchId == nil {
+		return nil
+	}
+	name := ""
+	if p.YourMatchName != nil {
+		name = *p.YourMatchName
+	}
+	return []Match{{Address: p.YourMatchAddress, Name: name, UserId: *p.YourMatchId}}
+}
+
+// assignmentMessage tells a santa who their giftees are, where to send
+// the gifts and what they wish for.
+func assignmentMessage(e *Event, p *Participant, wishlists map[string]*Wishlist) string {
+	matches := giftees(p)
+	if len(matches) == 1 {
+		m := matches[0]
+		address := ""
+		if m.Address != nil {
+			address = *m.Address
+		}
+		return "Your match is <@" + m.UserId + ">. Prepare your gift and send it to " + address + ". Thank you and happy New Year!" + eventDetails(e) + wishlistDetails(wishlists[m.UserId])
+	}
+
+	msg := "You give a gift to each of your " + strconv.Itoa(len(matches)) + " matches:"
+	for _, m := range matches {
+		address := ""
+		if m.Address != nil {
+			address = *m.Address
+		}
+		msg += "\n\n<@" + m.UserId + ">, send the gift to " + address + wishlistDetails(wishlists[m.UserId])
+	}
+	return msg + "\n\nThank you and happy New Year!" + eventDetails(e)
+}
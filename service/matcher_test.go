@@ -0,0 +1,102 @@
+// matcher_test.go
+package service
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMatchParticipants(t *testing.T) {
+	users := func(n int) []string {
+		var uids []string
+		for i := 1; i <= n; i++ {
+			uids = append(uids, "U"+strconv.Itoa(i))
+		}
+		return uids
+	}
+	e := &Event{Exclusions: []Exclusion{{FirstId: "U1", SecondId: "U2"}}}
+
+	tests := []struct {
+		name     string
+		n        int
+		k        int
+		excluded func(string, string) bool
+		wantErr  bool
+	}{
+		{"two", 2, 1, nil, false},
+		{"single chain", 7, 1, nil, false},
+		{"two gifts each", 5, 2, nil, false},
+		{"three gifts each", 4, 3, nil, false},
+		{"with an exclusion", 6, 2, func(a, b string) bool { return isExcluded(e, a, b) }, false},
+		{"too few for two gifts", 2, 2, nil, true},
+		{"excluded pair only", 2, 1, func(a, b string) bool { return isExcluded(e, a, b) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				uids := users(tt.n)
+				matches, err := matchParticipants(rand.New(rand.NewSource(seed)), uids, tt.k, tt.excluded)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("matchParticipants() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					if ErrorKind(err) != ErrorKindConflict {
+						t.Errorf("matchParticipants() error kind = %q, want %q", ErrorKind(err), ErrorKindConflict)
+					}
+					return
+				}
+
+				santas := make(map[string]int)
+				for _, santa := range uids {
+					seen := make(map[string]bool)
+					if len(matches[santa]) != tt.k {
+						t.Fatalf("%s gives %d gifts, want %d", santa, len(matches[santa]), tt.k)
+					}
+					for _, giftee := range matches[santa] {
+						if giftee == santa || seen[giftee] {
+							t.Fatalf("%s gives to %v", santa, matches[santa])
+						}
+						if tt.excluded != nil && tt.excluded(santa, giftee) {
+							t.Fatalf("excluded pair %s → %s matched", santa, giftee)
+						}
+						seen[giftee] = true
+						santas[giftee]++
+					}
+				}
+				for _, giftee := range uids {
+					if santas[giftee] != tt.k {
+						t.Fatalf("%s gets %d gifts, want %d", giftee, santas[giftee], tt.k)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGiftees(t *testing.T) {
+	legacy := "U2"
+	tests := []struct {
+		name string
+		p    Participant
+		want []string
+	}{
+		{"not matched", Participant{}, nil},
+		{"single match", Participant{YourMatchId: &legacy}, []string{"U2"}},
+		{"several matches", Participant{YourMatches: []Match{{UserId: "U3"}, {UserId: "U4"}}}, []string{"U3", "U4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range giftees(&tt.p) {
+				got = append(got, m.UserId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("giftees() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
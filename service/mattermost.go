@@ -0,0 +1,266 @@
+// mattermost.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MattermostClient talks to a Mattermost server: it checks that slash
+// commands come from the server, and sends messages on behalf of the bot.
+// Slash commands are sent like Slack's, but are signed with a token of
+// their own instead of a signing secret.
+type MattermostClient struct {
+	botToken      string
+	commandTokens []string
+	url           string
+
+	mu        sync.Mutex
+	botUserId string
+}
+
+// NewMattermostClient returns a client for the Mattermost server at the
+// given URL. commandTokens lists the tokens of its slash commands,
+// separated by commas. It returns nil if no command tokens are
+// configured.
+func NewMattermostClient(url string, botToken string, commandTokens string) *MattermostClient {
+	var tokens []string
+	for _, token := range strings.Split(commandTokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	return &MattermostClient{botToken: botToken, commandTokens: tokens, url: strings.TrimSuffix(url, "/")}
+}
+
+// verify checks the token of a slash command, which Mattermost sends in
+// the Authorization header as well as in the form.
+func (c *MattermostClient) verify(r *http.Request) error {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+	if token == "" {
+		token = r.PostForm.Get("token")
+	}
+	for _, t := range c.commandTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return nil
+		}
+	}
+	return errors.New("the Mattermost request has no valid command token")
+}
+
+// callMattermostApi calls the Mattermost API on behalf of the bot, and
+// decodes its response into v unless v is nil.
+func (c *MattermostClient) callMattermostApi(method string, path string, args interface{}, v interface{}) error {
+	jsonData := new(bytes.Buffer)
+	if args != nil {
+		json.NewEncoder(jsonData).Encode(args)
+	}
+	req, err := http.NewRequest(method, c.url+"/api/v4"+path, jsonData)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bearer "+c.botToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(method + " " + path + " failed: " + resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// userId returns the ID of the bot, which direct messages are sent from.
+func (c *MattermostClient) userId() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.botUserId != "" {
+		return c.botUserId, nil
+	}
+
+	var me struct {
+		Id string `json:"id"`
+	}
+	err := c.callMattermostApi(http.MethodGet, "/users/me", nil, &me)
+	if err != nil {
+		return "", err
+	}
+	c.botUserId = me.Id
+	return c.botUserId, nil
+}
+
+// sendDirect sends a direct message to a user.
+func (c *MattermostClient) sendDirect(uid string, msg string) error {
+	botId, err := c.userId()
+	if err != nil {
+		return err
+	}
+
+	var channel struct {
+		Id string `json:"id"`
+	}
+	err = c.callMattermostApi(http.MethodPost, "/channels/direct", []string{botId, uid}, &channel)
+	if err != nil {
+		return err
+	}
+	return c.callMattermostApi(http.MethodPost, "/posts", map[string]string{"channel_id": channel.Id, "message": msg}, nil)
+}
+
+// postChannel posts a message to a channel, in the thread of the given
+// post if any, and returns the ID of the new post.
+func (c *MattermostClient) postChannel(channelId string, rootId string, msg string) (string, error) {
+	var res struct {
+		Id string `json:"id"`
+	}
+	err := c.callMattermostApi(http.MethodPost, "/posts", map[string]string{"channel_id": channelId, "message": msg, "root_id": rootId}, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.Id, nil
+}
+
+// mattermostMessage writes a notice in Mattermost's Markdown. Its text is
+// written for Slack, whose mentions Mattermost does not understand, so
+// matches are written out from the giftees instead.
+func mattermostMessage(n *Notice) string {
+	if n.Kind != NoticeKindMatch {
+		return n.Text
+	}
+
+	lines := []string{"#### " + n.Subject}
+	for _, g := range n.Giftees {
+		lines = append(lines, "You give a gift to @"+g.Name+". Send it to: "+g.Address)
+		for _, wish := range g.Wishlist {
+			lines = append(lines, "- "+wish)
+		}
+	}
+	lines = append(lines, "Thank you and happy New Year!")
+	for _, detail := range n.Details {
+		lines = append(lines, "- "+detail)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MattermostNotifier sends notices to the participants of Mattermost
+// events in a direct message.
+type MattermostNotifier struct {
+	client *MattermostClient
+}
+
+func NewMattermostNotifier(client *MattermostClient) *MattermostNotifier {
+	return &MattermostNotifier{client: client}
+}
+
+func (n *MattermostNotifier) Notify(ctx context.Context, notice *Notice) error {
+	if eventPlatform(notice.Event) != PlatformMattermost {
+		return errNotReached
+	}
+	return n.client.sendDirect(notice.To.UserId, mattermostMessage(notice))
+}
+
+// MattermostPoster posts to the channels of Mattermost events.
+type MattermostPoster struct {
+	client *MattermostClient
+}
+
+func NewMattermostPoster(client *MattermostClient) *MattermostPoster {
+	return &MattermostPoster{client: client}
+}
+
+func (p *MattermostPoster) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	if eventPlatform(e) != PlatformMattermost {
+		return "", errNotPosted
+	}
+	return p.client.postChannel(value(e.ChannelId), replyTo, msg)
+}
+
+// MattermostHandler receives the Mattermost slash commands /initialize,
+// /participate, /randomize and /get, which are all pointed at it and work
+// like their Slack counterparts.
+func (h *Handlers) MattermostHandler(w http.ResponseWriter, r *http.Request) {
+	if h.mattermost == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = h.mattermost.verify(r)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Mattermost sends slash commands in the same form as Slack.
+	req := newSlackRequest(r)
+	req.Platform = PlatformMattermost
+
+	switch strings.TrimPrefix(*req.Command, "/") {
+	case "initialize":
+		e, organizerOnly, err := h.CreateEvent(r.Context(), &req.Caller, *req.Text)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		msg := "@" + req.UserName + " just initiated " + eventTitle(e) + " for the channel ~" + r.PostForm.Get("channel_name")
+		if organizerOnly {
+			msg += " and is organizing it without taking part in the exchange"
+		}
+		writeSlackMessage(w, ResponseTypeInChannel, msg+eventDetails(e))
+	case "participate":
+		e, p, err := h.Enroll(r.Context(), &req.Caller, *req.Text)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		writeSlackMessage(w, ResponseTypeInChannel, "@"+p.UserName+" just enrolled in "+eventTitle(e)+" for the channel ~"+r.PostForm.Get("channel_name"))
+	case "randomize":
+		e, err := h.Draw(r.Context(), &req.Caller, *req.Text, func(e *Event, d *Draw) {
+			err := SendSlackMessage(req.ResponseUrl, ResponseTypeInChannel, "@"+req.UserName+" is drawing the pairs of "+eventTitle(e)+". The draw's commitment is `"+d.Commitment+"`, its seed will be revealed on reveal day.")
+			if err != nil {
+				h.logger.Println(err)
+			}
+		})
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		writeSlackMessage(w, ResponseTypeInChannel, "@channel "+eventTitle(e)+" pairs have been randomized!")
+	case "get":
+		a, err := h.GetAssignment(r.Context(), &req.Caller, *req.Text)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, mattermostMessage(matchNotice(a.Event, a.Participant, a.Wishlists)))
+	default:
+		writeSlackMessage(w, ResponseTypeEphemeral, "Usage: /initialize, /participate, /randomize or /get")
+	}
+}
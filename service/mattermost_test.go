@@ -0,0 +1,77 @@
+// mattermost_test.go
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewMattermostClient(t *testing.T) {
+	if c := NewMattermostClient("https://chat.example.com", "bot", " , "); c != nil {
+		t.Errorf("NewMattermostClient() without command tokens = %+v, want nil", c)
+	}
+
+	c := NewMattermostClient("https://chat.example.com/", "bot", "one, two")
+	if c == nil || c.url != "https://chat.example.com" || len(c.commandTokens) != 2 {
+		t.Errorf("NewMattermostClient() = %+v", c)
+	}
+}
+
+func TestMattermostVerify(t *testing.T) {
+	c := NewMattermostClient("https://chat.example.com", "bot", "one,two")
+
+	tests := []struct {
+		name      string
+		header    string
+		formToken string
+		wantErr   bool
+	}{
+		{"header", "Token two", "", false},
+		{"form", "", "one", false},
+		{"unknown token", "Token three", "", true},
+		{"unknown form token", "", "three", true},
+		{"no token", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"token": {tt.formToken}}
+			r, err := http.NewRequest("POST", "/mattermost", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.verify(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMattermostMessage(t *testing.T) {
+	n := &Notice{
+		Details: []string{"Budget: 25 EUR"},
+		Giftees: []NoticeGiftee{{Address: "1 Main St", Name: "jane", Wishlist: []string{"Wishes: Books"}}},
+		Kind:    NoticeKindMatch,
+		Subject: "Your Secret Santa 2026 match",
+	}
+	want := "#### Your Secret Santa 2026 match\nYou give a gift to @jane. Send it to: 1 Main St\n- Wishes: Books\nThank you and happy New Year!\n- Budget: 25 EUR"
+	if got := mattermostMessage(n); got != want {
+		t.Errorf("mattermostMessage() = %q, want %q", got, want)
+	}
+
+	reminder := &Notice{Kind: NoticeKindReminder, Text: "Friendly reminder"}
+	if got := mattermostMessage(reminder); got != reminder.Text {
+		t.Errorf("mattermostMessage() = %q, want %q", got, reminder.Text)
+	}
+}
@@ -0,0 +1,263 @@
+// messages.go
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const messagesPageSize int64 = 30
+
+const messagesUsage string = "Usage: /santa ask [@giftee] <question for your giftee> | /santa reply [<thread ID>] <answer for your Secret Santa> | /santa messages | /santa hide <message ID>"
+
+// threadId names the conversation between a santa and their giftee
+// without giving away who they are, so hosts can moderate it. It is keyed
+// with the assignment keys or, without them, the thread key, so that it
+// cannot be worked out by trying pairs of users either.
+func (s *SecretSanta) threadId(eventId string, santaId string, gifteeId string) string {
+	var sum []byte
+	if s.keys != nil {
+		sum = s.keys.derive("thread", eventId, santaId+"/"+gifteeId)
+	} else {
+		mac := hmac.New(sha256.New, s.threadKey)
+		mac.Write([]byte("thread\x00" + eventId + "\x00" + santaId + "/" + gifteeId))
+		sum = mac.Sum(nil)
+	}
+	return "T" + strings.ToUpper(hex.EncodeToString(sum[:3]))
+}
+
+// relayMessage stores a message between a santa and their giftee and
+// delivers it to whichever of them did not write it.
+func (h *Handlers) relayMessage(r *http.Request, e *Event, santaId string, gifteeId string, fromSanta bool, text string) (*Message, error) {
+	id, err := randomCode(6)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Id:        id,
+		At:        time.Now(),
+		EventId:   e.Id,
+		FromSanta: fromSanta,
+		GifteeId:  gifteeId,
+		SantaId:   santaId,
+		Text:      text,
+		ThreadId:  h.threadId(e.Id, santaId, gifteeId),
+	}
+	// Stored messages must not give away the pairs either.
+	if h.keys != nil {
+		m.GifteeId = ""
+		m.SantaId = ""
+	}
+
+	var to, msg string
+	if fromSanta {
+		to = gifteeId
+		msg = "Your " + eventTitle(e) + " Secret Santa asks: " + text + "\nAnswer them anonymously with `/santa reply " + m.ThreadId + " <your answer>`."
+	} else {
+		to = santaId
+		msg = "Your " + eventTitle(e) + " match <@" + gifteeId + "> replies: " + text + "\nAsk them more with `/santa ask <your question>`."
+	}
+	if e.Name != "" {
+		msg = strings.Replace(msg, "`/santa reply", "`/santa event=\""+e.Name+"\" reply", 1)
+		msg = strings.Replace(msg, "`/santa ask", "`/santa event=\""+e.Name+"\" ask", 1)
+	}
+
+	res, err := PostSlackMessage(h.botToken, to, msg)
+	if err != nil {
+		return nil, err
+	}
+	m.Channel = res.Channel
+	m.Ts = res.Ts
+
+	err = h.repo.AddMessage(r.Context(), m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (h *Handlers) askCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, messagesUsage)
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	p, err := h.repo.GetParticipantById(r.Context(), e.Id, req.UserId)
+	if err == nil {
+		h.openMatches(e, p)
+	}
+	if err != nil || !p.IsMatched || len(giftees(p)) == 0 {
+		err = errors.New("You have no match in " + eventTitle(e) + " to send a question to yet")
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	m, args, err := pickGiftee(e, p, args)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, messagesUsage)
+		return
+	}
+
+	_, err = h.relayMessage(r, e, req.UserId, m.UserId, true, strings.Join(args, " "))
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, "Your question has been passed on to <@"+m.UserId+"> without revealing who you are.")
+}
+
+func (h *Handlers) replyCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, messagesUsage)
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	santas, err := h.getSantas(r.Context(), e, req.UserId)
+	if err != nil || len(santas) == 0 {
+		err = errors.New("Nobody has been matched to give you a gift in " + eventTitle(e) + " yet")
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	santa, args, err := h.pickSanta(e, santas, req.UserId, args)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, messagesUsage)
+		return
+	}
+
+	_, err = h.relayMessage(r, e, santa.UserId, req.UserId, false, strings.Join(args, " "))
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, "Your answer has been passed on to your Secret Santa.")
+}
+
+func (h *Handlers) messagesCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionModerate)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	messages, err := h.repo.GetMessages(r.Context(), e.Id, messagesPageSize)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	// Threads are listed by their ID only, so that hosts can moderate
+	// without learning who is whose santa.
+	lines := []string{eventTitle(e) + " anonymous messages, newest first:"}
+	for _, m := range messages {
+		direction := "giftee → santa"
+		if m.FromSanta {
+			direction = "santa → giftee"
+		}
+		text := m.Text
+		if m.Hidden {
+			text = "(hidden)"
+		}
+		lines = append(lines, m.At.Format("2006-01-02 15:04")+" "+m.Id+" in "+m.ThreadId+" ("+direction+"): "+text)
+	}
+	if len(messages) == 0 {
+		lines = append(lines, "No messages yet.")
+	} else {
+		lines = append(lines, "Hide a message with `/santa hide <message ID>`.")
+	}
+	writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+}
+
+func (h *Handlers) hideCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) != 1 {
+		writeSlackMessage(w, ResponseTypeEphemeral, messagesUsage)
+		return
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionModerate)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	m, err := h.repo.GetMessage(r.Context(), strings.ToUpper(args[0]))
+	if err != nil || m.EventId != e.Id {
+		err = errors.New("There is no message " + args[0] + " in " + eventTitle(e))
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = h.repo.HideMessage(r.Context(), m.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	// Take the message out of the recipient's DMs as well.
+	if m.Channel != "" && m.Ts != "" {
+		err = DeleteSlackMessage(h.botToken, m.Channel, m.Ts)
+		if err != nil {
+			h.logger.Println(err)
+		}
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionModerate, "", "hid message "+m.Id+" in "+m.ThreadId)
+
+	writeSlackMessage(w, ResponseTypeEphemeral, "Message "+m.Id+" has been hidden.")
+}
@@ -0,0 +1,47 @@
+// messages_test.go
+package service
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestThreadId(t *testing.T) {
+	h := &Handlers{SecretSanta: &SecretSanta{}}
+	id := h.threadId("E1", "U1", "U2")
+	if !regexp.MustCompile(`^T[0-9A-F]{6}$`).MatchString(id) {
+		t.Errorf("threadId() = %q, want T and six hex digits", id)
+	}
+	if again := h.threadId("E1", "U1", "U2"); again != id {
+		t.Errorf("threadId() = %q, then %q", id, again)
+	}
+
+	others := []struct {
+		name     string
+		eventId  string
+		santaId  string
+		gifteeId string
+	}{
+		{"other event", "E2", "U1", "U2"},
+		{"swapped roles", "E1", "U2", "U1"},
+		{"other giftee", "E1", "U1", "U3"},
+	}
+	for _, tt := range others {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.threadId(tt.eventId, tt.santaId, tt.gifteeId); got == id {
+				t.Errorf("threadId() = %q for both threads", got)
+			}
+		})
+	}
+}
+
+func TestKeyedThreadId(t *testing.T) {
+	h := &Handlers{SecretSanta: &SecretSanta{keys: testAssignmentKeys(t, 'a')}}
+	id := h.threadId("E1", "U1", "U2")
+	if id == (&Handlers{SecretSanta: &SecretSanta{}}).threadId("E1", "U1", "U2") {
+		t.Errorf("keyed threadId() = %q, the same as without keys", id)
+	}
+	if again := h.threadId("E1", "U1", "U2"); again != id {
+		t.Errorf("keyed threadId() = %q, then %q", id, again)
+	}
+}
@@ -3,6 +3,7 @@ package service
 
 import (
 	"context"
+	"time"
 )
 
 const (
@@ -10,19 +11,235 @@ const (
 	ResponseTypeInChannel string = "in_channel"
 )
 
+const (
+	EventStatusArchived  string = "archived"
+	EventStatusCancelled string = "cancelled"
+	EventStatusOpen      string = "open"
+	EventStatusMatched   string = "matched"
+)
+
+const (
+	JobKindEnrollmentReminder string = "enrollmentReminder"
+	JobKindGiftReminder       string = "giftReminder"
+	JobKindRevealReminder     string = "revealReminder"
+)
+
+const (
+	JobStatusPending string = "pending"
+	JobStatusDone    string = "done"
+	JobStatusFailed  string = "failed"
+)
+
+type AuditEntry struct {
+	Action   string    `bson:"action" json:"action"`
+	ActorId  string    `bson:"actorId" json:"actorId"`
+	At       time.Time `bson:"at" json:"at"`
+	Details  string    `bson:"details" json:"details,omitempty"`
+	EventId  string    `bson:"eventId" json:"eventId"`
+	TargetId string    `bson:"targetId" json:"targetId,omitempty"`
+}
+
+type Confirmation struct {
+	Action    string    `bson:"action"`
+	Code      string    `bson:"code"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	UserId    string    `bson:"userId"`
+}
+
+type Event struct {
+	Id            string        `bson:"_id"`
+	Budget        *float64      `bson:"budget"`
+	ChannelId     *string       `bson:"channelId"`
+	CoHostIds     []string      `bson:"coHostIds"`
+	Draw          *Draw         `bson:"draw"`
+	Currency      *string       `bson:"currency"`
+	EnterpriseId  *string       `bson:"enterpriseId"`
+	ExchangeDate  *time.Time    `bson:"exchangeDate"`
+	Exclusions    []Exclusion   `bson:"exclusions"`
+	GifteesEach   int           `bson:"gifteesEach"`
+	InvitedIds    []string      `bson:"invitedIds"`
+	LockedUntil   time.Time     `bson:"lockedUntil"`
+	MatchByRegion bool          `bson:"matchByRegion"`
+	Name          string        `bson:"name"`
+	OptedOutIds   []string      `bson:"optedOutIds"`
+	OwnerId       string        `bson:"ownerId"`
+	Pending       *Confirmation `bson:"pending"`
+	Platform      string        `bson:"platform"`
+	Reminders     Reminders     `bson:"reminders"`
+	Rules         *string       `bson:"rules"`
+	ServiceUrl    *string       `bson:"serviceUrl"`
+	Status        string        `bson:"status"`
+	TeamId        *string       `bson:"teamId"`
+	Theme         *string       `bson:"theme"`
+	Version       int64         `bson:"version"`
+	Year          int           `bson:"year"`
+}
+
+type Reminders struct {
+	EnrollmentClosesAt   *time.Time `bson:"enrollmentClosesAt"`
+	EnrollmentDaysBefore int        `bson:"enrollmentDaysBefore"`
+	GiftDaysBefore       *int       `bson:"giftDaysBefore"`
+	ManualReveal         bool       `bson:"manualReveal"`
+	RevealAt             *time.Time `bson:"revealAt"`
+	RevealThanks         bool       `bson:"revealThanks"`
+}
+
+// Draw records how the pairs of an event were drawn, so the draw can be
+// verified once its seed is revealed. Regions maps each participant to the
+// country they were matched in when matching by region.
+type Draw struct {
+	At             time.Time         `bson:"at"`
+	Commitment     string            `bson:"commitment"`
+	Exclusions     []Exclusion       `bson:"exclusions"`
+	GifteesEach    int               `bson:"gifteesEach"`
+	MatchByRegion  bool              `bson:"matchByRegion"`
+	ParticipantIds []string          `bson:"participantIds"`
+	Regions        map[string]string `bson:"regions"`
+	SealedSeed     string            `bson:"sealedSeed"`
+	Seed           string            `bson:"seed"`
+}
+
+// Exclusion keeps two users from being matched with each other.
+type Exclusion struct {
+	FirstId  string `bson:"firstId"`
+	SecondId string `bson:"secondId"`
+}
+
+// Gift is how far the gift of a santa to one of their giftees has come.
+// For names the giftee, see giftKey.
+type Gift struct {
+	Carrier        *string    `bson:"carrier"`
+	For            string     `bson:"for"`
+	PurchasedAt    *time.Time `bson:"purchasedAt"`
+	ReceivedAt     *time.Time `bson:"receivedAt"`
+	ShippedAt      *time.Time `bson:"shippedAt"`
+	TrackingNumber *string    `bson:"trackingNumber"`
+}
+
+type Job struct {
+	Id          string    `bson:"_id"`
+	Attempts    int       `bson:"attempts"`
+	Delivered   []string  `bson:"delivered"`
+	Error       string    `bson:"error"`
+	EventId     string    `bson:"eventId"`
+	Kind        string    `bson:"kind"`
+	LockedBy    string    `bson:"lockedBy"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+	RunAt       time.Time `bson:"runAt"`
+	Status      string    `bson:"status"`
+}
+
+// Match is one giftee of a participant.
+type Match struct {
+	Address *string `bson:"address"`
+	Name    string  `bson:"name"`
+	UserId  string  `bson:"userId"`
+}
+
+type Message struct {
+	Id        string    `bson:"_id"`
+	At        time.Time `bson:"at"`
+	Channel   string    `bson:"channel"`
+	EventId   string    `bson:"eventId"`
+	FromSanta bool      `bson:"fromSanta"`
+	GifteeId  string    `bson:"gifteeId"`
+	Hidden    bool      `bson:"hidden"`
+	SantaId   string    `bson:"santaId"`
+	Text      string    `bson:"text"`
+	ThreadId  string    `bson:"threadId"`
+	Ts        string    `bson:"ts"`
+}
+
+// Notification records whether a participant has been told their match.
+type Notification struct {
+	At        time.Time `bson:"at"`
+	Delivered bool      `bson:"delivered"`
+	Error     string    `bson:"error"`
+}
+
 type Participant struct {
-	Address          *string `bson:"addresss"`
-	ChannelId        *string `bson:"channelId"`
-	EnterpriseId     *string `bson:"enterpriseId"`
-	IsHost           bool    `bson:"isHost"`
-	IsMatched        bool    `bson:"isMatched"`
-	ResponseUrl      string  `bson:"responseUrl"`
-	TeamId           *string `bson:"teamId"`
-	UserId           string  `bson:"userId"`
-	UserName         string  `bson:"userName"`
-	YourMatchAddress *string `bson:"yourMatchAddress"`
-	YourMatchId      *string `bson:"yourMatchId"`
-	YourMatchName    *string `bson:"yourMatchName"`
+	Address          *string       `bson:"addresss"`
+	ChannelId        *string       `bson:"channelId"`
+	Email            *string       `bson:"email"`
+	EnterpriseId     *string       `bson:"enterpriseId"`
+	Gift             *Gift         `bson:"gift"`
+	Gifts            []Gift        `bson:"gifts"`
+	IsHost           bool          `bson:"isHost"`
+	IsMatched        bool          `bson:"isMatched"`
+	Notification     *Notification `bson:"notification"`
+	ResponseUrl      string        `bson:"responseUrl"`
+	SantaTags        []string      `bson:"santaTags"`
+	SealedMatches    string        `bson:"sealedMatches"`
+	TeamId           *string       `bson:"teamId"`
+	UserId           string        `bson:"userId"`
+	UserName         string        `bson:"userName"`
+	Wishlist         *Wishlist     `bson:"wishlist"`
+	YourMatchAddress *string       `bson:"yourMatchAddress"`
+	YourMatchId      *string       `bson:"yourMatchId"`
+	YourMatchName    *string       `bson:"yourMatchName"`
+	YourMatches      []Match       `bson:"yourMatches"`
+}
+
+// SlackBlock is a Block Kit layout block. Only the fields of the block
+// types in use are defined. Elements holds SlackText in context blocks and
+// SlackElement in actions blocks.
+type SlackBlock struct {
+	BlockId  string        `json:"block_id,omitempty"`
+	Element  *SlackElement `json:"element,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+	Label    *SlackText    `json:"label,omitempty"`
+	Text     *SlackText    `json:"text,omitempty"`
+	Type     string        `json:"type"`
+}
+
+// SlackElement is an interactive Block Kit element, e.g. a button.
+type SlackElement struct {
+	ActionId  string     `json:"action_id"`
+	Multiline bool       `json:"multiline,omitempty"`
+	Style     string     `json:"style,omitempty"`
+	Text      *SlackText `json:"text,omitempty"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value,omitempty"`
+}
+
+// SlackInteraction is the payload Slack posts when a user clicks a button
+// or submits a modal.
+type SlackInteraction struct {
+	Actions []struct {
+		ActionId string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	Container struct {
+		ChannelId string `json:"channel_id"`
+		MessageTs string `json:"message_ts"`
+	} `json:"container"`
+	Enterprise *struct {
+		Id string `json:"id"`
+	} `json:"enterprise"`
+	Team struct {
+		Id string `json:"id"`
+	} `json:"team"`
+	TriggerId string `json:"trigger_id"`
+	Type      string `json:"type"`
+	User      struct {
+		Id       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	View struct {
+		CallbackId      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]struct {
+				Value string `json:"value"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+}
+
+type SlackBlocksMessage struct {
+	Blocks       []SlackBlock `json:"blocks"`
+	ResponseType string       `json:"response_type"`
+	Text         string       `json:"text"`
 }
 
 type SlackMessage struct {
@@ -30,29 +247,385 @@ type SlackMessage struct {
 	Text         string `json:"text"`
 }
 
+type SlackText struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// SlackView is a Block Kit modal.
+type SlackView struct {
+	Blocks          []SlackBlock `json:"blocks"`
+	CallbackId      string       `json:"callback_id"`
+	PrivateMetadata string       `json:"private_metadata"`
+	Submit          *SlackText   `json:"submit,omitempty"`
+	Title           *SlackText   `json:"title"`
+	Type            string       `json:"type"`
+}
+
+type Wishlist struct {
+	Allergies *string `bson:"allergies"`
+	Items     *string `bson:"items"`
+	Links     *string `bson:"links"`
+	NoThanks  *string `bson:"noThanks"`
+	Sizes     *string `bson:"sizes"`
+}
+
+type SlackApiResponse struct {
+	Channel          string   `json:"channel"`
+	Members          []string `json:"members"`
+	Ok               bool     `json:"ok"`
+	Error            string   `json:"error"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+	Ts string `json:"ts"`
+}
+
+// SlackRequest is a slash command. Who runs it and where is kept apart as
+// its Caller, which the other chat platforms fill in too.
 type SlackRequest struct {
-	ChannelId      *string `json:"channel_id"`
+	Caller
 	ChannelName    *string `json:"channel_name"`
 	Command        *string `json:"command"`
-	EnterpriseId   *string `json:"enterprise_id"`
 	EnterpriseName *string `json:"enterprise_name"`
-	ResponseUrl    string  `json:"response_url"`
 	TeamDomain     *string `json:"team_domain"`
-	TeamId         *string `json:"team_id"`
 	Text           *string `json:"text"`
 	Token          *string `json:"token"`
 	TriggerId      *string `json:"trigger_id"`
-	UserId         string  `json:"user_id"`
-	UserName       string  `json:"user_name"`
+}
+
+// Caller is who runs a command and where: a user in a channel of a chat
+// platform. Events belong to the channel, team and enterprise. ServiceUrl
+// is where Teams is reached for the events created on it.
+type Caller struct {
+	ChannelId    *string
+	EnterpriseId *string
+	Platform     string
+	ResponseUrl  string
+	ServiceUrl   *string
+	TeamId       *string
+	UserId       string
+	UserName     string
+}
+
+// DiscordInteraction is what Discord sends when a slash command is used.
+// Only the fields in use are defined. Member is set in servers, User in
+// direct messages.
+type DiscordInteraction struct {
+	ChannelId string              `json:"channel_id"`
+	Data      *DiscordCommandData `json:"data"`
+	GuildId   string              `json:"guild_id"`
+	Id        string              `json:"id"`
+	Member    *DiscordMember      `json:"member"`
+	Token     string              `json:"token"`
+	Type      int                 `json:"type"`
+	User      *DiscordUser        `json:"user"`
+}
+
+type DiscordCommandData struct {
+	Name    string          `json:"name"`
+	Options []DiscordOption `json:"options"`
+}
+
+// DiscordOption is an option of a slash command. Only string options are
+// in use.
+type DiscordOption struct {
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name"`
+	Required    bool   `json:"required,omitempty"`
+	Type        int    `json:"type"`
+	Value       string `json:"value,omitempty"`
+}
+
+type DiscordMember struct {
+	User *DiscordUser `json:"user"`
+}
+
+type DiscordUser struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type DiscordMessage struct {
+	Content string `json:"content"`
+	Flags   int    `json:"flags,omitempty"`
+}
+
+type DiscordResponse struct {
+	Data *DiscordMessage `json:"data,omitempty"`
+	Type int             `json:"type"`
+}
+
+// TeamsActivity is an activity of the Bot Framework, e.g. a message sent
+// to the bot in Microsoft Teams or one the bot sends. Only the fields in
+// use are defined.
+type TeamsActivity struct {
+	Attachments  []TeamsAttachment `json:"attachments,omitempty"`
+	ChannelData  *TeamsChannelData `json:"channelData,omitempty"`
+	ChannelId    string            `json:"channelId,omitempty"`
+	Conversation *TeamsAccount     `json:"conversation,omitempty"`
+	From         *TeamsAccount     `json:"from,omitempty"`
+	Id           string            `json:"id,omitempty"`
+	Recipient    *TeamsAccount     `json:"recipient,omitempty"`
+	ReplyToId    string            `json:"replyToId,omitempty"`
+	ServiceUrl   string            `json:"serviceUrl,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	Type         string            `json:"type"`
+}
+
+// TeamsAccount identifies a user, bot, conversation, channel, team or
+// tenant, depending on where it is used.
+type TeamsAccount struct {
+	AadObjectId      string `json:"aadObjectId,omitempty"`
+	ConversationType string `json:"conversationType,omitempty"`
+	Id               string `json:"id"`
+	Name             string `json:"name,omitempty"`
+}
+
+type TeamsAttachment struct {
+	Content     interface{} `json:"content"`
+	ContentType string      `json:"contentType"`
+}
+
+type TeamsChannelData struct {
+	Channel *TeamsAccount `json:"channel,omitempty"`
+	Team    *TeamsAccount `json:"team,omitempty"`
+	Tenant  *TeamsAccount `json:"tenant,omitempty"`
+}
+
+// AdaptiveCard is the card Teams messages are laid out with. Only the
+// elements in use are defined: facts are for FactSet elements, the other
+// fields for TextBlock ones.
+type AdaptiveCard struct {
+	Body    []AdaptiveElement `json:"body"`
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+}
+
+type AdaptiveElement struct {
+	Facts  []AdaptiveFact `json:"facts,omitempty"`
+	Size   string         `json:"size,omitempty"`
+	Text   string         `json:"text,omitempty"`
+	Type   string         `json:"type"`
+	Weight string         `json:"weight,omitempty"`
+	Wrap   bool           `json:"wrap,omitempty"`
+}
+
+type AdaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// ApiError is the body of the error responses of the JSON API. Its kind
+// is one of the ErrorKind constants, or unauthorized or internal.
+type ApiError struct {
+	Error ApiErrorDetails `json:"error"`
+}
+
+type ApiErrorDetails struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// ApiEvent is an event as the JSON API shows it. Commitment is set once
+// the pairs are drawn.
+type ApiEvent struct {
+	Id                 string     `json:"id"`
+	Budget             *float64   `json:"budget,omitempty"`
+	ChannelId          *string    `json:"channelId"`
+	CoHostIds          []string   `json:"coHostIds"`
+	Commitment         string     `json:"commitment,omitempty"`
+	Currency           *string    `json:"currency,omitempty"`
+	EnrollmentClosesAt *time.Time `json:"enrollmentClosesAt,omitempty"`
+	ExchangeDate       *time.Time `json:"exchangeDate,omitempty"`
+	GifteesEach        int        `json:"gifteesEach"`
+	MatchByRegion      bool       `json:"matchByRegion"`
+	Name               string     `json:"name"`
+	OwnerId            string     `json:"ownerId"`
+	RevealAt           *time.Time `json:"revealAt,omitempty"`
+	Rules              *string    `json:"rules,omitempty"`
+	Status             string     `json:"status"`
+	Theme              *string    `json:"theme,omitempty"`
+	Year               int        `json:"year"`
+}
+
+// ApiEventRequest creates an event. Settings takes the same keys and
+// values as /santa settings, e.g. budget or exchange.
+type ApiEventRequest struct {
+	Address   string            `json:"address"`
+	ChannelId string            `json:"channelId"`
+	Name      string            `json:"name"`
+	Organize  bool              `json:"organize"`
+	Settings  map[string]string `json:"settings"`
+}
+
+type ApiEnrollRequest struct {
+	Address string `json:"address"`
+	Email   string `json:"email"`
+}
+
+// ApiParticipant is a participant as hosts see them: how far they have
+// come, but never whom they give to.
+type ApiParticipant struct {
+	GiftStatus   string `json:"giftStatus,omitempty"`
+	HasAddress   bool   `json:"hasAddress"`
+	IsHost       bool   `json:"isHost"`
+	IsMatched    bool   `json:"isMatched"`
+	Notification string `json:"notification,omitempty"`
+	UserId       string `json:"userId"`
+	UserName     string `json:"userName"`
+}
+
+type ApiStatus struct {
+	Enrolled            int    `json:"enrolled"`
+	GiftsPurchased      int    `json:"giftsPurchased"`
+	GiftsReceived       int    `json:"giftsReceived"`
+	GiftsShipped        int    `json:"giftsShipped"`
+	Matched             int    `json:"matched"`
+	NotificationsFailed int    `json:"notificationsFailed"`
+	Notified            int    `json:"notified"`
+	Status              string `json:"status"`
+	WithoutAddress      int    `json:"withoutAddress"`
+}
+
+type ApiAssignment struct {
+	Event   ApiEvent    `json:"event"`
+	Giftees []ApiGiftee `json:"giftees"`
+}
+
+type ApiGiftee struct {
+	Address  *string      `json:"address"`
+	Name     string       `json:"name"`
+	UserId   string       `json:"userId"`
+	Wishlist *ApiWishlist `json:"wishlist,omitempty"`
+}
+
+type ApiWishlist struct {
+	Allergies *string `json:"allergies,omitempty"`
+	Items     *string `json:"items,omitempty"`
+	Links     *string `json:"links,omitempty"`
+	NoThanks  *string `json:"noThanks,omitempty"`
+	Sizes     *string `json:"sizes,omitempty"`
+}
+
+// EventExport is an event and its participants as hosts and operators
+// export them. Who gives to whom is only included once it is revealed.
+type EventExport struct {
+	Event        ApiEvent            `json:"event"`
+	Participants []ExportParticipant `json:"participants"`
+}
+
+type ExportParticipant struct {
+	Address    *string      `json:"address"`
+	Email      *string      `json:"email,omitempty"`
+	GifteeIds  []string     `json:"gifteeIds,omitempty"`
+	GiftStatus string       `json:"giftStatus,omitempty"`
+	IsHost     bool         `json:"isHost"`
+	IsMatched  bool         `json:"isMatched"`
+	UserId     string       `json:"userId"`
+	UserName   string       `json:"userName"`
+	Wishlist   *ApiWishlist `json:"wishlist,omitempty"`
+}
+
+// PersonalData is everything stored about a user in the events of a
+// workspace, for them to take away. Who their santas are is left out,
+// as is whatever would give it away.
+type PersonalData struct {
+	Audit    []AuditEntry  `json:"audit"`
+	Events   []UserEvent   `json:"events"`
+	Messages []UserMessage `json:"messages"`
+	TeamId   *string       `json:"teamId"`
+	UserId   string        `json:"userId"`
+}
+
+// UserEvent is an event a user has a part in: as a participant, a host,
+// or somebody who was invited, declined or was excluded from a pair.
+type UserEvent struct {
+	Event       ApiEvent           `json:"event"`
+	ExcludedIds []string           `json:"excludedIds,omitempty"`
+	Participant *ExportParticipant `json:"participant,omitempty"`
+	Roles       []string           `json:"roles,omitempty"`
+}
+
+// UserMessage is an anonymous message a user sent to, or got from, their
+// santa or giftee.
+type UserMessage struct {
+	At      time.Time `json:"at"`
+	EventId string    `json:"eventId"`
+	Hidden  bool      `json:"hidden"`
+	Sent    bool      `json:"sent"`
+	Text    string    `json:"text"`
+}
+
+// ForgetReport counts what forgetting a user erased: participants removed
+// from open events, anonymized in the others, the copies of their name
+// and address their santas kept, and the anonymous messages of their
+// conversations.
+type ForgetReport struct {
+	Anonymized  int
+	Events      int
+	Messages    int
+	Removed     int
+	SantaCopies int
+}
+
+// ImportReport tells how a roster import went, or would go in a dry run:
+// who has been enrolled, and which rows were left out and why. Rows are
+// numbered by the line of the file they start on, the header being line 1.
+type ImportReport struct {
+	DryRun   bool            `json:"dryRun"`
+	Enrolled []string        `json:"enrolled"`
+	Problems []ImportProblem `json:"problems"`
+	Rows     int             `json:"rows"`
+}
+
+type ImportProblem struct {
+	Message string `json:"message"`
+	Row     int    `json:"row"`
+	UserId  string `json:"userId,omitempty"`
 }
 
 type SecretSantaRepository interface {
-	Check(ctx context.Context, chid *string, eid *string, tid *string, y int) bool
-	CountAllParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) (int64, error)
-	CountMatchedParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) (int64, error)
-	GetAllParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) ([]Participant, error)
-	GetUnmatchedParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) ([]Participant, error)
-	GetParticipantById(ctx context.Context, chid *string, eid *string, tid *string, uid string, y int) (*Participant, error)
-	RegisterParticipant(ctx context.Context, p *Participant, y int) error
-	UpdateParticipantMatch(ctx context.Context, match *Participant, p *Participant, y int) error
+	AddAuditEntry(ctx context.Context, entry *AuditEntry) error
+	AddMessage(ctx context.Context, m *Message) error
+	AnonymizeMatchCopies(ctx context.Context, eventId string, uid string, name string) (int64, error)
+	AnonymizeParticipant(ctx context.Context, eventId string, uid string, name string) error
+	CancelPendingJobs(ctx context.Context, eventId string, kind string) error
+	ClaimDueJob(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error)
+	CompleteJob(ctx context.Context, job *Job) error
+	CountAllParticipants(ctx context.Context, eventId string) (int64, error)
+	CountMatchedParticipants(ctx context.Context, eventId string) (int64, error)
+	EnsureIndexes(ctx context.Context, eventIds []string) error
+	EraseMessages(ctx context.Context, ids []string) error
+	FailJob(ctx context.Context, job *Job, jobErr error, maxAttempts int) error
+	FindEvents(ctx context.Context, chid *string, eid *string, tid *string) ([]Event, error)
+	FindLegacyCollections(ctx context.Context, tid *string) ([]string, error)
+	FindTeamEvents(ctx context.Context, tid *string) ([]Event, error)
+	GetAllEvents(ctx context.Context) ([]Event, error)
+	GetAllParticipants(ctx context.Context, eventId string) ([]Participant, error)
+	GetAuditEntries(ctx context.Context, eventId string, limit int64) ([]AuditEntry, error)
+	GetEvent(ctx context.Context, id string) (*Event, error)
+	GetMessage(ctx context.Context, id string) (*Message, error)
+	GetMessages(ctx context.Context, eventId string, limit int64) ([]Message, error)
+	GetParticipantById(ctx context.Context, eventId string, uid string) (*Participant, error)
+	GetSantas(ctx context.Context, eventId string, uid string, tag string) ([]Participant, error)
+	GetThreadMessages(ctx context.Context, eventId string, threadIds []string) ([]Message, error)
+	GetUnmatchedParticipants(ctx context.Context, eventId string) ([]Participant, error)
+	GetUserAuditEntries(ctx context.Context, eventIds []string, uid string) ([]AuditEntry, error)
+	HideMessage(ctx context.Context, id string) error
+	MarkJobDelivered(ctx context.Context, id string, uid string) error
+	RegisterParticipant(ctx context.Context, eventId string, p *Participant) error
+	RemoveParticipant(ctx context.Context, eventId string, uid string) error
+	ResetMatches(ctx context.Context, eventId string, uids []string) error
+	SealParticipantMatches(ctx context.Context, eventId string, uid string, sealed string, tags []string) error
+	SaveEvent(ctx context.Context, e *Event) error
+	ScheduleJob(ctx context.Context, job *Job) error
+	UpdateAddress(ctx context.Context, eventId string, uid string, address *string) error
+	UpdateEmail(ctx context.Context, eventId string, uid string, email *string) error
+	UpdateGift(ctx context.Context, eventId string, uid string, gift *Gift) error
+	UpdateNotification(ctx context.Context, eventId string, uid string, n *Notification) error
+	UpdateParticipantMatch(ctx context.Context, eventId string, match *Participant, p *Participant) error
+	UpdateParticipantMatches(ctx context.Context, eventId string, p *Participant, matches []Participant) error
+	UpdateWishlist(ctx context.Context, eventId string, uid string, wl *Wishlist) error
 }
@@ -5,12 +5,43 @@ import (
 	"context"
 	"errors"
 	"strconv"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	auditCollection    string = "audit"
+	eventsCollection   string = "events"
+	jobsCollection     string = "jobs"
+	messagesCollection string = "messages"
+)
+
+var ErrConcurrentUpdate = conflictError("This event has just been changed by someone else, please try again")
+
+var ErrAlreadyEnrolled = conflictError("You are already taking part in this event")
+
+var ErrEventNotFound = notFoundError("There is no such Secret Santa event")
+
+var ErrDuplicateEvent = conflictError("An active event with this name has already been initialized for this channel")
+
+// eventNameIndex keeps two active events of a channel, open or matched,
+// from having the same name, whatever the case, e.g. when two /initialize
+// run at once. Events are only told apart by name, see findEvent.
+// Cancelled and revealed events do not count, so their names can be used
+// again. Partial indexes take $in from MongoDB 6.0 on.
+const eventNameIndex string = "activeEventName"
+
+// legacyEventNameIndex only covered open events, and is replaced by
+// eventNameIndex.
+const legacyEventNameIndex string = "openEventName"
+
+// mongoIndexNotFound is the code of the error dropping a missing index.
+const mongoIndexNotFound int32 = 27
+
 type ServiceRepo struct {
 	client *mongo.Client
 	dbName string
@@ -39,25 +70,12 @@ func NewServiceRepo(connString string, dbName string) (*ServiceRepo, error) {
 	}, nil
 }
 
-func (r *ServiceRepo) CountMatchedParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) (int64, error) {
-	eidValue := ""
-	if eid != nil {
-		eidValue = *eid
-	}
-	tidValue := ""
-	if tid != nil {
-		tidValue = *tid
-	}
-	chidValue := ""
-	if chid != nil {
-		chidValue = *chid
-	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
+func (r *ServiceRepo) CountMatchedParticipants(ctx context.Context, eventId string) (int64, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
 	filter := bson.M{"isMatched": true}
 
-	count, err := collection.CountDocuments(context.TODO(), filter)
+	count, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, err
 	}
@@ -65,25 +83,12 @@ func (r *ServiceRepo) CountMatchedParticipants(ctx context.Context, chid *string
 	return count, nil
 }
 
-func (r *ServiceRepo) CountAllParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) (int64, error) {
-	eidValue := ""
-	if eid != nil {
-		eidValue = *eid
-	}
-	tidValue := ""
-	if tid != nil {
-		tidValue = *tid
-	}
-	chidValue := ""
-	if chid != nil {
-		chidValue = *chid
-	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
+func (r *ServiceRepo) CountAllParticipants(ctx context.Context, eventId string) (int64, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
 	filter := bson.M{}
 
-	count, err := collection.CountDocuments(context.TODO(), filter)
+	count, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, err
 	}
@@ -91,21 +96,8 @@ func (r *ServiceRepo) CountAllParticipants(ctx context.Context, chid *string, ei
 	return count, nil
 }
 
-func (r *ServiceRepo) GetAllParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) ([]Participant, error) {
-	eidValue := ""
-	if eid != nil {
-		eidValue = *eid
-	}
-	tidValue := ""
-	if tid != nil {
-		tidValue = *tid
-	}
-	chidValue := ""
-	if chid != nil {
-		chidValue = *chid
-	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
+func (r *ServiceRepo) GetAllParticipants(ctx context.Context, eventId string) ([]Participant, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
 	options := options.Find()
 
@@ -113,12 +105,12 @@ func (r *ServiceRepo) GetAllParticipants(ctx context.Context, chid *string, eid
 
 	var results []Participant
 
-	cur, err := collection.Find(context.TODO(), filter, options)
+	cur, err := collection.Find(ctx, filter, options)
 	if err != nil {
 		return nil, err
 	}
 
-	for cur.Next(context.TODO()) {
+	for cur.Next(ctx) {
 		var i Participant
 		err := cur.Decode(&i)
 		if err != nil {
@@ -131,21 +123,8 @@ func (r *ServiceRepo) GetAllParticipants(ctx context.Context, chid *string, eid
 	return results, nil
 }
 
-func (r *ServiceRepo) GetUnmatchedParticipants(ctx context.Context, chid *string, eid *string, tid *string, y int) ([]Participant, error) {
-	eidValue := ""
-	if eid != nil {
-		eidValue = *eid
-	}
-	tidValue := ""
-	if tid != nil {
-		tidValue = *tid
-	}
-	chidValue := ""
-	if chid != nil {
-		chidValue = *chid
-	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
+func (r *ServiceRepo) GetUnmatchedParticipants(ctx context.Context, eventId string) ([]Participant, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
 	options := options.Find()
 
@@ -153,12 +132,12 @@ func (r *ServiceRepo) GetUnmatchedParticipants(ctx context.Context, chid *string
 
 	var results []Participant
 
-	cur, err := collection.Find(context.TODO(), filter, options)
+	cur, err := collection.Find(ctx, filter, options)
 	if err != nil {
 		return nil, err
 	}
 
-	for cur.Next(context.TODO()) {
+	for cur.Next(ctx) {
 		var i Participant
 		err := cur.Decode(&i)
 		if err != nil {
@@ -171,105 +150,182 @@ func (r *ServiceRepo) GetUnmatchedParticipants(ctx context.Context, chid *string
 	return results, nil
 }
 
-func (r *ServiceRepo) GetParticipantById(ctx context.Context, chid *string, eid *string, tid *string, uid string, y int) (*Participant, error) {
-	eidValue := ""
-	if eid != nil {
-		eidValue = *eid
-	}
-	tidValue := ""
-	if tid != nil {
-		tidValue = *tid
+func (r *ServiceRepo) GetParticipantById(ctx context.Context, eventId string, uid string) (*Participant, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	var p Participant
+	err := collection.FindOne(ctx, bson.M{"userId": uid}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("no such participant")
 	}
-	chidValue := ""
-	if chid != nil {
-		chidValue = *chid
+	if err != nil {
+		return nil, err
 	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
 
-	options := options.Find()
+	return &p, nil
+}
 
-	filter := bson.M{"userId": uid}
+// GetSantas returns everybody who gives a gift to the given user, as
+// there are several when each participant gives more than one gift. The
+// tag finds santas whose giftees are sealed, see SealParticipantMatches.
+func (r *ServiceRepo) GetSantas(ctx context.Context, eventId string, uid string, tag string) ([]Participant, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
-	var results []Participant
+	cursor, err := collection.Find(ctx, santaFilter(uid, tag))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
 
-	cur, err := collection.Find(context.TODO(), filter, options)
+	var santas []Participant
+	err = cursor.All(ctx, &santas)
 	if err != nil {
 		return nil, err
 	}
 
-	for cur.Next(context.TODO()) {
-		var i Participant
-		err := cur.Decode(&i)
-		if err != nil {
-			return nil, err
-		}
+	return santas, nil
+}
 
-		results = append(results, i)
+func santaFilter(uid string, tag string) bson.M {
+	or := bson.A{
+		bson.M{"yourMatchId": uid},
+		bson.M{"yourMatches.userId": uid},
 	}
-
-	if len(results) < 1 {
-		return nil, errors.New("no such participant")
+	if tag != "" {
+		or = append(or, bson.M{"santaTags": tag})
 	}
-
-	return &results[0], nil
+	return bson.M{"$or": or}
 }
 
-func (r *ServiceRepo) RegisterParticipant(ctx context.Context, p *Participant, y int) error {
+func (r *ServiceRepo) RegisterParticipant(ctx context.Context, eventId string, p *Participant) error {
 	mod := mongo.IndexModel{
 		Keys:    bson.M{"userId": 1},
 		Options: options.Index().SetUnique(true),
 	}
 
-	eidValue := ""
-	if p.EnterpriseId != nil {
-		eidValue = *p.EnterpriseId
+	collection := r.client.Database(r.dbName).Collection(eventId)
+	_, _ = collection.Indexes().CreateOne(ctx, mod)
+
+	_, err := collection.InsertOne(ctx, p)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyEnrolled
 	}
-	tidValue := ""
-	if p.TeamId != nil {
-		tidValue = *p.TeamId
+	if err != nil {
+		return err
 	}
-	chidValue := ""
-	if p.ChannelId != nil {
-		chidValue = *p.ChannelId
+	return nil
+}
+
+// RemoveParticipant deletes the participant from the event.
+func (r *ServiceRepo) RemoveParticipant(ctx context.Context, eventId string, uid string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	res, err := collection.DeleteOne(ctx, bson.M{"userId": uid})
+	if err != nil {
+		return err
 	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
-	_, _ = collection.Indexes().CreateOne(ctx, mod)
+	if res.DeletedCount == 0 {
+		return errors.New("no such participant")
+	}
+	return nil
+}
 
-	_, err := collection.InsertOne(ctx, p)
+// EnsureIndexes creates the indexes the queries of the service rely on,
+// including the unique user index of each event's participants, which is
+// otherwise only created when somebody enrolls.
+func (r *ServiceRepo) EnsureIndexes(ctx context.Context, eventIds []string) error {
+	db := r.client.Database(r.dbName)
+
+	indexes := map[string]mongo.IndexModel{
+		eventsCollection:   {Keys: bson.D{{Key: "teamId", Value: 1}, {Key: "channelId", Value: 1}}},
+		jobsCollection:     {Keys: bson.D{{Key: "status", Value: 1}, {Key: "runAt", Value: 1}}},
+		auditCollection:    {Keys: bson.D{{Key: "eventId", Value: 1}, {Key: "at", Value: -1}}},
+		messagesCollection: {Keys: bson.D{{Key: "eventId", Value: 1}, {Key: "at", Value: -1}}},
+	}
+	for name, mod := range indexes {
+		_, err := db.Collection(name).Indexes().CreateOne(ctx, mod)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Collection(eventsCollection).Indexes().DropOne(ctx, legacyEventNameIndex)
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == mongoIndexNotFound) {
+		return err
+	}
+
+	names := mongo.IndexModel{
+		Keys: bson.D{{Key: "teamId", Value: 1}, {Key: "channelId", Value: 1}, {Key: "name", Value: 1}, {Key: "year", Value: 1}},
+		Options: options.Index().
+			SetName(eventNameIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": bson.M{"$in": []string{EventStatusOpen, EventStatusMatched}}}).
+			SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+	}
+	_, err = db.Collection(eventsCollection).Indexes().CreateOne(ctx, names)
 	if err != nil {
 		return err
 	}
+
+	for _, id := range eventIds {
+		mod := mongo.IndexModel{
+			Keys:    bson.M{"userId": 1},
+			Options: options.Index().SetUnique(true),
+		}
+		_, err := db.Collection(id).Indexes().CreateOne(ctx, mod)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *ServiceRepo) UpdateParticipantMatch(ctx context.Context, match *Participant, p *Participant, y int) error {
-	eidValue := ""
-	if p.EnterpriseId != nil {
-		eidValue = *p.EnterpriseId
+// ResetMatches throws away the matches of the given participants, or of
+// everybody in the event if uids is nil.
+func (r *ServiceRepo) ResetMatches(ctx context.Context, eventId string, uids []string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	filter := bson.M{}
+	if uids != nil {
+		filter["userId"] = bson.M{"$in": uids}
 	}
-	tidValue := ""
-	if p.TeamId != nil {
-		tidValue = *p.TeamId
+
+	update := bson.M{
+		"$set": bson.M{
+			"gift":             nil,
+			"gifts":            bson.A{},
+			"notification":     nil,
+			"isMatched":        false,
+			"santaTags":        nil,
+			"sealedMatches":    nil,
+			"yourMatchAddress": nil,
+			"yourMatchId":      nil,
+			"yourMatchName":    nil,
+			"yourMatches":      nil,
+		},
 	}
-	chidValue := ""
-	if p.ChannelId != nil {
-		chidValue = *p.ChannelId
+
+	_, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return err
 	}
-	cName := eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
-	collection := r.client.Database(r.dbName).Collection(cName)
+	return nil
+}
+
+func (r *ServiceRepo) UpdateParticipantMatch(ctx context.Context, eventId string, match *Participant, p *Participant) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
 
 	filter := bson.M{
 		"userId": p.UserId,
 	}
 
 	update := bson.D{
-		{"$set", bson.D{
-			{"isMatched", true},
-			{"yourMatchAddress", match.Address},
-			{"yourMatchId", match.UserId},
-			{"yourMatchName", match.UserName},
+		{Key: "$set", Value: bson.D{
+			{Key: "isMatched", Value: true},
+			{Key: "yourMatchAddress", Value: match.Address},
+			{Key: "yourMatchId", Value: match.UserId},
+			{Key: "yourMatchName", Value: match.UserName},
 		}},
 	}
 
@@ -279,3 +335,752 @@ func (r *ServiceRepo) UpdateParticipantMatch(ctx context.Context, match *Partici
 	}
 	return nil
 }
+
+// UpdateParticipantMatches stores all giftees of the participant. The
+// first one is also kept in the single match fields, which is all events
+// with one giftee each used to have.
+func (r *ServiceRepo) UpdateParticipantMatches(ctx context.Context, eventId string, p *Participant, matches []Participant) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	if len(matches) == 0 {
+		return errors.New("no giftees to store for " + p.UserId)
+	}
+
+	var yourMatches []Match
+	for _, m := range matches {
+		yourMatches = append(yourMatches, Match{Address: m.Address, Name: m.UserName, UserId: m.UserId})
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "isMatched", Value: true},
+			{Key: "yourMatchAddress", Value: matches[0].Address},
+			{Key: "yourMatchId", Value: matches[0].UserId},
+			{Key: "yourMatchName", Value: matches[0].UserName},
+			{Key: "yourMatches", Value: yourMatches},
+		}},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": p.UserId}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SealParticipantMatches stores the giftees of the participant encrypted,
+// together with tags to find the participant as the santa of each of them.
+// The single match fields stay empty, so the pairs cannot be read from the
+// database.
+func (r *ServiceRepo) SealParticipantMatches(ctx context.Context, eventId string, uid string, sealed string, tags []string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{
+			"isMatched":        true,
+			"santaTags":        tags,
+			"sealedMatches":    sealed,
+			"yourMatchAddress": nil,
+			"yourMatchId":      nil,
+			"yourMatchName":    nil,
+			"yourMatches":      nil,
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateEmail sets the address the participant is emailed at, or stops
+// emailing them if it is nil.
+func (r *ServiceRepo) UpdateEmail(ctx context.Context, eventId string, uid string, email *string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{"email": email},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateGift stores the progress of one of the gifts the given santa
+// gives, in place of what was stored for the same giftee before. The
+// single gift field of older events is given up for the list.
+func (r *ServiceRepo) UpdateGift(ctx context.Context, eventId string, uid string, gift *Gift) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	filter := bson.M{"userId": uid, "gifts.for": gift.For}
+	update := bson.M{
+		"$set": bson.M{"gift": nil, "gifts.$": gift},
+	}
+
+	res, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	filter = bson.M{"userId": uid, "gifts.for": bson.M{"$ne": gift.For}}
+	update = bson.M{
+		"$set":  bson.M{"gift": nil},
+		"$push": bson.M{"gifts": gift},
+	}
+
+	_, err = collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) UpdateNotification(ctx context.Context, eventId string, uid string, n *Notification) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{"notification": n},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) UpdateAddress(ctx context.Context, eventId string, uid string, address *string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{"addresss": address},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) UpdateWishlist(ctx context.Context, eventId string, uid string, wl *Wishlist) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{"wishlist": wl},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AnonymizeParticipant erases what the participant has told about
+// themselves, keeping the record so that the pairs of the event hold.
+func (r *ServiceRepo) AnonymizeParticipant(ctx context.Context, eventId string, uid string, name string) error {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{
+			"addresss":    nil,
+			"email":       nil,
+			"responseUrl": "",
+			"userName":    name,
+			"wishlist":    nil,
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"userId": uid}, update)
+	if err != nil {
+		return err
+	}
+
+	// Tracking numbers may tell where a gift went.
+	update = bson.M{
+		"$set": bson.M{
+			"gift.carrier":        nil,
+			"gift.trackingNumber": nil,
+		},
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"userId": uid, "gift": bson.M{"$ne": nil}}, update)
+	if err != nil {
+		return err
+	}
+
+	update = bson.M{
+		"$set": bson.M{
+			"gifts.$[].carrier":        nil,
+			"gifts.$[].trackingNumber": nil,
+		},
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"userId": uid, "gifts.0": bson.M{"$exists": true}}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AnonymizeMatchCopies erases the copies of the giftee's address and name
+// that their santas keep in the clear, and returns how many santas had
+// one. Sealed copies have to be resealed instead.
+func (r *ServiceRepo) AnonymizeMatchCopies(ctx context.Context, eventId string, uid string, name string) (int64, error) {
+	collection := r.client.Database(r.dbName).Collection(eventId)
+
+	update := bson.M{
+		"$set": bson.M{
+			"yourMatchAddress": nil,
+			"yourMatchName":    name,
+		},
+	}
+
+	res, err := collection.UpdateMany(ctx, bson.M{"yourMatchId": uid}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	update = bson.M{
+		"$set": bson.M{
+			"yourMatches.$[m].address": nil,
+			"yourMatches.$[m].name":    name,
+		},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"m.userId": uid}},
+	})
+
+	_, err = collection.UpdateMany(ctx, bson.M{"yourMatches.userId": uid}, update, opts)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+// FindLegacyCollections returns the yearly participants collections of a
+// team that predate the events collection, see collectionName.
+func (r *ServiceRepo) FindLegacyCollections(ctx context.Context, tid *string) ([]string, error) {
+	names, err := r.client.Database(r.dbName).ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	tidValue := ""
+	if tid != nil {
+		tidValue = *tid
+	}
+
+	var results []string
+	for _, name := range names {
+		parts := strings.Split(name, "_")
+		if len(parts) != 4 || parts[1] != tidValue {
+			continue
+		}
+		if _, err := strconv.Atoi(parts[3]); err != nil {
+			continue
+		}
+		results = append(results, name)
+	}
+	return results, nil
+}
+
+func collectionName(chid *string, eid *string, tid *string, y int) string {
+	eidValue := ""
+	if eid != nil {
+		eidValue = *eid
+	}
+	tidValue := ""
+	if tid != nil {
+		tidValue = *tid
+	}
+	chidValue := ""
+	if chid != nil {
+		chidValue = *chid
+	}
+	return eidValue + "_" + tidValue + "_" + chidValue + "_" + strconv.Itoa(y)
+}
+
+func (r *ServiceRepo) GetEvent(ctx context.Context, id string) (*Event, error) {
+	collection := r.client.Database(r.dbName).Collection(eventsCollection)
+
+	var e Event
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// FindEvents returns the events of a channel, newest first.
+func (r *ServiceRepo) FindEvents(ctx context.Context, chid *string, eid *string, tid *string) ([]Event, error) {
+	collection := r.client.Database(r.dbName).Collection(eventsCollection)
+
+	options := options.Find().SetSort(bson.D{{Key: "year", Value: -1}, {Key: "name", Value: 1}})
+
+	filter := bson.M{
+		"channelId":    chid,
+		"enterpriseId": eid,
+		"teamId":       tid,
+	}
+
+	var results []Event
+
+	cur, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i Event
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+// FindTeamEvents returns the events of all channels of a team, newest
+// first.
+func (r *ServiceRepo) FindTeamEvents(ctx context.Context, tid *string) ([]Event, error) {
+	collection := r.client.Database(r.dbName).Collection(eventsCollection)
+
+	options := options.Find().SetSort(bson.D{{Key: "year", Value: -1}, {Key: "name", Value: 1}})
+
+	var results []Event
+
+	cur, err := collection.Find(ctx, bson.M{"teamId": tid}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i Event
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+// GetAllEvents returns the events of every workspace, newest first, for
+// operators.
+func (r *ServiceRepo) GetAllEvents(ctx context.Context) ([]Event, error) {
+	collection := r.client.Database(r.dbName).Collection(eventsCollection)
+
+	options := options.Find().SetSort(bson.D{{Key: "year", Value: -1}, {Key: "name", Value: 1}})
+
+	var results []Event
+
+	cur, err := collection.Find(ctx, bson.M{}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i Event
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+// SaveEvent stores the event unless it has been changed since it was read,
+// in which case ErrConcurrentUpdate is returned.
+func (r *ServiceRepo) SaveEvent(ctx context.Context, e *Event) error {
+	collection := r.client.Database(r.dbName).Collection(eventsCollection)
+
+	filter := bson.M{
+		"_id":     e.Id,
+		"version": e.Version,
+	}
+	if e.Version == 0 {
+		// Events stored before they were versioned have no version at all.
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	// If another version is stored, the upsert tries to insert a second
+	// document with the same ID and fails.
+	e.Version++
+	_, err := collection.ReplaceOne(ctx, filter, e, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), eventNameIndex) {
+		e.Version--
+		return ErrDuplicateEvent
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		e.Version--
+		return ErrConcurrentUpdate
+	}
+	if err != nil {
+		e.Version--
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) ScheduleJob(ctx context.Context, job *Job) error {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	// Jobs are keyed deterministically, so scheduling the same job twice,
+	// from a restart or from another replica, leaves a single document.
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"attempts":    0,
+			"delivered":   []string{},
+			"error":       "",
+			"eventId":     job.EventId,
+			"kind":        job.Kind,
+			"lockedBy":    "",
+			"lockedUntil": time.Time{},
+			"runAt":       job.RunAt,
+			"status":      JobStatusPending,
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": job.Id}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) CancelPendingJobs(ctx context.Context, eventId string, kind string) error {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	filter := bson.M{
+		"eventId": eventId,
+		"kind":    kind,
+		"status":  JobStatusPending,
+	}
+
+	_, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) ClaimDueJob(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error) {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	filter := bson.M{
+		"status":      JobStatusPending,
+		"runAt":       bson.M{"$lte": now},
+		"lockedUntil": bson.M{"$lte": now},
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"lockedBy":    owner,
+			"lockedUntil": now.Add(lease),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	options := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetSort(bson.M{"runAt": 1})
+
+	var job Job
+	err := collection.FindOneAndUpdate(ctx, filter, update, options).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// CompleteJob marks the job done, unless its lease has run out and
+// another runner has claimed it since.
+func (r *ServiceRepo) CompleteJob(ctx context.Context, job *Job) error {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	update := bson.M{
+		"$set": bson.M{
+			"error":  "",
+			"status": JobStatusDone,
+		},
+	}
+
+	res, err := collection.UpdateOne(ctx, leaseFilter(job), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("job " + job.Id + " was claimed by another runner before it completed")
+	}
+	return nil
+}
+
+// leaseFilter matches the job only as long as it is leased to the runner
+// that claimed it: every claim counts an attempt, so a runner claiming the
+// job again after its own lease ran out does not match either.
+func leaseFilter(job *Job) bson.M {
+	return bson.M{
+		"_id":      job.Id,
+		"attempts": job.Attempts,
+		"lockedBy": job.LockedBy,
+	}
+}
+
+func (r *ServiceRepo) FailJob(ctx context.Context, job *Job, jobErr error, maxAttempts int) error {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	// A failed job stays pending until its lease runs out, then it is
+	// picked up again, unless it has used up all of its attempts.
+	status := JobStatusPending
+	if job.Attempts >= maxAttempts {
+		status = JobStatusFailed
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"error":  jobErr.Error(),
+			"status": status,
+		},
+	}
+
+	res, err := collection.UpdateOne(ctx, leaseFilter(job), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("job " + job.Id + " was claimed by another runner before it failed")
+	}
+	return nil
+}
+
+func (r *ServiceRepo) MarkJobDelivered(ctx context.Context, id string, uid string) error {
+	collection := r.client.Database(r.dbName).Collection(jobsCollection)
+
+	update := bson.M{
+		"$addToSet": bson.M{"delivered": uid},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	collection := r.client.Database(r.dbName).Collection(auditCollection)
+
+	_, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) GetAuditEntries(ctx context.Context, eventId string, limit int64) ([]AuditEntry, error) {
+	collection := r.client.Database(r.dbName).Collection(auditCollection)
+
+	options := options.Find().
+		SetSort(bson.M{"at": -1}).
+		SetLimit(limit)
+
+	filter := bson.M{"eventId": eventId}
+
+	var results []AuditEntry
+
+	cur, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i AuditEntry
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+func (r *ServiceRepo) AddMessage(ctx context.Context, m *Message) error {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	_, err := collection.InsertOne(ctx, m)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ServiceRepo) GetMessage(ctx context.Context, id string) (*Message, error) {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	var m Message
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&m)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("no such message")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (r *ServiceRepo) GetMessages(ctx context.Context, eventId string, limit int64) ([]Message, error) {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	options := options.Find().
+		SetSort(bson.M{"at": -1}).
+		SetLimit(limit)
+
+	filter := bson.M{"eventId": eventId}
+
+	var results []Message
+
+	cur, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i Message
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+// GetThreadMessages returns the messages of the given threads of an
+// event, oldest first.
+func (r *ServiceRepo) GetThreadMessages(ctx context.Context, eventId string, threadIds []string) ([]Message, error) {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	options := options.Find().SetSort(bson.M{"at": 1})
+
+	filter := bson.M{
+		"eventId":  eventId,
+		"threadId": bson.M{"$in": threadIds},
+	}
+
+	var results []Message
+
+	cur, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i Message
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+// EraseMessages erases the text of the messages and hides them.
+func (r *ServiceRepo) EraseMessages(ctx context.Context, ids []string) error {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	update := bson.M{
+		"$set": bson.M{
+			"hidden": true,
+			"text":   "",
+		},
+	}
+
+	_, err := collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUserAuditEntries returns what has been recorded about a user in the
+// audit logs of the given events, as the actor or the target, newest
+// first.
+func (r *ServiceRepo) GetUserAuditEntries(ctx context.Context, eventIds []string, uid string) ([]AuditEntry, error) {
+	collection := r.client.Database(r.dbName).Collection(auditCollection)
+
+	options := options.Find().SetSort(bson.M{"at": -1})
+
+	filter := bson.M{
+		"eventId": bson.M{"$in": eventIds},
+		"$or": bson.A{
+			bson.M{"actorId": uid},
+			bson.M{"targetId": uid},
+		},
+	}
+
+	var results []AuditEntry
+
+	cur, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for cur.Next(ctx) {
+		var i AuditEntry
+		err := cur.Decode(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, i)
+	}
+
+	return results, nil
+}
+
+func (r *ServiceRepo) HideMessage(ctx context.Context, id string) error {
+	collection := r.client.Database(r.dbName).Collection(messagesCollection)
+
+	update := bson.M{
+		"$set": bson.M{"hidden": true},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,454 @@
+// notify.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	NoticeKindCancellation string = "cancellation"
+	NoticeKindEnrollment   string = "enrollment"
+	NoticeKindMatch        string = "match"
+	NoticeKindReminder     string = "reminder"
+)
+
+const emailOptionKey string = "email"
+
+// smtpTimeout bounds sending an email, which gift reminders do from
+// scheduled jobs; like httpTimeout it must stay well below jobLease.
+const smtpTimeout time.Duration = 30 * time.Second
+
+const emailUsage string = "Usage: /santa email <address> | /santa email off"
+
+// Notice is a message for one participant. Text is what Slack shows, the
+// other fields let email templates lay the message out on their own.
+type Notice struct {
+	Details []string
+	Event   *Event
+	Giftees []NoticeGiftee
+	Kind    string
+	Subject string
+	Text    string
+	Title   string
+	To      *Participant
+}
+
+type NoticeGiftee struct {
+	Address  string
+	Name     string
+	Wishlist []string
+}
+
+// Notifier delivers notices to participants, e.g. on Slack or by email.
+// Notifiers return errNotReached for participants they cannot reach.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notice) error
+}
+
+// bulletLines splits the lines built for Slack messages, such as those of
+// eventDetails and wishlistLines, for templates.
+func bulletLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "•"))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func newNotice(kind string, e *Event, to *Participant, subject string, text string) *Notice {
+	return &Notice{
+		Details: bulletLines(eventDetails(e)),
+		Event:   e,
+		Kind:    kind,
+		Subject: subject,
+		Text:    text,
+		Title:   eventTitle(e),
+		To:      to,
+	}
+}
+
+// errNotReached is what notifiers return for participants they do not
+// reach, e.g. email for those who have not given their address, so that
+// Notifiers can tell them from those they delivered to.
+var errNotReached = errors.New("the notifier does not reach the participant")
+
+// DeliveryError lists the notifiers that failed to deliver a notice. It is
+// Partial when another notifier delivered it, so the participant has been
+// told all the same.
+type DeliveryError struct {
+	Failures []string
+	Partial  bool
+}
+
+func (e *DeliveryError) Error() string {
+	msg := strings.Join(e.Failures, "; ")
+	if e.Partial {
+		msg = "delivered, but " + msg
+	}
+	return msg
+}
+
+// partiallyDelivered tells whether err only means that some of the
+// notifiers failed to deliver a notice that the others did deliver.
+func partiallyDelivered(err error) bool {
+	var de *DeliveryError
+	return errors.As(err, &de) && de.Partial
+}
+
+func notifierName(n Notifier) string {
+	switch n.(type) {
+	case *DiscordNotifier:
+		return "Discord"
+	case *EmailNotifier:
+		return "email"
+	case *MattermostNotifier:
+		return "Mattermost"
+	case *SlackNotifier:
+		return "Slack"
+	case *TeamsNotifier:
+		return "Teams"
+	}
+	return "notifier"
+}
+
+// Notifiers delivers notices through each of its notifiers in turn. A
+// notifier failing does not keep the others from delivering, and the
+// DeliveryError it returns tells whether any of them did. If none of them
+// reaches the participant, it returns errNotReached.
+type Notifiers []Notifier
+
+func (ns Notifiers) Notify(ctx context.Context, n *Notice) error {
+	var failures []string
+	delivered := false
+	for _, notifier := range ns {
+		err := notifier.Notify(ctx, n)
+		switch {
+		case err == errNotReached:
+		case err != nil:
+			failures = append(failures, notifierName(notifier)+": "+err.Error())
+		default:
+			delivered = true
+		}
+	}
+	if len(failures) > 0 {
+		return &DeliveryError{Failures: failures, Partial: delivered}
+	}
+	if !delivered {
+		return errNotReached
+	}
+	return nil
+}
+
+// SlackNotifier DMs the participants of Slack events with the bot token,
+// or, without one, answers on the response URL of their last command.
+type SlackNotifier struct {
+	token string
+}
+
+func NewSlackNotifier(token string) *SlackNotifier {
+	return &SlackNotifier{token: token}
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, notice *Notice) error {
+	if eventPlatform(notice.Event) != PlatformSlack {
+		return errNotReached
+	}
+	if n.token == "" {
+		if notice.To.ResponseUrl == "" {
+			return errors.New("no way to reach " + notice.To.UserId + " on Slack")
+		}
+		return SendSlackMessage(notice.To.ResponseUrl, ResponseTypeEphemeral, notice.Text)
+	}
+	_, err := PostSlackMessage(n.token, notice.To.UserId, notice.Text)
+	return err
+}
+
+//go:embed templates
+var templateFiles embed.FS
+
+// EmailNotifier emails participants who have given an email address,
+// rendering each kind of notice with its own HTML and text template.
+type EmailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	host string
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// NewEmailNotifier returns an email notifier sending through the given
+// SMTP server, or nil if no server is configured. Without a username no
+// authentication is attempted, e.g. for a local SMTP sink.
+func NewEmailNotifier(host string, port string, username string, password string, from string) (*EmailNotifier, error) {
+	if host == "" {
+		return nil, nil
+	}
+	if from == "" {
+		return nil, errors.New("a sender address is needed to send email")
+	}
+
+	html, err := htmltemplate.ParseFS(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFS(templateFiles, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &EmailNotifier{
+		addr: host + ":" + port,
+		auth: auth,
+		from: from,
+		host: host,
+		html: html,
+		text: text,
+	}, nil
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, notice *Notice) error {
+	if notice.To == nil || notice.To.Email == nil {
+		return errNotReached
+	}
+
+	var text, html bytes.Buffer
+	err := n.text.ExecuteTemplate(&text, notice.Kind+".txt", notice)
+	if err != nil {
+		return err
+	}
+	err = n.html.ExecuteTemplate(&html, notice.Kind+".html", notice)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 12)
+	_, err = rand.Read(b)
+	if err != nil {
+		return err
+	}
+	boundary := hex.EncodeToString(b)
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + n.from + "\r\n")
+	msg.WriteString("To: " + *notice.To.Email + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", notice.Subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n")
+	msg.WriteString("--" + boundary + "\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.Write(text.Bytes())
+	msg.WriteString("\r\n--" + boundary + "\r\nContent-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.Write(html.Bytes())
+	msg.WriteString("\r\n--" + boundary + "--\r\n")
+
+	return n.send(ctx, *notice.To.Email, msg.Bytes())
+}
+
+// send sends the message to the address. Unlike smtp.SendMail it gives up
+// once ctx is done or smtpTimeout has passed, so that an SMTP server that
+// stops answering cannot hold up the job sending the notice. STARTTLS is
+// used whenever the server offers it.
+func (n *EmailNotifier) send(ctx context.Context, to string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: n.host})
+		if err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("the SMTP server does not support authentication")
+		}
+		err = c.Auth(n.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(n.from)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// enrollmentNotice confirms to a participant that they have enrolled.
+func enrollmentNotice(e *Event, p *Participant) *Notice {
+	text := "You are enrolled in " + eventTitle(e) + ". Your gift will be sent to " + addressOf(p) + ", and you will hear who you are buying for once the pairs are drawn." + eventDetails(e)
+	return newNotice(NoticeKindEnrollment, e, p, "You are enrolled in "+eventTitle(e), text)
+}
+
+// matchNotice tells a santa who their giftees are, see assignmentMessage.
+func matchNotice(e *Event, p *Participant, wishlists map[string]*Wishlist) *Notice {
+	n := newNotice(NoticeKindMatch, e, p, "Your "+eventTitle(e)+" match", assignmentMessage(e, p, wishlists))
+	for _, m := range giftees(p) {
+		address := ""
+		if m.Address != nil {
+			address = *m.Address
+		}
+		name := m.Name
+		if name == "" {
+			name = m.UserId
+		}
+		n.Giftees = append(n.Giftees, NoticeGiftee{
+			Address:  address,
+			Name:     name,
+			Wishlist: bulletLines(wishlistLines(wishlists[m.UserId])),
+		})
+	}
+	return n
+}
+
+// reminderNotice nudges a santa whose gift has not been marked as sent.
+func reminderNotice(e *Event, p *Participant) *Notice {
+	text := "Friendly reminder: " + eventTitle(e) + " gifts are exchanged on " + e.ExchangeDate.Format(dateLayout) + " and your gift has not been marked as sent yet."
+	return newNotice(NoticeKindReminder, e, p, "Reminder: "+eventTitle(e)+" gifts are exchanged on "+e.ExchangeDate.Format(dateLayout), text)
+}
+
+// cancellationNotice tells a participant that the event has been
+// cancelled, by whom is up to the text.
+func cancellationNotice(e *Event, p *Participant, text string) *Notice {
+	return newNotice(NoticeKindCancellation, e, p, eventTitle(e)+" has been cancelled", text)
+}
+
+func addressOf(p *Participant) string {
+	if p.Address == nil {
+		return ""
+	}
+	return *p.Address
+}
+
+// parseEmail checks an email address given by a participant. It returns
+// nil if none was given.
+func parseEmail(s string) (*string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return nil, invalidError(s + " is not a valid email address")
+	}
+	return &addr.Address, nil
+}
+
+// emailCommand shows or sets the address a participant is emailed at, in
+// addition to Slack.
+func (h *Handlers) emailCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	p, err := h.repo.GetParticipantById(r.Context(), e.Id, req.UserId)
+	if err != nil {
+		err = errors.New("You are not taking part in " + eventTitle(e) + ", please enroll with /participate first")
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if len(args) == 0 {
+		if p.Email == nil {
+			writeSlackMessage(w, ResponseTypeEphemeral, "You are only notified on Slack about "+eventTitle(e)+". "+emailUsage)
+			return
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, "You are notified about "+eventTitle(e)+" at "+*p.Email+" too. "+emailUsage)
+		return
+	}
+	if len(args) > 1 {
+		writeSlackMessage(w, ResponseTypeEphemeral, emailUsage)
+		return
+	}
+
+	var email *string
+	if strings.ToLower(args[0]) != "off" {
+		// Slack turns typed addresses into mailto links.
+		address := strings.Trim(args[0], "<>")
+		if i := strings.Index(address, "|"); i >= 0 {
+			address = address[i+1:]
+		}
+		email, err = parseEmail(strings.TrimPrefix(address, "mailto:"))
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+	}
+
+	err = h.repo.UpdateEmail(r.Context(), e.Id, req.UserId, email)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if email == nil {
+		writeSlackMessage(w, ResponseTypeEphemeral, "You will no longer be emailed about "+eventTitle(e)+".")
+		return
+	}
+	writeSlackMessage(w, ResponseTypeEphemeral, "You will be notified about "+eventTitle(e)+" at "+*email+" too.")
+}
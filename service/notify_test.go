@@ -0,0 +1,236 @@
+// notify_test.go
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notifierFunc turns a function into a Notifier.
+type notifierFunc func(ctx context.Context, n *Notice) error
+
+func (f notifierFunc) Notify(ctx context.Context, n *Notice) error {
+	return f(ctx, n)
+}
+
+func TestNotifiers(t *testing.T) {
+	delivered := func(ctx context.Context, n *Notice) error { return nil }
+	failed := func(ctx context.Context, n *Notice) error { return errors.New("smtp: connection refused") }
+	notReached := func(ctx context.Context, n *Notice) error { return errNotReached }
+
+	tests := []struct {
+		name           string
+		notifiers      []notifierFunc
+		wantErr        bool
+		wantNotReached bool
+		wantPartial    bool
+	}{
+		{name: "none", notifiers: nil, wantErr: true, wantNotReached: true},
+		{name: "delivered", notifiers: []notifierFunc{delivered, delivered}},
+		{name: "delivered by one", notifiers: []notifierFunc{notReached, delivered}},
+		{name: "none reached", notifiers: []notifierFunc{notReached, notReached}, wantErr: true, wantNotReached: true},
+		{name: "one fails", notifiers: []notifierFunc{failed, delivered}, wantErr: true, wantPartial: true},
+		{name: "one fails, one not reached", notifiers: []notifierFunc{notReached, failed, delivered}, wantErr: true, wantPartial: true},
+		{name: "all fail", notifiers: []notifierFunc{failed, notReached}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var ns Notifiers
+			for _, fn := range tt.notifiers {
+				fn := fn
+				ns = append(ns, notifierFunc(func(ctx context.Context, n *Notice) error {
+					calls++
+					return fn(ctx, n)
+				}))
+			}
+
+			err := ns.Notify(context.Background(), &Notice{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (err == errNotReached) != tt.wantNotReached {
+				t.Errorf("Notify() error = %v, want errNotReached %v", err, tt.wantNotReached)
+			}
+			if partiallyDelivered(err) != tt.wantPartial {
+				t.Errorf("partiallyDelivered(%v) = %v, want %v", err, !tt.wantPartial, tt.wantPartial)
+			}
+			if calls != len(tt.notifiers) {
+				t.Errorf("%d notifiers were called, want %d", calls, len(tt.notifiers))
+			}
+		})
+	}
+}
+
+func TestBulletLines(t *testing.T) {
+	got := bulletLines("\nBudget: 25 EUR\n• Wishes: Books\n\n•  Sizes: M")
+	if want := []string{"Budget: 25 EUR", "Wishes: Books", "Sizes: M"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bulletLines() = %q, want %q", got, want)
+	}
+}
+
+func TestParseEmail(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"jane@example.com", "jane@example.com", false},
+		{"Jane <jane@example.com>", "jane@example.com", false},
+		{"jane", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseEmail(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil && tt.want != "") || (got != nil && *got != tt.want) {
+				t.Errorf("parseEmail() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEmailTemplates renders every kind of notice with both templates.
+func TestEmailTemplates(t *testing.T) {
+	n, err := NewEmailNotifier("localhost", "1025", "", "", "santa@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+	giftee := "U2"
+	e := &Event{Year: 2026, Budget: new(float64), ExchangeDate: &exchange}
+	p := &Participant{UserId: "U1", Address: optionalString("1 Main St"), IsMatched: true, YourMatchId: &giftee, YourMatchName: optionalString("Jane"), YourMatchAddress: optionalString("2 Main St")}
+	wishlists := map[string]*Wishlist{giftee: {Items: optionalString("Books")}}
+
+	notices := []*Notice{enrollmentNotice(e, p), matchNotice(e, p, wishlists), reminderNotice(e, p)}
+	for _, notice := range notices {
+		t.Run(notice.Kind, func(t *testing.T) {
+			var text, html bytes.Buffer
+			if err := n.text.ExecuteTemplate(&text, notice.Kind+".txt", notice); err != nil {
+				t.Fatal(err)
+			}
+			if err := n.html.ExecuteTemplate(&html, notice.Kind+".html", notice); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(text.String(), notice.Title) || !strings.Contains(html.String(), notice.Title) {
+				t.Errorf("%s templates do not name the event", notice.Kind)
+			}
+		})
+	}
+
+	if got := matchNotice(e, p, wishlists).Giftees; len(got) != 1 || got[0].Name != "Jane" || got[0].Address != "2 Main St" || !reflect.DeepEqual(got[0].Wishlist, []string{"Wishes: Books"}) {
+		t.Errorf("matchNotice() giftees = %+v", got)
+	}
+}
+
+func TestEmailNotifierWithoutAddress(t *testing.T) {
+	n, err := NewEmailNotifier("localhost", "1025", "", "", "santa@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), &Notice{To: &Participant{UserId: "U1"}}); err != errNotReached {
+		t.Errorf("Notify() without an email address = %v, want %v", err, errNotReached)
+	}
+
+	if _, err := NewEmailNotifier("localhost", "1025", "", "", ""); err == nil {
+		t.Error("NewEmailNotifier() without a sender returned no error")
+	}
+}
+
+// serveSmtp answers an SMTP client on conn well enough for it to send one
+// message, and returns the message. A silent server never greets.
+func serveSmtp(conn net.Conn, silent bool) string {
+	defer conn.Close()
+	if silent {
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+		return ""
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return data.String()
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+		case "EHLO":
+			reply("250 localhost")
+		case "DATA":
+			reply("354 go ahead")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return data.String()
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmailNotifierSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		silent  bool
+		wantErr bool
+	}{
+		{"sends", false, false},
+		{"gives up on a silent server", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			sent := make(chan string, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					sent <- ""
+					return
+				}
+				sent <- serveSmtp(conn, tt.silent)
+			}()
+
+			host, port, _ := net.SplitHostPort(l.Addr().String())
+			n, err := NewEmailNotifier(host, port, "", "", "santa@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err = n.send(ctx, "ann@example.com", []byte("Subject: Hello\r\n\r\nHi Ann\r\n"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := <-sent; !tt.wantErr && !strings.Contains(got, "Hi Ann") {
+				t.Errorf("server received %q", got)
+			}
+		})
+	}
+}
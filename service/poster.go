@@ -0,0 +1,92 @@
+// poster.go
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// errNotPosted is what posters return for events of platforms they do not
+// post to, so that ChannelPosters can pick the one that does.
+var errNotPosted = errors.New("no poster posts to the channel of the event")
+
+// ChannelPoster posts messages to the channel of an event on its chat
+// platform, e.g. reminders and the reveal.
+type ChannelPoster interface {
+	// Post posts the message, in reply to the post replyTo if given, and
+	// returns the ID of the new post.
+	Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error)
+}
+
+// ChannelPosters posts through the first of its posters that posts to the
+// platform of the event.
+type ChannelPosters []ChannelPoster
+
+func (ps ChannelPosters) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	for _, p := range ps {
+		id, err := p.Post(ctx, e, msg, replyTo)
+		if err != errNotPosted {
+			return id, err
+		}
+	}
+	return "", errors.New("no poster posts to " + eventPlatform(e) + " channels")
+}
+
+// SlackPoster posts to the channels of Slack events with the bot token.
+type SlackPoster struct {
+	token string
+}
+
+func NewSlackPoster(token string) *SlackPoster {
+	return &SlackPoster{token: token}
+}
+
+func (p *SlackPoster) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	if eventPlatform(e) != PlatformSlack {
+		return "", errNotPosted
+	}
+
+	var res *SlackApiResponse
+	var err error
+	if replyTo == "" {
+		res, err = PostSlackMessage(p.token, value(e.ChannelId), msg)
+	} else {
+		res, err = PostSlackReply(p.token, value(e.ChannelId), replyTo, msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.Ts, nil
+}
+
+// channelNotice puts the mention that calls everybody in the channel of
+// the event in front of msg, on the platforms that have one.
+func channelNotice(e *Event, msg string) string {
+	switch eventPlatform(e) {
+	case PlatformDiscord:
+		return "@everyone " + msg
+	case PlatformMattermost:
+		return "@channel " + msg
+	case PlatformTeams:
+		return msg
+	default:
+		return "<!channel> " + msg
+	}
+}
+
+// userMention mentions a user in a post to the channel of the event.
+// Mattermost mentions users by name, and Teams only with entities sent
+// along, so the name is written out there.
+func userMention(e *Event, uid string, name string) string {
+	if name == "" {
+		name = uid
+	}
+	switch eventPlatform(e) {
+	case PlatformMattermost:
+		return "@" + name
+	case PlatformTeams:
+		return name
+	default:
+		return "<@" + uid + ">"
+	}
+}
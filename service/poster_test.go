@@ -0,0 +1,124 @@
+// poster_test.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// posterFunc turns a function into a ChannelPoster.
+type posterFunc func(ctx context.Context, e *Event, msg string, replyTo string) (string, error)
+
+func (f posterFunc) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	return f(ctx, e, msg, replyTo)
+}
+
+func TestChannelPosters(t *testing.T) {
+	poster := func(platform string) ChannelPoster {
+		return posterFunc(func(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+			if eventPlatform(e) != platform {
+				return "", errNotPosted
+			}
+			return platform + " post", nil
+		})
+	}
+	ps := ChannelPosters{poster(PlatformSlack), poster(PlatformTeams)}
+
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  bool
+	}{
+		{"", "slack post", false},
+		{PlatformTeams, "teams post", false},
+		{PlatformDiscord, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := ps.Post(context.Background(), &Event{Platform: tt.platform}, "Hello", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Post() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Post() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelNotice(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+	}{
+		{PlatformSlack, "<!channel> Hello"},
+		{PlatformDiscord, "@everyone Hello"},
+		{PlatformMattermost, "@channel Hello"},
+		{PlatformTeams, "Hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			if got := channelNotice(&Event{Platform: tt.platform}, "Hello"); got != tt.want {
+				t.Errorf("channelNotice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserMention(t *testing.T) {
+	tests := []struct {
+		platform string
+		name     string
+		want     string
+	}{
+		{PlatformSlack, "ann", "<@U1>"},
+		{PlatformDiscord, "ann", "<@U1>"},
+		{PlatformMattermost, "ann", "@ann"},
+		{PlatformMattermost, "", "@U1"},
+		{PlatformTeams, "Ann Lee", "Ann Lee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform+" "+tt.name, func(t *testing.T) {
+			if got := userMention(&Event{Platform: tt.platform}, "U1", tt.name); got != tt.want {
+				t.Errorf("userMention() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMattermostPoster(t *testing.T) {
+	var posts []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v4/posts" {
+			t.Errorf("request %s %s, want POST /api/v4/posts", r.Method, r.URL.Path)
+		}
+		var post map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&post)
+		posts = append(posts, post)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "P1"})
+	}))
+	defer server.Close()
+
+	p := NewMattermostPoster(NewMattermostClient(server.URL, "bot", "token"))
+	e := &Event{ChannelId: String("C1"), Platform: PlatformMattermost}
+
+	if _, err := p.Post(context.Background(), &Event{}, "Hello", ""); err != errNotPosted {
+		t.Errorf("Post() to a Slack event error = %v, want errNotPosted", err)
+	}
+
+	id, err := p.Post(context.Background(), e, "Revealed", "")
+	if err != nil || id != "P1" {
+		t.Fatalf("Post() = %q, %v, want P1", id, err)
+	}
+	_, err = p.Post(context.Background(), e, "Thanks", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 || posts[0]["channel_id"] != "C1" || posts[0]["root_id"] != "" || posts[1]["root_id"] != "P1" || posts[1]["message"] != "Thanks" {
+		t.Errorf("posts = %v", posts)
+	}
+}
@@ -0,0 +1,515 @@
+// privacy.go
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const privacyUsage string = "Usage: /santa my-data | /santa forget-me [confirm]"
+
+// ForgottenName replaces the name of a forgotten participant wherever it
+// has to stay, e.g. in the pairs of an event that has been matched.
+const ForgottenName string = "Forgotten participant"
+
+const (
+	PrivacyActionForget string = "forget"
+	PrivacyActionLookup string = "lookupData"
+)
+
+const (
+	UserRoleCoHost      string = "coHost"
+	UserRoleDeclined    string = "declined"
+	UserRoleInvited     string = "invited"
+	UserRoleOwner       string = "owner"
+	UserRoleParticipant string = "participant"
+)
+
+// userRecord is an event a user has a part in, with their participant
+// record if they take part. Events that only have a yearly participants
+// collection are not stored, so they cannot be locked.
+type userRecord struct {
+	event       Event
+	participant *Participant
+	stored      bool
+}
+
+// userRecords returns the events of the team the user has a part in,
+// including the yearly participants collections of past years that
+// predate the events collection.
+func (s *SecretSanta) userRecords(ctx context.Context, teamId *string, uid string) ([]userRecord, error) {
+	events, err := s.repo.FindTeamEvents(ctx, teamId)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool)
+	for _, e := range events {
+		stored[e.Id] = true
+	}
+
+	names, err := s.repo.FindLegacyCollections(ctx, teamId)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if stored[name] {
+			continue
+		}
+		// See collectionName.
+		parts := strings.Split(name, "_")
+		y, _ := strconv.Atoi(parts[3])
+		e := Event{
+			Id:        name,
+			ChannelId: String(parts[2]),
+			TeamId:    teamId,
+			Year:      y,
+		}
+		if parts[0] != "" {
+			e.EnterpriseId = String(parts[0])
+		}
+		events = append(events, e)
+	}
+
+	var records []userRecord
+	for _, e := range events {
+		p, err := s.repo.GetParticipantById(ctx, e.Id, uid)
+		if err != nil {
+			p = nil
+		}
+		if p == nil && len(userRoles(&e, nil, uid)) == 0 && len(excludedIds(&e, uid)) == 0 {
+			continue
+		}
+		records = append(records, userRecord{event: e, participant: p, stored: stored[e.Id]})
+	}
+	return records, nil
+}
+
+func userRoles(e *Event, p *Participant, uid string) []string {
+	var roles []string
+	if p != nil {
+		roles = append(roles, UserRoleParticipant)
+	}
+	if e.OwnerId == uid {
+		roles = append(roles, UserRoleOwner)
+	}
+	if containsUser(e.CoHostIds, uid) {
+		roles = append(roles, UserRoleCoHost)
+	}
+	if containsUser(e.InvitedIds, uid) {
+		roles = append(roles, UserRoleInvited)
+	}
+	if containsUser(e.OptedOutIds, uid) {
+		roles = append(roles, UserRoleDeclined)
+	}
+	return roles
+}
+
+// excludedIds returns whom the user must not be paired with in the event.
+func excludedIds(e *Event, uid string) []string {
+	var ids []string
+	for _, x := range e.Exclusions {
+		if x.FirstId == uid {
+			ids = append(ids, x.SecondId)
+		} else if x.SecondId == uid {
+			ids = append(ids, x.FirstId)
+		}
+	}
+	return ids
+}
+
+// userThreads returns the conversations the participant has with their
+// giftees and their santas, telling for each whether they are the santa
+// in it. It opens the participant's matches.
+func (s *SecretSanta) userThreads(ctx context.Context, e *Event, p *Participant) (map[string]bool, error) {
+	threads := make(map[string]bool)
+
+	s.openMatches(e, p)
+	for _, m := range giftees(p) {
+		threads[s.threadId(e.Id, p.UserId, m.UserId)] = true
+	}
+
+	santas, err := s.getSantas(ctx, e, p.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, santa := range santas {
+		threads[s.threadId(e.Id, santa.UserId, p.UserId)] = false
+	}
+	return threads, nil
+}
+
+func (s *SecretSanta) threadMessages(ctx context.Context, e *Event, threads map[string]bool) ([]Message, error) {
+	if len(threads) == 0 {
+		return nil, nil
+	}
+
+	var ids []string
+	for id := range threads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return s.repo.GetThreadMessages(ctx, e.Id, ids)
+}
+
+// MyData returns everything stored about the caller in the events of
+// their workspace, see personalData.
+func (s *SecretSanta) MyData(ctx context.Context, c *Caller) (*PersonalData, error) {
+	return s.personalData(ctx, c.TeamId, c.UserId, c.UserId)
+}
+
+// FindPersonalData returns everything stored about a user for the
+// operators, e.g. to answer a request sent by email. Their giftees are
+// left out until the pairs have been revealed, and the lookup is recorded
+// in the audit log of each event.
+func (s *SecretSanta) FindPersonalData(ctx context.Context, teamId string, uid string) (*PersonalData, error) {
+	if teamId == "" {
+		return nil, invalidError("Please give the ID of the user's workspace")
+	}
+	return s.personalData(ctx, String(teamId), uid, OperatorId)
+}
+
+// personalData gathers what the user has told about themselves in every
+// event of the team, their part in it, their anonymous conversations and
+// what the audit logs recorded about them. Their own giftees are
+// included, their santas are not; for anybody but the user, giftees are
+// only included once revealed, and the lookup is audited.
+func (s *SecretSanta) personalData(ctx context.Context, teamId *string, uid string, actorId string) (*PersonalData, error) {
+	records, err := s.userRecords(ctx, teamId, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &PersonalData{
+		Audit:    []AuditEntry{},
+		Events:   []UserEvent{},
+		Messages: []UserMessage{},
+		TeamId:   teamId,
+		UserId:   uid,
+	}
+	var ids []string
+	for i := range records {
+		e := &records[i].event
+		p := records[i].participant
+		ids = append(ids, e.Id)
+
+		ue := UserEvent{
+			Event:       apiEvent(e),
+			ExcludedIds: excludedIds(e, uid),
+			Roles:       userRoles(e, p, uid),
+		}
+		if actorId != uid {
+			s.audit(ctx, e, actorId, PrivacyActionLookup, uid, "")
+		}
+		if p == nil {
+			data.Events = append(data.Events, ue)
+			continue
+		}
+
+		threads, err := s.userThreads(ctx, e, p)
+		if err != nil {
+			return nil, err
+		}
+		x := exportParticipant(p, actorId == uid || e.Status == EventStatusArchived)
+		ue.Participant = &x
+		data.Events = append(data.Events, ue)
+
+		messages, err := s.threadMessages(ctx, e, threads)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			data.Messages = append(data.Messages, UserMessage{
+				At:      m.At,
+				EventId: m.EventId,
+				Hidden:  m.Hidden,
+				Sent:    m.FromSanta == threads[m.ThreadId],
+				Text:    m.Text,
+			})
+		}
+	}
+
+	if len(ids) > 0 {
+		entries, err := s.repo.GetUserAuditEntries(ctx, ids, uid)
+		if err != nil {
+			return nil, err
+		}
+		data.Audit = append(data.Audit, entries...)
+	}
+	return data, nil
+}
+
+// ForgetMe erases the caller from the events of their workspace, see
+// forgetUser.
+func (s *SecretSanta) ForgetMe(ctx context.Context, c *Caller) (*ForgetReport, error) {
+	return s.forgetUser(ctx, c.TeamId, c.UserId, c.UserId, "")
+}
+
+// ForgetUser erases a user from the events of a workspace on behalf of
+// the operators, e.g. when they have asked for it by email. The reason is
+// recorded in the audit log.
+func (s *SecretSanta) ForgetUser(ctx context.Context, teamId string, uid string, reason string) (*ForgetReport, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, invalidError("Please give a reason, it is recorded in the audit log")
+	}
+	if teamId == "" {
+		return nil, invalidError("Please give the ID of the user's workspace")
+	}
+	return s.forgetUser(ctx, String(teamId), uid, OperatorId, reason)
+}
+
+// forgetUser erases what the user has told about themselves in every event
+// of the team. They are taken out of events whose pairs have not been
+// drawn yet; elsewhere somebody gives them a gift or they give one, so
+// their record stays without their address, email, wishlist and name,
+// and so do the copies their santas keep. Their anonymous conversations
+// are erased, invitations and exclusions dropped. Their user ID stays
+// where the event needs it: as a host, in the pairs, among those who
+// declined so they are not invited again, and in the audit logs. If it
+// fails halfway, running it again picks up where it stopped.
+func (s *SecretSanta) forgetUser(ctx context.Context, teamId *string, uid string, actorId string, details string) (*ForgetReport, error) {
+	records, err := s.userRecords(ctx, teamId, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ForgetReport{}
+	for i := range records {
+		err = s.forgetInEvent(ctx, &records[i], uid, actorId, details, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (s *SecretSanta) forgetInEvent(ctx context.Context, r *userRecord, uid string, actorId string, details string, report *ForgetReport) error {
+	e := &r.event
+	if r.stored {
+		var err error
+		e, err = s.lockEvent(ctx, e.Id, func(e *Event) error {
+			e.InvitedIds = withoutUser(e.InvitedIds, uid)
+			var exclusions []Exclusion
+			for _, x := range e.Exclusions {
+				if x.FirstId != uid && x.SecondId != uid {
+					exclusions = append(exclusions, x)
+				}
+			}
+			e.Exclusions = exclusions
+			if e.Pending != nil && e.Pending.UserId == uid {
+				e.Pending = nil
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		defer s.unlockEvent(ctx, e.Id, nil)
+	}
+	report.Events++
+
+	p, err := s.repo.GetParticipantById(ctx, e.Id, uid)
+	if err != nil {
+		s.audit(ctx, e, actorId, PrivacyActionForget, uid, details)
+		return nil
+	}
+
+	threads, err := s.userThreads(ctx, e, p)
+	if err != nil {
+		return err
+	}
+	messages, err := s.threadMessages(ctx, e, threads)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, m := range messages {
+		ids = append(ids, m.Id)
+	}
+	if len(ids) > 0 {
+		err = s.repo.EraseMessages(ctx, ids)
+		if err != nil {
+			return err
+		}
+		report.Messages += len(ids)
+	}
+
+	if !p.IsMatched && (e.Status == "" || e.Status == EventStatusOpen) {
+		err = s.repo.RemoveParticipant(ctx, e.Id, uid)
+		if err != nil {
+			return err
+		}
+		report.Removed++
+		s.audit(ctx, e, actorId, PrivacyActionForget, uid, details)
+		return nil
+	}
+
+	err = s.repo.AnonymizeParticipant(ctx, e.Id, uid, ForgottenName)
+	if err != nil {
+		return err
+	}
+	report.Anonymized++
+
+	copies, err := s.repo.AnonymizeMatchCopies(ctx, e.Id, uid, ForgottenName)
+	if err != nil {
+		return err
+	}
+	report.SantaCopies += int(copies)
+
+	sealed, err := s.forgetSealedCopies(ctx, e, uid)
+	if err != nil {
+		return err
+	}
+	report.SantaCopies += sealed
+
+	s.audit(ctx, e, actorId, PrivacyActionForget, uid, details)
+	return nil
+}
+
+// forgetSealedCopies reseals the matches of the user's santas without the
+// user's address and name, and returns how many santas it resealed.
+func (s *SecretSanta) forgetSealedCopies(ctx context.Context, e *Event, uid string) (int, error) {
+	if s.keys == nil {
+		return 0, nil
+	}
+
+	santas, err := s.getSantas(ctx, e, uid)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range santas {
+		santa := &santas[i]
+		if santa.SealedMatches == "" {
+			continue
+		}
+		s.openMatches(e, santa)
+		matches := giftees(santa)
+		if len(matches) == 0 {
+			continue
+		}
+
+		for j := range matches {
+			if matches[j].UserId == uid {
+				matches[j].Address = nil
+				matches[j].Name = ForgottenName
+			}
+		}
+		sealed, err := s.keys.sealMatches(e.Id, santa.UserId, matches)
+		if err != nil {
+			return count, err
+		}
+		err = s.repo.SealParticipantMatches(ctx, e.Id, santa.UserId, sealed, santa.SantaTags)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// myDataCommand shows the caller what is stored about them. The web UI
+// offers the same as a JSON download.
+func (h *Handlers) myDataCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	data, err := h.MyData(r.Context(), &req.Caller)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if len(data.Events) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, "Secret Santa stores nothing about you in this workspace.")
+		return
+	}
+
+	lines := []string{"This is what Secret Santa stores about you in this workspace:"}
+	for _, ue := range data.Events {
+		title := eventTitle(&Event{Name: ue.Event.Name, Year: ue.Event.Year})
+		lines = append(lines, "*"+title+"* ("+ue.Event.Status+"), you are: "+strings.Join(ue.Roles, ", "))
+		if len(ue.ExcludedIds) > 0 {
+			lines = append(lines, "• Not to be paired with: <@"+strings.Join(ue.ExcludedIds, ">, <@")+">")
+		}
+		x := ue.Participant
+		if x == nil {
+			continue
+		}
+		lines = append(lines, "• Name: "+x.UserName)
+		if x.Address != nil {
+			lines = append(lines, "• Address: "+*x.Address)
+		}
+		if x.Email != nil {
+			lines = append(lines, "• Email: "+*x.Email)
+		}
+		if x.Wishlist != nil {
+			lines = append(lines, "• Wishlist: "+strings.Join(wishlistFields(x.Wishlist), "; "))
+		}
+		if len(x.GifteeIds) > 0 {
+			lines = append(lines, "• You give a gift to: <@"+strings.Join(x.GifteeIds, ">, <@")+">")
+		}
+		if x.GiftStatus != "" {
+			lines = append(lines, "• Gift: "+x.GiftStatus)
+		}
+	}
+	lines = append(lines, strconv.Itoa(len(data.Messages))+" anonymous messages with your santas and giftees, "+strconv.Itoa(len(data.Audit))+" audit log entries.")
+	if h.web != nil {
+		lines = append(lines, "Download all of it, messages included, at "+h.web.baseUrl+"/web/my-data")
+	}
+	lines = append(lines, "To have it erased, use `/santa forget-me`.")
+	writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+}
+
+func wishlistFields(wl *ApiWishlist) []string {
+	var fields []string
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"wishes", wl.Items}, {"links", wl.Links}, {"sizes", wl.Sizes}, {"allergies", wl.Allergies}, {"please no", wl.NoThanks}} {
+		if f.value != nil {
+			fields = append(fields, f.name+": "+*f.value)
+		}
+	}
+	return fields
+}
+
+// forgetMeCommand erases the caller from every event of their workspace.
+// Without "confirm" it only tells them what would happen.
+func (h *Handlers) forgetMeCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) > 1 || (len(args) == 1 && strings.ToLower(args[0]) != "confirm") {
+		writeSlackMessage(w, ResponseTypeEphemeral, privacyUsage)
+		return
+	}
+
+	if len(args) == 0 {
+		data, err := h.MyData(r.Context(), &req.Caller)
+		if err != nil {
+			h.logger.Println(err)
+			writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+			return
+		}
+		if len(data.Events) == 0 {
+			writeSlackMessage(w, ResponseTypeEphemeral, "Secret Santa stores nothing about you in this workspace.")
+			return
+		}
+
+		msg := "This erases your address, email, wishlist and name from " + strconv.Itoa(len(data.Events)) + " Secret Santa events, including the copies your santas got, and your anonymous messages. " +
+			"You leave the events that have not been matched yet; where pairs are drawn, your gifts still go ahead under the name \"" + ForgottenName + "\". " +
+			"Events you host stay yours, hand them over with `/santa transfer` first if you like. It cannot be undone. To go ahead, type `/santa forget-me confirm`."
+		writeSlackMessage(w, ResponseTypeEphemeral, msg)
+		return
+	}
+
+	report, err := h.ForgetMe(r.Context(), &req.Caller)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	msg := "Done. You have been taken out of " + strconv.Itoa(report.Removed) + " events and anonymized in " + strconv.Itoa(report.Anonymized) +
+		", " + strconv.Itoa(report.SantaCopies) + " santas' copies of your address and " + strconv.Itoa(report.Messages) + " messages have been erased."
+	writeSlackMessage(w, ResponseTypeEphemeral, msg)
+}
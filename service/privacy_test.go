@@ -0,0 +1,106 @@
+// privacy_test.go
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUserRoles(t *testing.T) {
+	e := &Event{
+		CoHostIds:   []string{"U2"},
+		InvitedIds:  []string{"U3", "U4"},
+		OptedOutIds: []string{"U4"},
+		OwnerId:     "U1",
+	}
+	tests := []struct {
+		name string
+		p    *Participant
+		uid  string
+		want []string
+	}{
+		{"owner taking part", &Participant{UserId: "U1"}, "U1", []string{UserRoleParticipant, UserRoleOwner}},
+		{"co-host", nil, "U2", []string{UserRoleCoHost}},
+		{"invited", nil, "U3", []string{UserRoleInvited}},
+		{"invited and declined", nil, "U4", []string{UserRoleInvited, UserRoleDeclined}},
+		{"participant", &Participant{UserId: "U5"}, "U5", []string{UserRoleParticipant}},
+		{"stranger", nil, "U6", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userRoles(e, tt.p, tt.uid)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("userRoles(%q) = %q, want %q", tt.uid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludedIds(t *testing.T) {
+	e := &Event{Exclusions: []Exclusion{
+		{FirstId: "U1", SecondId: "U2"},
+		{FirstId: "U3", SecondId: "U1"},
+		{FirstId: "U2", SecondId: "U3"},
+	}}
+	tests := []struct {
+		name string
+		uid  string
+		want []string
+	}{
+		{"both sides", "U1", []string{"U2", "U3"}},
+		{"second side first", "U2", []string{"U1", "U3"}},
+		{"none", "U4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := excludedIds(e, tt.uid)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("excludedIds(%q) = %q, want %q", tt.uid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWishlistFields(t *testing.T) {
+	tests := []struct {
+		name string
+		wl   *ApiWishlist
+		want []string
+	}{
+		{"empty", &ApiWishlist{}, nil},
+		{
+			"some fields",
+			&ApiWishlist{Allergies: String("nuts"), Items: String("socks")},
+			[]string{"wishes: socks", "allergies: nuts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wishlistFields(tt.wl)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wishlistFields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOperatorLookupsNeedWorkspace checks that operators cannot look up
+// or erase a user across all workspaces at once.
+func TestOperatorLookupsNeedWorkspace(t *testing.T) {
+	s := &SecretSanta{}
+	ctx := context.Background()
+
+	_, err := s.FindPersonalData(ctx, "", "U1")
+	if ErrorKind(err) != ErrorKindInvalid {
+		t.Errorf("FindPersonalData() without a workspace error = %v, want an invalid error", err)
+	}
+	_, err = s.ForgetUser(ctx, "", "U1", "asked by email")
+	if ErrorKind(err) != ErrorKindInvalid {
+		t.Errorf("ForgetUser() without a workspace error = %v, want an invalid error", err)
+	}
+	_, err = s.ForgetUser(ctx, "T1", "U1", " ")
+	if ErrorKind(err) != ErrorKindInvalid {
+		t.Errorf("ForgetUser() without a reason error = %v, want an invalid error", err)
+	}
+}
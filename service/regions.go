@@ -0,0 +1,200 @@
+// regions.go
+package service
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countryAliases maps common ways of writing a country to one name, so
+// that e.g. "USA" and "United States" end up in the same region.
+var countryAliases = map[string]string{
+	"deutschland":              "germany",
+	"great britain":            "united kingdom",
+	"uk":                       "united kingdom",
+	"united states of america": "united states",
+	"us":                       "united states",
+	"usa":                      "united states",
+}
+
+// addressCountry guesses the country of a postal address from its last
+// line or comma separated part, which is where addresses usually end with
+// it. It is empty if the address is.
+func addressCountry(address *string) string {
+	if address == nil {
+		return ""
+	}
+
+	parts := strings.FieldsFunc(*address, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for i := len(parts) - 1; i >= 0; i-- {
+		country := strings.ToLower(strings.Trim(parts[i], " .\t\r"))
+		if country == "" {
+			continue
+		}
+		if alias, ok := countryAliases[country]; ok {
+			return alias
+		}
+		return country
+	}
+	return ""
+}
+
+// participantCountries maps each participant to the country of their
+// address.
+func participantCountries(participants []Participant) map[string]string {
+	countries := make(map[string]string)
+	for _, p := range participants {
+		countries[p.UserId] = addressCountry(p.Address)
+	}
+	return countries
+}
+
+// regionGroups splits the users by country. Countries with too few users
+// to be matched among themselves are put together in one group, which is
+// matched across borders. If even that group is too small, it joins the
+// smallest country that is large enough.
+func regionGroups(uids []string, countries map[string]string, k int) [][]string {
+	if k < 1 {
+		k = 1
+	}
+
+	byCountry := make(map[string][]string)
+	for _, uid := range uids {
+		country := countries[uid]
+		byCountry[country] = append(byCountry[country], uid)
+	}
+
+	var names []string
+	for country := range byCountry {
+		names = append(names, country)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(byCountry[names[i]]) != len(byCountry[names[j]]) {
+			return len(byCountry[names[i]]) < len(byCountry[names[j]])
+		}
+		return names[i] < names[j]
+	})
+
+	var groups [][]string
+	var mixed []string
+	for _, country := range names {
+		if len(byCountry[country]) < k+1 {
+			mixed = append(mixed, byCountry[country]...)
+			continue
+		}
+		groups = append(groups, byCountry[country])
+	}
+
+	switch {
+	case len(mixed) == 0:
+	case len(mixed) >= k+1 || len(groups) == 0:
+		groups = append(groups, mixed)
+	default:
+		groups[0] = append(groups[0], mixed...)
+	}
+	return groups
+}
+
+// matchByRegion matches users within their country where possible. If
+// exclusions rule out a draw within the groups, everybody is matched
+// together instead.
+func matchByRegion(rnd shuffler, uids []string, countries map[string]string, k int, excluded func(santa string, giftee string) bool) (map[string][]string, error) {
+	matches := make(map[string][]string)
+	for _, group := range regionGroups(uids, countries, k) {
+		m, err := matchParticipants(rnd, group, k, excluded)
+		if err != nil {
+			return matchParticipants(rnd, uids, k, excluded)
+		}
+		for santa, giftees := range m {
+			matches[santa] = giftees
+		}
+	}
+	return matches, nil
+}
+
+// crossBorderPairs counts the matches between users in different
+// countries.
+func crossBorderPairs(countries map[string]string, matches map[string][]string) int {
+	n := 0
+	for santa, giftees := range matches {
+		for _, giftee := range giftees {
+			if countries[santa] != countries[giftee] {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// regionsCommand previews region-aware matching: how many participants
+// live in each country and how many pairs would have to ship abroad.
+func (h *Handlers) regionsCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionRandomize)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	participants, err := h.repo.GetUnmatchedParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	countries := participantCountries(participants)
+	var uids []string
+	counts := make(map[string]int)
+	for _, p := range participants {
+		uids = append(uids, p.UserId)
+		counts[countries[p.UserId]]++
+	}
+	var names []string
+	for country := range counts {
+		names = append(names, country)
+	}
+	sort.Strings(names)
+
+	lines := []string{eventTitle(e) + " participants by country:"}
+	for _, country := range names {
+		name := country
+		if name == "" {
+			name = "(no address)"
+		}
+		lines = append(lines, "• "+name+": "+strconv.Itoa(counts[country]))
+	}
+
+	// The preview draw is thrown away, the real one happens on /randomize.
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	excluded := func(santa string, giftee string) bool {
+		return isExcluded(e, santa, giftee)
+	}
+	matches, err := matchByRegion(rnd, uids, countries, e.GifteesEach, excluded)
+	if err != nil {
+		lines = append(lines, err.Error())
+	} else {
+		lines = append(lines, "Matching by region would give about "+strconv.Itoa(crossBorderPairs(countries, matches))+" cross-border pairs.")
+	}
+
+	if e.MatchByRegion {
+		lines = append(lines, "Region-aware matching is on, turn it off with `/santa settings regions=off`.")
+	} else {
+		lines = append(lines, "Region-aware matching is off, turn it on with `/santa settings regions=on`.")
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+}
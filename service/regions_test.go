@@ -0,0 +1,96 @@
+// regions_test.go
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddressCountry(t *testing.T) {
+	tests := []struct {
+		address *string
+		want    string
+	}{
+		{nil, ""},
+		{optionalString("1 Main St, Springfield, USA"), "united states"},
+		{optionalString("Hauptstr. 1\n10115 Berlin\nDeutschland\n"), "germany"},
+		{optionalString("10 Downing St, London, UK."), "united kingdom"},
+		{optionalString("Rue de Rivoli, Paris, France"), "france"},
+		{optionalString(" , "), ""},
+	}
+
+	for _, tt := range tests {
+		name := "nil"
+		if tt.address != nil {
+			name = *tt.address
+		}
+		t.Run(name, func(t *testing.T) {
+			if got := addressCountry(tt.address); got != tt.want {
+				t.Errorf("addressCountry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionGroups(t *testing.T) {
+	participant := func(uid string, country string) Participant {
+		return Participant{UserId: uid, Address: optionalString("Somewhere, " + country)}
+	}
+
+	tests := []struct {
+		name         string
+		participants []Participant
+		k            int
+		want         [][]string
+	}{
+		{
+			name:         "every country large enough",
+			participants: []Participant{participant("U1", "France"), participant("U2", "Spain"), participant("U3", "France"), participant("U4", "Spain"), participant("U5", "Spain")},
+			k:            1,
+			want:         [][]string{{"U1", "U3"}, {"U2", "U4", "U5"}},
+		},
+		{
+			name:         "small countries matched together",
+			participants: []Participant{participant("U1", "France"), participant("U2", "Spain"), participant("U3", "Italy"), participant("U4", "Italy")},
+			k:            1,
+			want:         [][]string{{"U3", "U4"}, {"U1", "U2"}},
+		},
+		{
+			name:         "lone participant joins the smallest country",
+			participants: []Participant{participant("U1", "France"), participant("U2", "Spain"), participant("U3", "Spain"), participant("U4", "Italy"), participant("U5", "Italy"), participant("U6", "Italy")},
+			k:            1,
+			want:         [][]string{{"U2", "U3", "U1"}, {"U4", "U5", "U6"}},
+		},
+		{
+			name:         "too small for two gifts each",
+			participants: []Participant{participant("U1", "France"), participant("U2", "France"), participant("U3", "Spain")},
+			k:            2,
+			want:         [][]string{{"U3", "U1", "U2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var uids []string
+			for _, p := range tt.participants {
+				uids = append(uids, p.UserId)
+			}
+			if got := regionGroups(uids, participantCountries(tt.participants), tt.k); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("regionGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossBorderPairs(t *testing.T) {
+	participants := []Participant{
+		{UserId: "U1", Address: optionalString("Paris, France")},
+		{UserId: "U2", Address: optionalString("Lyon, France")},
+		{UserId: "U3", Address: optionalString("Madrid, Spain")},
+	}
+	matches := map[string][]string{"U1": {"U2"}, "U2": {"U3"}, "U3": {"U1"}}
+
+	if got := crossBorderPairs(participantCountries(participants), matches); got != 2 {
+		t.Errorf("crossBorderPairs() = %d, want 2", got)
+	}
+}
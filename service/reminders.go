@@ -0,0 +1,309 @@
+// reminders.go
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminders go out at this hour (UTC) on the day they are due.
+const reminderHour int = 9
+
+const remindersUsage string = "Usage: /santa reminders [enrollment YYYY-MM-DD [days before] | exchange YYYY-MM-DD | gifts <days before exchange> | reveal YYYY-MM-DD [thanks] | off enrollment|gifts|reveal]"
+
+func (h *Handlers) remindersCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if len(args) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, describeReminders(e))
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionUpdateReminders)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	e, err = h.updateEvent(r.Context(), e.Id, func(e *Event) error {
+		return updateReminders(e, args)
+	})
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionUpdateReminders, "", strings.Join(args, " "))
+
+	err = h.scheduleReminders(r.Context(), e)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, describeReminders(e))
+}
+
+func updateReminders(e *Event, args []string) error {
+	switch strings.ToLower(args[0]) {
+	case "enrollment":
+		if len(args) < 2 {
+			return errors.New(remindersUsage)
+		}
+		t, err := parseDate(args[1])
+		if err != nil {
+			return err
+		}
+		days := 1
+		if len(args) > 2 {
+			days, err = strconv.Atoi(args[2])
+			if err != nil || days < 0 {
+				return errors.New("Please provide the number of days before enrollment closes")
+			}
+		}
+		e.Reminders.EnrollmentClosesAt = &t
+		e.Reminders.EnrollmentDaysBefore = days
+	case "exchange":
+		if len(args) < 2 {
+			return errors.New(remindersUsage)
+		}
+		t, err := parseDate(args[1])
+		if err != nil {
+			return err
+		}
+		e.ExchangeDate = &t
+	case "gifts":
+		if len(args) < 2 {
+			return errors.New(remindersUsage)
+		}
+		days, err := strconv.Atoi(args[1])
+		if err != nil || days < 0 {
+			return errors.New("Please provide the number of days before the exchange date")
+		}
+		e.Reminders.GiftDaysBefore = &days
+	case "reveal":
+		if len(args) < 2 {
+			return errors.New(remindersUsage)
+		}
+		t, err := parseDate(args[1])
+		if err != nil {
+			return err
+		}
+		e.Reminders.ManualReveal = false
+		e.Reminders.RevealAt = &t
+		e.Reminders.RevealThanks = len(args) > 2 && strings.ToLower(args[2]) == "thanks"
+	case "off":
+		if len(args) < 2 {
+			return errors.New(remindersUsage)
+		}
+		switch strings.ToLower(args[1]) {
+		case "enrollment":
+			e.Reminders.EnrollmentClosesAt = nil
+		case "gifts":
+			e.Reminders.GiftDaysBefore = nil
+		case "reveal":
+			e.Reminders.ManualReveal = true
+			e.Reminders.RevealAt = nil
+		default:
+			return errors.New(remindersUsage)
+		}
+	default:
+		return errors.New(remindersUsage)
+	}
+	return nil
+}
+
+func describeReminders(e *Event) string {
+	lines := []string{eventTitle(e) + " reminders:"}
+
+	if t := reminderRunAt(e, JobKindEnrollmentReminder); t != nil {
+		lines = append(lines, "• Enrollment closes on "+e.Reminders.EnrollmentClosesAt.Format(dateLayout)+", the channel is reminded on "+t.Format(dateLayout))
+	} else {
+		lines = append(lines, "• Enrollment reminder is off")
+	}
+
+	if e.ExchangeDate != nil {
+		lines = append(lines, "• Gifts are exchanged on "+e.ExchangeDate.Format(dateLayout))
+	} else {
+		lines = append(lines, "• Exchange date is not set")
+	}
+
+	if t := reminderRunAt(e, JobKindGiftReminder); t != nil {
+		lines = append(lines, "• Santas who have not sent their gift yet are reminded on "+t.Format(dateLayout))
+	} else {
+		lines = append(lines, "• Gift reminder is off")
+	}
+
+	if t := reminderRunAt(e, JobKindRevealReminder); t != nil {
+		lines = append(lines, "• Pairs are revealed in the channel on "+t.Format(dateLayout))
+	} else {
+		lines = append(lines, "• Pairs are only revealed when a host types /santa reveal")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// reminderRunAt returns when the reminder of the given kind is due for the
+// event, or nil if it is not configured.
+func reminderRunAt(e *Event, kind string) *time.Time {
+	var t time.Time
+	switch kind {
+	case JobKindEnrollmentReminder:
+		if e.Reminders.EnrollmentClosesAt == nil {
+			return nil
+		}
+		t = e.Reminders.EnrollmentClosesAt.AddDate(0, 0, -e.Reminders.EnrollmentDaysBefore)
+	case JobKindGiftReminder:
+		if e.Reminders.GiftDaysBefore == nil || e.ExchangeDate == nil {
+			return nil
+		}
+		t = e.ExchangeDate.AddDate(0, 0, -*e.Reminders.GiftDaysBefore)
+	case JobKindRevealReminder:
+		// Pairs are revealed on the exchange date unless the hosts pick
+		// another day or reveal them by hand.
+		switch {
+		case e.Reminders.ManualReveal:
+			return nil
+		case e.Reminders.RevealAt != nil:
+			t = *e.Reminders.RevealAt
+		case e.ExchangeDate != nil:
+			t = *e.ExchangeDate
+		default:
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	t = time.Date(t.Year(), t.Month(), t.Day(), reminderHour, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func reminderJobId(eventId string, kind string, runAt time.Time) string {
+	return eventId + "_" + kind + "_" + runAt.Format(time.RFC3339)
+}
+
+// scheduleReminders brings the persisted jobs of the event in line with
+// its reminder settings.
+func (s *SecretSanta) scheduleReminders(ctx context.Context, e *Event) error {
+	for _, kind := range []string{JobKindEnrollmentReminder, JobKindGiftReminder, JobKindRevealReminder} {
+		err := s.repo.CancelPendingJobs(ctx, e.Id, kind)
+		if err != nil {
+			return err
+		}
+
+		runAt := reminderRunAt(e, kind)
+		if runAt == nil || runAt.Before(time.Now()) {
+			continue
+		}
+
+		err = s.repo.ScheduleJob(ctx, &Job{
+			Id:      reminderJobId(e.Id, kind, *runAt),
+			EventId: e.Id,
+			Kind:    kind,
+			RunAt:   *runAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reminderEvent loads the event of a reminder job and returns nil if the
+// reminder has been reconfigured since the job was scheduled.
+func (h *Handlers) reminderEvent(ctx context.Context, job *Job) (*Event, error) {
+	e, err := h.repo.GetEvent(ctx, job.EventId)
+	if err != nil {
+		return nil, err
+	}
+
+	runAt := reminderRunAt(e, job.Kind)
+	if runAt == nil || reminderJobId(e.Id, job.Kind, *runAt) != job.Id {
+		h.logger.Println("skipping outdated job", job.Id)
+		return nil, nil
+	}
+
+	return e, nil
+}
+
+func (h *Handlers) EnrollmentReminderJob(ctx context.Context, job *Job) error {
+	e, err := h.reminderEvent(ctx, job)
+	if err != nil || e == nil {
+		return err
+	}
+
+	msg := "Enrollment in " + eventTitle(e) + " closes on " + e.Reminders.EnrollmentClosesAt.Format(dateLayout) + ". Type /participate followed by your postal address to join!"
+	_, err = h.poster.Post(ctx, e, channelNotice(e, msg), "")
+	return err
+}
+
+func (h *Handlers) GiftReminderJob(ctx context.Context, job *Job) error {
+	e, err := h.reminderEvent(ctx, job)
+	if err != nil || e == nil {
+		return err
+	}
+
+	participants, err := h.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		return err
+	}
+
+	delivered := make(map[string]bool)
+	for _, uid := range job.Delivered {
+		delivered[uid] = true
+	}
+
+	for _, participant := range participants {
+		if !participant.IsMatched || isGiftSent(&participant) || delivered[participant.UserId] {
+			continue
+		}
+
+		err = h.notifier.Notify(ctx, reminderNotice(e, &participant))
+		if err == errNotReached {
+			// Trying again would not reach them either.
+			h.logger.Println("cannot remind", participant.UserId, "in", e.Id+":", err)
+			continue
+		}
+		if partiallyDelivered(err) {
+			h.logger.Println(err)
+		} else if err != nil {
+			return err
+		}
+
+		// Remember who has been reminded, so a retry does not DM them twice.
+		err = h.repo.MarkJobDelivered(ctx, job.Id, participant.UserId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevealReminderJob reveals the pairs of the event on reveal day.
+func (h *Handlers) RevealReminderJob(ctx context.Context, job *Job) error {
+	e, err := h.reminderEvent(ctx, job)
+	if err != nil || e == nil {
+		return err
+	}
+
+	if e.Status != EventStatusMatched {
+		h.logger.Println("not revealing", eventTitle(e), "in status", e.Status)
+		return nil
+	}
+
+	return h.reveal(ctx, e, "", e.Reminders.RevealThanks)
+}
@@ -0,0 +1,143 @@
+// reminders_test.go
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReminderRunAt(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, err := parseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		kind string
+		want string
+	}{
+		{"enrollment a day before", []string{"enrollment", "2026-12-01"}, JobKindEnrollmentReminder, "2026-11-30T09:00:00Z"},
+		{"enrollment days before", []string{"enrollment", "2026-12-01", "3"}, JobKindEnrollmentReminder, "2026-11-28T09:00:00Z"},
+		{"gifts without exchange date", []string{"gifts", "2"}, JobKindGiftReminder, ""},
+		{"reveal", []string{"reveal", "2026-12-24"}, JobKindRevealReminder, "2026-12-24T09:00:00Z"},
+		{"not configured", nil, JobKindRevealReminder, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{}
+			if tt.args != nil {
+				if err := updateReminders(e, tt.args); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := ""
+			if runAt := reminderRunAt(e, tt.kind); runAt != nil {
+				got = runAt.Format(time.RFC3339)
+			}
+			if got != tt.want {
+				t.Errorf("reminderRunAt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	e := &Event{ExchangeDate: date("2026-12-20")}
+	if err := updateReminders(e, []string{"gifts", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reminderRunAt(e, JobKindGiftReminder); got == nil || !got.Equal(time.Date(2026, 12, 15, reminderHour, 0, 0, 0, time.UTC)) {
+		t.Errorf("reminderRunAt(gifts) = %v, want 2026-12-15 09:00", got)
+	}
+}
+
+func TestUpdateRemindersInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown reminder", []string{"weekly"}},
+		{"enrollment without date", []string{"enrollment"}},
+		{"enrollment with bad date", []string{"enrollment", "12/01/2026"}},
+		{"enrollment negative days", []string{"enrollment", "2026-12-01", "-1"}},
+		{"gifts without days", []string{"gifts", "soon"}},
+		{"off unknown", []string{"off", "exchange"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := updateReminders(&Event{}, tt.args); err == nil {
+				t.Errorf("updateReminders(%v) returned no error", tt.args)
+			}
+		})
+	}
+}
+
+// racingRepo changes the budget of every event it finds right after
+// finding it, like another host changing settings at the same time.
+type racingRepo struct {
+	*memoryRepo
+}
+
+func (r racingRepo) FindEvents(ctx context.Context, chid *string, eid *string, tid *string) ([]Event, error) {
+	events, err := r.memoryRepo.FindEvents(ctx, chid, eid, tid)
+	for _, e := range events {
+		budget := 50.0
+		r.events[e.Id].Budget = &budget
+	}
+	return events, err
+}
+
+func TestRemindersCommand(t *testing.T) {
+	next := strconv.Itoa(time.Now().Year() + 1)
+	tests := []struct {
+		name     string
+		args     []string
+		wantDate string
+		wantJob  bool
+	}{
+		{"show", nil, "", false},
+		{"exchange date", []string{"exchange", next + "-12-20"}, next + "-12-20", true},
+		{"invalid", []string{"exchange", "soon"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepo()
+			c := &Caller{ChannelId: String("C1"), Platform: PlatformSlack, TeamId: String("T1"), UserId: "U1", UserName: "ann"}
+			e, err := newTestSanta(repo).createEvent(context.Background(), c, "", "1 Main Street", false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &Handlers{SecretSanta: newTestSanta(racingRepo{repo})}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/santa", nil)
+			h.remindersCommand(w, r, &SlackRequest{Caller: *c}, "", tt.args)
+
+			saved := repo.events[e.Id]
+			got := ""
+			if saved.ExchangeDate != nil {
+				got = saved.ExchangeDate.Format(dateLayout)
+			}
+			if got != tt.wantDate {
+				t.Errorf("exchange date = %q, want %q", got, tt.wantDate)
+			}
+			if saved.Budget == nil || *saved.Budget != 50 {
+				t.Errorf("budget = %v, the concurrent change was lost", saved.Budget)
+			}
+			if (len(repo.jobs) > 0) != tt.wantJob {
+				t.Errorf("jobs = %v, want a job %v", repo.jobs, tt.wantJob)
+			}
+		})
+	}
+}
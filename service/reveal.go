@@ -0,0 +1,218 @@
+// reveal.go
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const revealUsage string = "Usage: /santa reveal [thanks] [confirm <code>]"
+
+// revealChains lists who gave to whom, following each chain of santas
+// until it comes back to where it started. When anybody gave several
+// gifts there are no chains, so each santa is listed with their giftees.
+func revealChains(e *Event, participants []Participant) []string {
+	names := make(map[string]string)
+	for _, p := range participants {
+		names[p.UserId] = p.UserName
+	}
+	mention := func(uid string) string {
+		return userMention(e, uid, names[uid])
+	}
+
+	matches := make(map[string]string)
+	var santas, lines []string
+	several := false
+	for i := range participants {
+		p := &participants[i]
+		gs := giftees(p)
+		if !p.IsMatched || len(gs) == 0 {
+			continue
+		}
+		matches[p.UserId] = gs[0].UserId
+		santas = append(santas, p.UserId)
+
+		var mentions []string
+		for _, m := range gs {
+			mentions = append(mentions, mention(m.UserId))
+		}
+		lines = append(lines, mention(p.UserId)+" → "+strings.Join(mentions, ", "))
+		several = several || len(gs) > 1
+	}
+	sort.Strings(santas)
+
+	if several {
+		sort.Strings(lines)
+		return lines
+	}
+
+	// Chains start with santas nobody gives to, so that those who only
+	// give are not left out, and then go round what is left.
+	received := make(map[string]bool)
+	for _, giftee := range matches {
+		received[giftee] = true
+	}
+	var starts []string
+	for _, uid := range santas {
+		if !received[uid] {
+			starts = append(starts, uid)
+		}
+	}
+	starts = append(starts, santas...)
+
+	var chains []string
+	seen := make(map[string]bool)
+	for _, start := range starts {
+		if seen[start] {
+			continue
+		}
+
+		chain := mention(start)
+		for uid := start; ; {
+			seen[uid] = true
+			next, ok := matches[uid]
+			if !ok {
+				break
+			}
+			chain += " → " + mention(next)
+			if seen[next] {
+				break
+			}
+			uid = next
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// reveal posts all pairs of the event to its channel and archives it. With
+// thanks, a thread is started under the announcement for giftees to thank
+// their santa.
+func (h *Handlers) reveal(ctx context.Context, e *Event, actor string, thanks bool) error {
+	e, err := h.lockEvent(ctx, e.Id, func(e *Event) error {
+		if e.Status != EventStatusMatched {
+			return errors.New(eventTitle(e) + " pairs have not been matched yet, so there is nothing to reveal")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	participants, err := h.repo.GetAllParticipants(ctx, e.Id)
+	if err != nil {
+		h.unlockEvent(ctx, e.Id, nil)
+		return err
+	}
+	h.openAllMatches(e, participants)
+
+	seed := ""
+	if e.Draw != nil {
+		seed, err = h.drawSeed(e)
+		if err != nil {
+			h.unlockEvent(ctx, e.Id, nil)
+			return err
+		}
+	}
+
+	msg := "It is " + eventTitle(e) + " reveal day! Here is who was whose Secret Santa:\n" + strings.Join(revealChains(e, participants), "\n")
+	if e.Draw != nil {
+		msg += "\nThe draw's seed was `" + seed + "`, check it against the commitment `" + e.Draw.Commitment + "`"
+		if eventPlatform(e) == PlatformSlack {
+			msg += " with `/santa verify`"
+		}
+		msg += "."
+	}
+	postId, err := h.poster.Post(ctx, e, channelNotice(e, msg), "")
+	if err != nil {
+		h.unlockEvent(ctx, e.Id, nil)
+		return err
+	}
+
+	if thanks {
+		_, err = h.poster.Post(ctx, e, "Got something you love? Say thank you to your Secret Santa in this thread!", postId)
+		if err != nil {
+			h.logger.Println(err)
+		}
+	}
+
+	e, err = h.unlockEvent(ctx, e.Id, func(e *Event) error {
+		// Once revealed, the seed is public.
+		if e.Draw != nil {
+			e.Draw.SealedSeed = ""
+			e.Draw.Seed = seed
+		}
+		e.Status = EventStatusArchived
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range []string{JobKindEnrollmentReminder, JobKindGiftReminder, JobKindRevealReminder} {
+		err = h.repo.CancelPendingJobs(ctx, e.Id, kind)
+		if err != nil {
+			h.logger.Println(err)
+		}
+	}
+
+	h.audit(ctx, e, actor, HostActionReveal, "", "")
+	return nil
+}
+
+func (h *Handlers) revealCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionReveal)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if e.Status != EventStatusMatched {
+		writeSlackMessage(w, ResponseTypeEphemeral, eventTitle(e)+" pairs have not been matched yet, so there is nothing to reveal.")
+		return
+	}
+
+	thanks := false
+	if len(args) > 0 && strings.ToLower(args[0]) == "thanks" {
+		thanks = true
+		args = args[1:]
+	}
+
+	code, err := h.confirmAction(r.Context(), e, req.UserId, HostActionReveal, args)
+	if err != nil {
+		if len(args) > 0 && strings.ToLower(args[0]) != "confirm" {
+			err = errors.New(revealUsage)
+		}
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	if code != "" {
+		command := "/santa reveal confirm " + code
+		if thanks {
+			command = "/santa reveal thanks confirm " + code
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, "This posts all pairs of "+eventTitle(e)+" to the channel and archives the event. To go ahead, type `"+command+"` within 5 minutes.")
+		return
+	}
+
+	err = h.reveal(r.Context(), e, req.UserId, thanks)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeEphemeral, "All pairs of "+eventTitle(e)+" have been revealed and the event is archived.")
+}
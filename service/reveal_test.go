@@ -0,0 +1,108 @@
+// reveal_test.go
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRevealChains(t *testing.T) {
+	match := func(uid string, matchId string) Participant {
+		return Participant{UserId: uid, IsMatched: true, YourMatchId: &matchId}
+	}
+
+	tests := []struct {
+		name         string
+		participants []Participant
+		want         []string
+	}{
+		{
+			name:         "nobody matched",
+			participants: []Participant{{UserId: "U1"}, {UserId: "U2"}},
+			want:         nil,
+		},
+		{
+			name:         "one circle",
+			participants: []Participant{match("U3", "U1"), match("U1", "U2"), match("U2", "U3")},
+			want:         []string{"<@U1> → <@U2> → <@U3> → <@U1>"},
+		},
+		{
+			name:         "two circles",
+			participants: []Participant{match("U1", "U2"), match("U2", "U1"), match("U3", "U4"), match("U4", "U3")},
+			want:         []string{"<@U1> → <@U2> → <@U1>", "<@U3> → <@U4> → <@U3>"},
+		},
+		{
+			name:         "broken chain",
+			participants: []Participant{match("U1", "U2"), {UserId: "U2"}},
+			want:         []string{"<@U1> → <@U2>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revealChains(&Event{}, tt.participants); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("revealChains() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevealChainsMentions(t *testing.T) {
+	u2, u1 := "U2", "U1"
+	participants := []Participant{
+		{IsMatched: true, UserId: "U1", UserName: "ann", YourMatchId: &u2},
+		{IsMatched: true, UserId: "U2", UserName: "bob", YourMatchId: &u1},
+	}
+
+	tests := []struct {
+		platform string
+		want     string
+	}{
+		{PlatformSlack, "<@U1> → <@U2> → <@U1>"},
+		{PlatformDiscord, "<@U1> → <@U2> → <@U1>"},
+		{PlatformMattermost, "@ann → @bob → @ann"},
+		{PlatformTeams, "ann → bob → ann"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got := revealChains(&Event{Platform: tt.platform}, participants)
+			if want := []string{tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("revealChains() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRevealRunAt(t *testing.T) {
+	exchange := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"exchange date", nil, "2026-12-20"},
+		{"own day", []string{"reveal", "2026-12-24"}, "2026-12-24"},
+		{"by hand", []string{"off", "reveal"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{ExchangeDate: &exchange}
+			if tt.args != nil {
+				if err := updateReminders(e, tt.args); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := ""
+			if runAt := reminderRunAt(e, JobKindRevealReminder); runAt != nil {
+				got = runAt.Format(dateLayout)
+			}
+			if got != tt.want {
+				t.Errorf("reminderRunAt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// scheduler.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	jobLease        time.Duration = 5 * time.Minute
+	jobMaxAttempts  int           = 5
+	jobPollInterval time.Duration = time.Minute
+)
+
+type JobFunc func(ctx context.Context, job *Job) error
+
+// JobQueue is the part of the repository that the scheduler works on.
+type JobQueue interface {
+	ClaimDueJob(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error)
+	CompleteJob(ctx context.Context, job *Job) error
+	FailJob(ctx context.Context, job *Job, jobErr error, maxAttempts int) error
+}
+
+// Scheduler runs jobs persisted in MongoDB. Any number of replicas may run
+// a scheduler against the same database: a job is leased to one of them at
+// a time, and a job whose runner died is picked up again once the lease
+// expires.
+type Scheduler struct {
+	logger *log.Logger
+	repo   JobQueue
+	owner  string
+	funcs  map[string]JobFunc
+}
+
+func NewScheduler(l *log.Logger, r JobQueue) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		logger: l,
+		repo:   r,
+		owner:  fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		funcs:  make(map[string]JobFunc),
+	}
+}
+
+func (s *Scheduler) Register(kind string, fn JobFunc) {
+	s.funcs[kind] = fn
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDueJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs the job within its lease. Once the lease has run out, another
+// replica may claim the job, so whatever the job still does against the
+// database fails instead of overlapping with it.
+func (s *Scheduler) run(ctx context.Context, fn JobFunc, job *Job) error {
+	ctx, cancel := context.WithDeadline(ctx, job.LockedUntil)
+	defer cancel()
+	return fn(ctx, job)
+}
+
+func (s *Scheduler) runDueJobs(ctx context.Context) {
+	for {
+		job, err := s.repo.ClaimDueJob(ctx, s.owner, time.Now(), jobLease)
+		if err != nil {
+			s.logger.Println(err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		fn, ok := s.funcs[job.Kind]
+		if !ok {
+			err = fmt.Errorf("no handler registered for job kind %s", job.Kind)
+		} else {
+			err = s.run(ctx, fn, job)
+		}
+
+		if err != nil {
+			s.logger.Println("job", job.Id, "attempt", job.Attempts, "failed:", err)
+			err = s.repo.FailJob(ctx, job, err, jobMaxAttempts)
+		} else {
+			err = s.repo.CompleteJob(ctx, job)
+		}
+		if err != nil {
+			s.logger.Println(err)
+		}
+	}
+}
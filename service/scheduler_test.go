@@ -0,0 +1,153 @@
+// scheduler_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// memoryJobQueue leases jobs the way ServiceRepo does: a pending job is
+// claimed once it is due and nobody holds its lease.
+type memoryJobQueue struct {
+	jobs []*Job
+}
+
+func (q *memoryJobQueue) ClaimDueJob(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error) {
+	for _, job := range q.jobs {
+		if job.Status == JobStatusPending && !job.RunAt.After(now) && !job.LockedUntil.After(now) {
+			job.LockedBy = owner
+			job.LockedUntil = now.Add(lease)
+			job.Attempts++
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *memoryJobQueue) CompleteJob(ctx context.Context, done *Job) error {
+	job := q.leased(done)
+	if job == nil {
+		return errors.New("job " + done.Id + " was claimed by another runner before it completed")
+	}
+	job.Error = ""
+	job.Status = JobStatusDone
+	return nil
+}
+
+func (q *memoryJobQueue) FailJob(ctx context.Context, failed *Job, jobErr error, maxAttempts int) error {
+	job := q.leased(failed)
+	if job == nil {
+		return errors.New("job " + failed.Id + " was claimed by another runner before it failed")
+	}
+	job.Error = jobErr.Error()
+	if failed.Attempts >= maxAttempts {
+		job.Status = JobStatusFailed
+	}
+	return nil
+}
+
+// leased returns the stored job as long as it is still leased the way it
+// was claimed, like leaseFilter.
+func (q *memoryJobQueue) leased(claimed *Job) *Job {
+	for _, job := range q.jobs {
+		if job.Id == claimed.Id && job.Attempts == claimed.Attempts && job.LockedBy == claimed.LockedBy {
+			return job
+		}
+	}
+	return nil
+}
+
+func TestSchedulerRunDueJobs(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		job        Job
+		wantStatus string
+		wantRuns   int
+	}{
+		{
+			name:       "succeeds",
+			job:        Job{Id: "J1", Kind: "ok", RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusDone,
+			wantRuns:   1,
+		},
+		{
+			name:       "not due yet",
+			job:        Job{Id: "J1", Kind: "ok", RunAt: now.Add(time.Hour), Status: JobStatusPending},
+			wantStatus: JobStatusPending,
+		},
+		{
+			name:       "leased to another runner",
+			job:        Job{Id: "J1", Kind: "ok", LockedBy: "other", LockedUntil: now.Add(time.Minute), RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusPending,
+		},
+		{
+			name:       "lease of a dead runner expired",
+			job:        Job{Id: "J1", Attempts: 1, Kind: "ok", LockedBy: "other", LockedUntil: now.Add(-time.Minute), RunAt: now.Add(-time.Hour), Status: JobStatusPending},
+			wantStatus: JobStatusDone,
+			wantRuns:   1,
+		},
+		{
+			name:       "fails and keeps its lease until retried",
+			job:        Job{Id: "J1", Kind: "fail", RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusPending,
+			wantRuns:   1,
+		},
+		{
+			name:       "fails its last attempt",
+			job:        Job{Id: "J1", Attempts: jobMaxAttempts - 1, Kind: "fail", RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusFailed,
+			wantRuns:   1,
+		},
+		{
+			name:       "lease taken over while it runs",
+			job:        Job{Id: "J1", Kind: "slow", RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusPending,
+			wantRuns:   1,
+		},
+		{
+			name:       "has no handler",
+			job:        Job{Id: "J1", Attempts: jobMaxAttempts - 1, Kind: "unknown", RunAt: now.Add(-time.Minute), Status: JobStatusPending},
+			wantStatus: JobStatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := tt.job
+			queue := &memoryJobQueue{jobs: []*Job{&job}}
+			s := NewScheduler(log.New(io.Discard, "", 0), queue)
+
+			runs := 0
+			s.Register("ok", func(ctx context.Context, job *Job) error {
+				runs++
+				return nil
+			})
+			s.Register("fail", func(ctx context.Context, job *Job) error {
+				runs++
+				return errors.New("failed")
+			})
+			s.Register("slow", func(ctx context.Context, claimed *Job) error {
+				runs++
+				// The lease ran out and another runner claimed the job.
+				job.Attempts++
+				job.LockedBy = "other"
+				return nil
+			})
+
+			s.runDueJobs(context.Background())
+
+			if job.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", job.Status, tt.wantStatus)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// settings.go
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const settingsUsage string = `Usage: /santa settings [budget=25] [currency=EUR] [exchange=YYYY-MM-DD] [theme="Handmade"] [rules="No gag gifts"] [giftees=2] [regions=on|off]`
+
+var settingKeys = []string{"budget", "currency", "exchange", "theme", "rules", "giftees", "regions"}
+
+// parseOptions extracts key=value pairs for the given keys from text. A
+// value containing spaces is written in double quotes. Whatever is not an
+// option, e.g. a postal address, is returned as the rest of the text.
+func parseOptions(text string, keys []string) (string, map[string]string) {
+	known := make(map[string]bool)
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	// Slack clients may turn typed quotes into typographic ones.
+	text = strings.NewReplacer("“", "\"", "”", "\"").Replace(text)
+
+	opts := make(map[string]string)
+	var rest []string
+
+	i := 0
+	for i < len(text) {
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(text) && text[i] != ' ' && text[i] != '=' {
+			i++
+		}
+		key := strings.ToLower(text[start:i])
+
+		if i >= len(text) || text[i] != '=' || !known[key] {
+			for i < len(text) && text[i] != ' ' {
+				i++
+			}
+			if start < i {
+				rest = append(rest, text[start:i])
+			}
+			continue
+		}
+
+		i++
+		if i < len(text) && text[i] == '"' {
+			i++
+			end := strings.IndexByte(text[i:], '"')
+			if end < 0 {
+				end = len(text) - i
+			}
+			opts[key] = text[i : i+end]
+			i += end + 1
+		} else {
+			vstart := i
+			for i < len(text) && text[i] != ' ' {
+				i++
+			}
+			opts[key] = text[vstart:i]
+		}
+	}
+
+	return strings.Join(rest, " "), opts
+}
+
+func applySettings(e *Event, opts map[string]string) error {
+	for key, value := range opts {
+		value = strings.TrimSpace(value)
+		switch key {
+		case "budget":
+			if value == "" {
+				e.Budget = nil
+				continue
+			}
+			budget, err := strconv.ParseFloat(value, 64)
+			if err != nil || budget < 0 {
+				return errors.New("Please provide the budget as a number, e.g. budget=25")
+			}
+			e.Budget = &budget
+		case "currency":
+			e.Currency = optionalString(strings.ToUpper(value))
+		case "exchange":
+			if value == "" {
+				e.ExchangeDate = nil
+				continue
+			}
+			t, err := parseDate(value)
+			if err != nil {
+				return err
+			}
+			e.ExchangeDate = &t
+		case "theme":
+			e.Theme = optionalString(value)
+		case "rules":
+			e.Rules = optionalString(value)
+		case "giftees":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return errors.New("Please provide how many gifts everybody gives as a number, e.g. giftees=2")
+			}
+			if e.Status != "" && e.Status != EventStatusOpen {
+				return errors.New(eventTitle(e) + " pairs have already been matched, reset them first to change how many gifts everybody gives")
+			}
+			e.GifteesEach = n
+		case "regions":
+			switch strings.ToLower(value) {
+			case "on":
+				e.MatchByRegion = true
+			case "off", "":
+				e.MatchByRegion = false
+			default:
+				return errors.New("Please turn region-aware matching on or off, e.g. regions=on")
+			}
+		}
+	}
+	return nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// eventDetails lists the settings of the event, one per line, for adding
+// to messages. It is empty if nothing has been set.
+func eventDetails(e *Event) string {
+	if e == nil {
+		return ""
+	}
+
+	details := ""
+	if e.Budget != nil {
+		currency := ""
+		if e.Currency != nil {
+			currency = " " + *e.Currency
+		}
+		details += "\nBudget: " + strconv.FormatFloat(*e.Budget, 'f', -1, 64) + currency
+	}
+	if e.ExchangeDate != nil {
+		details += "\nExchange date: " + e.ExchangeDate.Format(dateLayout)
+	}
+	if e.Theme != nil {
+		details += "\nTheme: " + *e.Theme
+	}
+	if e.Rules != nil {
+		details += "\nRules: " + *e.Rules
+	}
+	if e.GifteesEach > 1 {
+		details += "\nGifts per person: " + strconv.Itoa(e.GifteesEach)
+	}
+	return details
+}
+
+func (h *Handlers) settingsCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	rest, opts := parseOptions(strings.Join(args, " "), settingKeys)
+	if rest != "" {
+		writeSlackMessage(w, ResponseTypeEphemeral, settingsUsage)
+		return
+	}
+
+	if len(opts) == 0 {
+		details := eventDetails(e)
+		if details == "" {
+			details = "\nNo settings yet."
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, eventTitle(e)+" settings:"+details)
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionConfigure)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = applySettings(e, opts)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = h.repo.SaveEvent(r.Context(), e)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionConfigure, "", strings.Join(args, " "))
+
+	// The gift reminder depends on the exchange date.
+	err = h.scheduleReminders(r.Context(), e)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	writeSlackMessage(w, ResponseTypeInChannel, "<@"+req.UserId+"> updated the "+eventTitle(e)+" settings:"+eventDetails(e))
+}
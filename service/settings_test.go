@@ -0,0 +1,116 @@
+// settings_test.go
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantRest string
+		wantOpts map[string]string
+	}{
+		{
+			name:     "address only",
+			text:     "1 Main St, Springfield",
+			wantRest: "1 Main St, Springfield",
+			wantOpts: map[string]string{},
+		},
+		{
+			name:     "options and rest",
+			text:     "budget=25 1 Main St currency=eur",
+			wantRest: "1 Main St",
+			wantOpts: map[string]string{"budget": "25", "currency": "eur"},
+		},
+		{
+			name:     "quoted value",
+			text:     `theme="Handmade only" rules=“No gag gifts”`,
+			wantRest: "",
+			wantOpts: map[string]string{"theme": "Handmade only", "rules": "No gag gifts"},
+		},
+		{
+			name:     "empty value clears",
+			text:     `theme=""`,
+			wantRest: "",
+			wantOpts: map[string]string{"theme": ""},
+		},
+		{
+			name:     "unknown key is rest",
+			text:     "flat=3b BUDGET=10",
+			wantRest: "flat=3b",
+			wantOpts: map[string]string{"budget": "10"},
+		},
+		{
+			name:     "unterminated quote",
+			text:     `rules="Be nice`,
+			wantRest: "",
+			wantOpts: map[string]string{"rules": "Be nice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, opts := parseOptions(tt.text, settingKeys)
+			if rest != tt.wantRest {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+			if !reflect.DeepEqual(opts, tt.wantOpts) {
+				t.Errorf("opts = %v, want %v", opts, tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "all settings",
+			opts: map[string]string{"budget": "25.5", "currency": "eur", "exchange": "2026-12-20", "theme": "Handmade", "rules": "No gag gifts"},
+			want: "\nBudget: 25.5 EUR\nExchange date: 2026-12-20\nTheme: Handmade\nRules: No gag gifts",
+		},
+		{
+			name: "budget without currency",
+			opts: map[string]string{"budget": "10"},
+			want: "\nBudget: 10",
+		},
+		{
+			name:    "negative budget",
+			opts:    map[string]string{"budget": "-5"},
+			wantErr: true,
+		},
+		{
+			name:    "bad exchange date",
+			opts:    map[string]string{"exchange": "20.12.2026"},
+			wantErr: true,
+		},
+		{
+			name: "nothing set",
+			opts: map[string]string{"theme": " "},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{}
+			err := applySettings(e, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := eventDetails(e); got != tt.want {
+				t.Errorf("eventDetails() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// status.go
+package service
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Slack shows at most 3000 characters per section, which a page of the
+// roster stays well within.
+const statusPageSize int = 20
+
+const statusUsage string = "Usage: /santa status [page] | /santa status pairs"
+
+func markdownSection(text string) SlackBlock {
+	return SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}}
+}
+
+// rosterLine describes one participant for hosts. It shows how far the
+// participant's own gift has come but never who it is for.
+func rosterLine(p *Participant) string {
+	parts := []string{"<@" + p.UserId + ">"}
+
+	if !hasAddress(p) {
+		parts = append(parts, ":warning: no address")
+	}
+
+	if p.IsMatched {
+		parts = append(parts, "matched")
+	} else {
+		parts = append(parts, "not matched")
+	}
+
+	switch {
+	case p.Notification == nil:
+		if p.IsMatched {
+			parts = append(parts, "not notified")
+		}
+	case p.Notification.Delivered:
+		parts = append(parts, "notified")
+	default:
+		parts = append(parts, ":x: notification failed")
+	}
+
+	if p.IsMatched {
+		status := giftStatus(p)
+		if status == "" {
+			status = "not purchased"
+		}
+		parts = append(parts, "gift "+status)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// participantCounts sums up how far the participants of an event have
+// come.
+type participantCounts struct {
+	failed    int
+	matched   int
+	noAddress int
+	notified  int
+	purchased int
+	received  int
+	shipped   int
+}
+
+func hasAddress(p *Participant) bool {
+	return p.Address != nil && strings.TrimSpace(*p.Address) != ""
+}
+
+func countParticipants(participants []Participant) participantCounts {
+	var counts participantCounts
+	for i := range participants {
+		p := &participants[i]
+		if !hasAddress(p) {
+			counts.noAddress++
+		}
+		if p.IsMatched {
+			counts.matched++
+		}
+		if p.Notification != nil {
+			if p.Notification.Delivered {
+				counts.notified++
+			} else {
+				counts.failed++
+			}
+		}
+		switch giftStatus(p) {
+		case GiftStatusPurchased:
+			counts.purchased++
+		case GiftStatusShipped:
+			counts.shipped++
+		case GiftStatusReceived:
+			counts.received++
+		}
+	}
+	return counts
+}
+
+// statusCommand shows hosts a dashboard of the event: who has enrolled,
+// whose address is missing, who has been matched and told about it and
+// how far their gift has come. Who gives to whom is never shown.
+func (h *Handlers) statusCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	if len(args) == 1 && strings.ToLower(args[0]) == "pairs" {
+		h.statusPairsCommand(w, r, req, eventName)
+		return
+	}
+
+	page := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || len(args) > 1 {
+			writeSlackMessage(w, ResponseTypeEphemeral, statusUsage)
+			return
+		}
+		page = n
+	}
+
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionViewStatus)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	participants, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	// Sorted by user rather than in enrollment order, which could hint at
+	// how pairs were drawn.
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserId < participants[j].UserId
+	})
+
+	counts := countParticipants(participants)
+	status := e.Status
+	if status == "" {
+		status = EventStatusOpen
+	}
+
+	summary := []string{
+		"*Status:* " + status,
+		"*Enrolled:* " + strconv.Itoa(len(participants)) + ", " + strconv.Itoa(counts.noAddress) + " without an address",
+		"*Matched:* " + strconv.Itoa(counts.matched) + ", " + strconv.Itoa(counts.notified) + " notified, " + strconv.Itoa(counts.failed) + " notifications failed",
+		"*Gifts:* " + strconv.Itoa(counts.purchased) + " purchased, " + strconv.Itoa(counts.shipped) + " shipped, " + strconv.Itoa(counts.received) + " received",
+	}
+
+	pages := (len(participants) + statusPageSize - 1) / statusPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	var roster []string
+	for i := (page - 1) * statusPageSize; i < len(participants) && i < page*statusPageSize; i++ {
+		roster = append(roster, rosterLine(&participants[i]))
+	}
+	if len(roster) == 0 {
+		roster = append(roster, "Nobody has enrolled yet.")
+	}
+
+	footer := "Page " + strconv.Itoa(page) + " of " + strconv.Itoa(pages)
+	if page < pages {
+		footer += ". Type `/santa status " + strconv.Itoa(page+1) + "` for the next page"
+	}
+
+	blocks := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: eventTitle(e)}},
+		markdownSection(strings.Join(summary, "\n")),
+		{Type: "divider"},
+		markdownSection(strings.Join(roster, "\n")),
+		{Type: "context", Elements: []interface{}{SlackText{Type: "mrkdwn", Text: footer}}},
+	}
+
+	writeSlackBlocks(w, ResponseTypeEphemeral, eventTitle(e)+" status: "+strconv.Itoa(len(participants))+" enrolled, "+strconv.Itoa(counts.matched)+" matched", blocks)
+}
+
+// statusPairsCommand shows hosts who ask for it who gives to whom and how
+// far each gift has come, and records that they looked in the audit log.
+// With assignment keys hosts cannot read the pairs, so only the owner's
+// /santa breakglass can show them.
+func (h *Handlers) statusPairsCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	err = authorizeHost(e, req.UserId, HostActionViewPairs)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if h.keys != nil {
+		writeSlackMessage(w, ResponseTypeEphemeral, "The pairs of "+eventTitle(e)+" are encrypted so that hosts cannot read them. If need be, the owner can look at them with `/santa breakglass <reason>`.")
+		return
+	}
+
+	participants, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserId < participants[j].UserId
+	})
+
+	var pairs []string
+	for i := range participants {
+		p := &participants[i]
+		for _, m := range giftees(p) {
+			status := giftProgress(h.giftFor(e.Id, p, m.UserId))
+			if status == "" {
+				status = "not purchased"
+			}
+			pairs = append(pairs, "<@"+p.UserId+"> → <@"+m.UserId+">: "+status)
+		}
+	}
+	if len(pairs) == 0 {
+		writeSlackMessage(w, ResponseTypeEphemeral, eventTitle(e)+" pairs have not been matched yet.")
+		return
+	}
+
+	h.audit(r.Context(), e, req.UserId, HostActionViewPairs, "", "")
+
+	lines := append([]string{eventTitle(e) + " pairs:"}, pairs...)
+	writeSlackMessage(w, ResponseTypeEphemeral, strings.Join(lines, "\n"))
+}
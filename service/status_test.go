@@ -0,0 +1,58 @@
+// status_test.go
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRosterLine(t *testing.T) {
+	now := time.Now()
+	address := "1 Main St"
+	giftee := "U2"
+
+	tests := []struct {
+		name string
+		p    Participant
+		want string
+	}{
+		{
+			name: "enrolled",
+			p:    Participant{UserId: "U1", Address: &address},
+			want: "<@U1> · not matched",
+		},
+		{
+			name: "no address",
+			p:    Participant{UserId: "U1"},
+			want: "<@U1> · :warning: no address · not matched",
+		},
+		{
+			name: "matched but not notified",
+			p:    Participant{UserId: "U1", Address: &address, IsMatched: true, YourMatchId: &giftee},
+			want: "<@U1> · matched · not notified · gift not purchased",
+		},
+		{
+			name: "notification failed",
+			p:    Participant{UserId: "U1", Address: &address, IsMatched: true, YourMatchId: &giftee, Notification: &Notification{At: now, Error: "channel_not_found"}},
+			want: "<@U1> · matched · :x: notification failed · gift not purchased",
+		},
+		{
+			name: "gift shipped",
+			p:    Participant{UserId: "U1", Address: &address, IsMatched: true, YourMatchId: &giftee, Notification: &Notification{At: now, Delivered: true}, Gift: &Gift{PurchasedAt: &now, ShippedAt: &now}},
+			want: "<@U1> · matched · notified · gift shipped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rosterLine(&tt.p)
+			if got != tt.want {
+				t.Errorf("rosterLine() = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, giftee) {
+				t.Errorf("rosterLine() = %q shows the giftee", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,585 @@
+// teams.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	teamsIssuer    string = "https://api.botframework.com"
+	teamsOpenIdUrl string = "https://login.botframework.com/v1/.well-known/openidconfiguration"
+	teamsScope     string = "https://api.botframework.com/.default"
+	teamsTokenUrl  string = "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token"
+)
+
+const teamsUsage string = "Usage: initialize <address>|organize, participate <address>, randomize, get"
+
+// TeamsClient talks to Microsoft Teams through the Bot Framework: it
+// checks that activities sent to the bot come from the Bot Framework, and
+// sends messages on behalf of the bot.
+type TeamsClient struct {
+	appId    string
+	password string
+
+	mu            sync.Mutex
+	keys          map[string]teamsKey
+	keysFetchedAt time.Time
+	token         string
+	tokenExpires  time.Time
+}
+
+type teamsKey struct {
+	endorsements []string
+	key          *rsa.PublicKey
+}
+
+// NewTeamsClient returns a client for the bot registered with the given
+// app ID and password, or nil if no app ID is configured.
+func NewTeamsClient(appId string, password string) *TeamsClient {
+	if appId == "" {
+		return nil
+	}
+	return &TeamsClient{appId: appId, password: password}
+}
+
+// authenticate checks the token the Bot Framework signs its requests with:
+// that it is signed with one of its keys endorsed for the activity's
+// channel, is meant for this bot and names the activity's service URL,
+// which messages are sent back to.
+func (c *TeamsClient) authenticate(r *http.Request, a *TeamsActivity) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return errors.New("the Teams request has no bearer token")
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return errors.New("the Teams request token is malformed")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeTokenSegment(parts[0], &header)
+	if err != nil {
+		return err
+	}
+	if header.Alg != "RS256" {
+		return errors.New("the Teams request token is not signed with RS256")
+	}
+
+	key, err := c.signingKey(header.Kid)
+	if err != nil {
+		return err
+	}
+	endorsed := false
+	for _, channel := range key.endorsements {
+		endorsed = endorsed || channel == a.ChannelId
+	}
+	if !endorsed {
+		return errors.New("the Teams request token is not endorsed for " + a.ChannelId)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key.key, crypto.SHA256, sum[:], sig)
+	if err != nil {
+		return errors.New("the Teams request token has an invalid signature")
+	}
+
+	var claims struct {
+		Aud        string `json:"aud"`
+		Exp        int64  `json:"exp"`
+		Iss        string `json:"iss"`
+		Nbf        int64  `json:"nbf"`
+		ServiceUrl string `json:"serviceurl"`
+	}
+	err = decodeTokenSegment(parts[1], &claims)
+	if err != nil {
+		return err
+	}
+
+	// Allow for clocks being a few minutes apart.
+	now := time.Now().Unix()
+	skew := int64(5 * 60)
+	switch {
+	case claims.Iss != teamsIssuer:
+		return errors.New("the Teams request token has the wrong issuer")
+	case claims.Aud != c.appId:
+		return errors.New("the Teams request token is meant for another bot")
+	case claims.Exp+skew < now:
+		return errors.New("the Teams request token has expired")
+	case claims.Nbf-skew > now:
+		return errors.New("the Teams request token is not valid yet")
+	case claims.ServiceUrl != a.ServiceUrl:
+		return errors.New("the Teams request token is for another service URL")
+	}
+	return nil
+}
+
+func decodeTokenSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// signingKey returns the Bot Framework key with the given ID. The keys
+// are fetched once a day, or sooner when they have been rolled over.
+func (c *TeamsClient) signingKey(kid string) (teamsKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	if ok && time.Since(c.keysFetchedAt) < 24*time.Hour {
+		return key, nil
+	}
+	if !ok && time.Since(c.keysFetchedAt) < 5*time.Minute {
+		return teamsKey{}, errors.New("the Teams request token is signed with an unknown key")
+	}
+
+	var config struct {
+		JwksUri string `json:"jwks_uri"`
+	}
+	err := getJson(teamsOpenIdUrl, &config)
+	if err != nil {
+		return teamsKey{}, err
+	}
+	var jwks struct {
+		Keys []struct {
+			E            string   `json:"e"`
+			Endorsements []string `json:"endorsements"`
+			Kid          string   `json:"kid"`
+			N            string   `json:"n"`
+		} `json:"keys"`
+	}
+	err = getJson(config.JwksUri, &jwks)
+	if err != nil {
+		return teamsKey{}, err
+	}
+
+	keys := make(map[string]teamsKey)
+	for _, k := range jwks.Keys {
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = teamsKey{
+			endorsements: k.Endorsements,
+			key:          &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+		}
+	}
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+
+	key, ok = c.keys[kid]
+	if !ok {
+		return teamsKey{}, errors.New("the Teams request token is signed with an unknown key")
+	}
+	return key, nil
+}
+
+func getJson(url string, v interface{}) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("GET " + url + " failed: " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// accessToken returns the token the bot sends messages with, fetching a
+// new one shortly before the current one expires.
+func (c *TeamsClient) accessToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpires) {
+		return c.token, nil
+	}
+
+	resp, err := httpClient.PostForm(teamsTokenUrl, url.Values{
+		"client_id":     {c.appId},
+		"client_secret": {c.password},
+		"grant_type":    {"client_credentials"},
+		"scope":         {teamsScope},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("the Teams access token could not be fetched: " + res.Error)
+	}
+
+	c.token = res.AccessToken
+	c.tokenExpires = time.Now().Add(time.Duration(res.ExpiresIn)*time.Second - 5*time.Minute)
+	return c.token, nil
+}
+
+// callTeamsApi calls the Bot Framework connector of the given service URL
+// on behalf of the bot, and decodes its response into v unless v is nil.
+func (c *TeamsClient) callTeamsApi(serviceUrl string, path string, args interface{}, v interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+
+	jsonData := new(bytes.Buffer)
+	json.NewEncoder(jsonData).Encode(args)
+	req, err := http.NewRequest("POST", strings.TrimSuffix(serviceUrl, "/")+path, jsonData)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(path + " failed: " + resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func cardActivity(card *AdaptiveCard) *TeamsActivity {
+	return &TeamsActivity{
+		Attachments: []TeamsAttachment{{Content: card, ContentType: "application/vnd.microsoft.card.adaptive"}},
+		Type:        "message",
+	}
+}
+
+// reply answers an activity in its conversation.
+func (c *TeamsClient) reply(a *TeamsActivity, card *AdaptiveCard) error {
+	msg := cardActivity(card)
+	msg.Conversation = a.Conversation
+	msg.From = a.Recipient
+	msg.Recipient = a.From
+	msg.ReplyToId = a.Id
+	return c.callTeamsApi(a.ServiceUrl, "/v3/conversations/"+url.PathEscape(a.Conversation.Id)+"/activities/"+url.PathEscape(a.Id), msg, nil)
+}
+
+// sendDirect sends a card to a user in their personal chat with the bot,
+// which is started if need be.
+func (c *TeamsClient) sendDirect(serviceUrl string, tenantId string, uid string, card *AdaptiveCard) error {
+	var conversation TeamsAccount
+	err := c.callTeamsApi(serviceUrl, "/v3/conversations", map[string]interface{}{
+		"bot":         TeamsAccount{Id: "28:" + c.appId},
+		"channelData": TeamsChannelData{Tenant: &TeamsAccount{Id: tenantId}},
+		"isGroup":     false,
+		"members":     []TeamsAccount{{Id: uid}},
+	}, &conversation)
+	if err != nil {
+		return err
+	}
+	return c.callTeamsApi(serviceUrl, "/v3/conversations/"+url.PathEscape(conversation.Id)+"/activities", cardActivity(card), nil)
+}
+
+func adaptiveCard(body ...AdaptiveElement) *AdaptiveCard {
+	return &AdaptiveCard{
+		Body:    body,
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+	}
+}
+
+func cardHeading(text string) AdaptiveElement {
+	return AdaptiveElement{Size: "Medium", Text: text, Type: "TextBlock", Weight: "Bolder", Wrap: true}
+}
+
+func cardText(text string) AdaptiveElement {
+	return AdaptiveElement{Text: text, Type: "TextBlock", Wrap: true}
+}
+
+// cardFacts lays out lines such as those of eventDetails, which are of the
+// form "Title: value", as facts.
+func cardFacts(lines []string) []AdaptiveElement {
+	if len(lines) == 0 {
+		return nil
+	}
+	facts := AdaptiveElement{Type: "FactSet"}
+	for _, line := range lines {
+		title, value := line, ""
+		if i := strings.Index(line, ": "); i >= 0 {
+			title, value = line[:i], line[i+2:]
+		}
+		facts.Facts = append(facts.Facts, AdaptiveFact{Title: title, Value: value})
+	}
+	return []AdaptiveElement{facts}
+}
+
+// noticeCard lays out a notice for Teams. Its text is written for Slack,
+// so matches are laid out from the giftees instead.
+func noticeCard(n *Notice) *AdaptiveCard {
+	body := []AdaptiveElement{cardHeading(n.Subject)}
+	if n.Kind == NoticeKindMatch {
+		for _, g := range n.Giftees {
+			body = append(body, cardText("You give a gift to **"+g.Name+"**. Send it to: "+g.Address))
+			body = append(body, cardFacts(g.Wishlist)...)
+		}
+		body = append(body, cardText("Thank you and happy New Year!"))
+	} else {
+		body = append(body, cardText(n.Text))
+	}
+	body = append(body, cardFacts(n.Details)...)
+	return adaptiveCard(body...)
+}
+
+// TeamsNotifier sends notices to the participants of Teams events in their
+// personal chat with the bot.
+type TeamsNotifier struct {
+	client *TeamsClient
+}
+
+func NewTeamsNotifier(client *TeamsClient) *TeamsNotifier {
+	return &TeamsNotifier{client: client}
+}
+
+func (n *TeamsNotifier) Notify(ctx context.Context, notice *Notice) error {
+	e := notice.Event
+	if eventPlatform(e) != PlatformTeams {
+		return errNotReached
+	}
+	if e.ServiceUrl == nil || e.TeamId == nil {
+		return errors.New("no way to reach " + notice.To.UserId + " on Teams")
+	}
+	return n.client.sendDirect(*e.ServiceUrl, *e.TeamId, notice.To.UserId, noticeCard(notice))
+}
+
+// postChannel posts a card to a channel, in reply to the given activity
+// if any, and returns the ID of the new activity.
+func (c *TeamsClient) postChannel(serviceUrl string, channelId string, replyTo string, card *AdaptiveCard) (string, error) {
+	path := "/v3/conversations/" + url.PathEscape(channelId) + "/activities"
+	if replyTo != "" {
+		path += "/" + url.PathEscape(replyTo)
+	}
+	var res struct {
+		Id string `json:"id"`
+	}
+	err := c.callTeamsApi(serviceUrl, path, cardActivity(card), &res)
+	if err != nil {
+		return "", err
+	}
+	return res.Id, nil
+}
+
+// TeamsPoster posts to the channels of Teams events.
+type TeamsPoster struct {
+	client *TeamsClient
+}
+
+func NewTeamsPoster(client *TeamsClient) *TeamsPoster {
+	return &TeamsPoster{client: client}
+}
+
+func (p *TeamsPoster) Post(ctx context.Context, e *Event, msg string, replyTo string) (string, error) {
+	if eventPlatform(e) != PlatformTeams {
+		return "", errNotPosted
+	}
+	if e.ServiceUrl == nil || e.ChannelId == nil {
+		return "", errors.New("no way to post to the channel of " + eventTitle(e) + " on Teams")
+	}
+	return p.client.postChannel(*e.ServiceUrl, *e.ChannelId, replyTo, adaptiveCard(cardText(msg)))
+}
+
+var teamsMention = regexp.MustCompile(`<at>[^<]*</at>`)
+
+// teamsRequest returns the command of a message sent to the bot, its text
+// and its caller. Teams events belong to the channel of the message and
+// to the tenant of its team, and their participants are identified by
+// their Teams user ID.
+func teamsRequest(a *TeamsActivity) (string, string, *Caller) {
+	text := teamsMention.ReplaceAllString(a.Text, "")
+	text = strings.TrimSpace(html.UnescapeString(strings.ReplaceAll(text, "&nbsp;", " ")))
+	text = strings.TrimPrefix(text, "/")
+
+	// The command is followed by its text, as in Slack.
+	command, rest := text, ""
+	if i := strings.IndexAny(text, " \n"); i >= 0 {
+		command, rest = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	command = strings.ToLower(command)
+
+	channelId := a.Conversation.Id
+	var tenantId *string
+	if a.ChannelData != nil {
+		if a.ChannelData.Channel != nil {
+			channelId = a.ChannelData.Channel.Id
+		}
+		if a.ChannelData.Tenant != nil {
+			tenantId = String(a.ChannelData.Tenant.Id)
+		}
+	}
+
+	return command, rest, &Caller{
+		ChannelId:  String(channelId),
+		Platform:   PlatformTeams,
+		ServiceUrl: String(a.ServiceUrl),
+		TeamId:     tenantId,
+		UserId:     a.From.Id,
+		UserName:   a.From.Name,
+	}
+}
+
+// TeamsHandler receives the activities Microsoft Teams sends the bot, and
+// runs the commands of the messages addressed to it: initialize,
+// participate, randomize and get, which work like their Slack
+// counterparts.
+func (h *Handlers) TeamsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.teams == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var a TeamsActivity
+	err := json.NewDecoder(r.Body).Decode(&a)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.teams.authenticate(r, &a)
+	if err != nil {
+		h.logger.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if a.Type != "message" || a.Conversation == nil || a.From == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	command, text, c := teamsRequest(&a)
+	var card *AdaptiveCard
+	switch command {
+	case "initialize":
+		card = h.teamsInitialize(r.Context(), c, text)
+	case "participate":
+		card = h.teamsParticipate(r.Context(), c, text)
+	case "randomize":
+		card = h.teamsRandomize(r.Context(), &a, c, text)
+	case "get":
+		card = h.teamsGet(r.Context(), &a, c, text)
+	default:
+		card = adaptiveCard(cardText(teamsUsage))
+	}
+
+	err = h.teams.reply(&a, card)
+	if err != nil {
+		h.logger.Println(err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) teamsInitialize(ctx context.Context, c *Caller, text string) *AdaptiveCard {
+	e, organizerOnly, err := h.CreateEvent(ctx, c, text)
+	if err != nil {
+		h.logger.Println(err)
+		return adaptiveCard(cardText(err.Error()))
+	}
+
+	msg := c.UserName + " just initiated " + eventTitle(e) + " for this channel"
+	if organizerOnly {
+		msg += " and is organizing it without taking part in the exchange"
+	}
+	body := []AdaptiveElement{cardHeading(eventTitle(e)), cardText(msg)}
+	body = append(body, cardFacts(bulletLines(eventDetails(e)))...)
+	return adaptiveCard(body...)
+}
+
+func (h *Handlers) teamsParticipate(ctx context.Context, c *Caller, text string) *AdaptiveCard {
+	e, p, err := h.Enroll(ctx, c, text)
+	if err != nil {
+		h.logger.Println(err)
+		return adaptiveCard(cardText(err.Error()))
+	}
+	return adaptiveCard(cardText(p.UserName + " just enrolled in " + eventTitle(e)))
+}
+
+func (h *Handlers) teamsRandomize(ctx context.Context, a *TeamsActivity, c *Caller, text string) *AdaptiveCard {
+	e, err := h.Draw(ctx, c, text, func(e *Event, d *Draw) {
+		err := h.teams.reply(a, adaptiveCard(
+			cardText(c.UserName+" is drawing the pairs of "+eventTitle(e)+". Its seed will be revealed on reveal day."),
+			AdaptiveElement{Type: "FactSet", Facts: []AdaptiveFact{{Title: "Commitment", Value: d.Commitment}}},
+		))
+		if err != nil {
+			h.logger.Println(err)
+		}
+	})
+	if err != nil {
+		h.logger.Println(err)
+		return adaptiveCard(cardText(err.Error()))
+	}
+
+	count := len(e.Draw.ParticipantIds)
+	return adaptiveCard(cardText(eventTitle(e) + " pairs have been randomized for " + strconv.Itoa(count) + " participants! Everybody has been sent their match in a personal chat."))
+}
+
+// teamsGet sends the user their match in their personal chat with the
+// bot, as Teams has no messages only one member of a channel can see.
+func (h *Handlers) teamsGet(ctx context.Context, a *TeamsActivity, c *Caller, text string) *AdaptiveCard {
+	as, err := h.GetAssignment(ctx, c, text)
+	if err != nil {
+		h.logger.Println(err)
+		return adaptiveCard(cardText(err.Error()))
+	}
+
+	tenantId := ""
+	if c.TeamId != nil {
+		tenantId = *c.TeamId
+	}
+	err = h.teams.sendDirect(a.ServiceUrl, tenantId, c.UserId, noticeCard(matchNotice(as.Event, as.Participant, as.Wishlists)))
+	if err != nil {
+		h.logger.Println(err)
+		return adaptiveCard(cardText("Your match could not be sent to you, please try again later."))
+	}
+	return adaptiveCard(cardText("I have sent you your " + eventTitle(as.Event) + " match in our personal chat."))
+}
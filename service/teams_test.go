@@ -0,0 +1,125 @@
+// teams_test.go
+package service
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// signTeamsToken signs claims the way the Bot Framework does.
+func signTeamsToken(t *testing.T, key *rsa.PrivateKey, alg string, claims map[string]interface{}) string {
+	segment := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := segment(map[string]string{"alg": alg, "kid": "K1"}) + "." + segment(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestTeamsAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewTeamsClient("APP", "secret")
+	c.keys = map[string]teamsKey{"K1": {endorsements: []string{"msteams"}, key: &key.PublicKey}}
+	c.keysFetchedAt = time.Now()
+
+	a := &TeamsActivity{ChannelId: "msteams", ServiceUrl: "https://smba.trafficmanager.net/emea/"}
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		now := time.Now().Unix()
+		claims := map[string]interface{}{"aud": "APP", "exp": now + 3600, "iss": teamsIssuer, "nbf": now - 60, "serviceurl": a.ServiceUrl}
+		if change != nil {
+			change(claims)
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		channel string
+		wantErr bool
+	}{
+		{"valid", signTeamsToken(t, key, "RS256", claims(nil)), "msteams", false},
+		{"other bot", signTeamsToken(t, key, "RS256", claims(func(c map[string]interface{}) { c["aud"] = "OTHER" })), "msteams", true},
+		{"other issuer", signTeamsToken(t, key, "RS256", claims(func(c map[string]interface{}) { c["iss"] = "https://example.com" })), "msteams", true},
+		{"expired", signTeamsToken(t, key, "RS256", claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() })), "msteams", true},
+		{"not valid yet", signTeamsToken(t, key, "RS256", claims(func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() })), "msteams", true},
+		{"other service URL", signTeamsToken(t, key, "RS256", claims(func(c map[string]interface{}) { c["serviceurl"] = "https://example.com/" })), "msteams", true},
+		{"not endorsed", signTeamsToken(t, key, "RS256", claims(nil)), "skype", true},
+		{"signed by another key", signTeamsToken(t, other, "RS256", claims(nil)), "msteams", true},
+		{"other algorithm", signTeamsToken(t, key, "none", claims(nil)), "msteams", true},
+		{"malformed", "abc.def", "msteams", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/teams", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			activity := *a
+			activity.ChannelId = tt.channel
+
+			err = c.authenticate(r, &activity)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTeamsRequest(t *testing.T) {
+	a := &TeamsActivity{
+		ChannelData:  &TeamsChannelData{Channel: &TeamsAccount{Id: "19:channel"}, Tenant: &TeamsAccount{Id: "tenant"}},
+		Conversation: &TeamsAccount{Id: "19:channel;messageid=1"},
+		From:         &TeamsAccount{Id: "29:user", Name: "Jane"},
+		Text:         "<at>Santa</at> Initialize 1&nbsp;Main St,&nbsp;Springfield\n",
+	}
+
+	command, text, caller := teamsRequest(a)
+	if command != "initialize" {
+		t.Errorf("command = %q, want initialize", command)
+	}
+	if text != "1 Main St, Springfield" {
+		t.Errorf("text = %q, want 1 Main St, Springfield", text)
+	}
+	if *caller.ChannelId != "19:channel" || caller.Platform != PlatformTeams || *caller.TeamId != "tenant" || caller.UserId != "29:user" {
+		t.Errorf("teamsRequest() = %+v", caller)
+	}
+}
+
+func TestCardFacts(t *testing.T) {
+	got := cardFacts([]string{"Budget: 25 EUR", "Handmade only"})
+	want := []AdaptiveElement{{Type: "FactSet", Facts: []AdaptiveFact{{Title: "Budget", Value: "25 EUR"}, {Title: "Handmade only"}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cardFacts() = %+v, want %+v", got, want)
+	}
+	if got := cardFacts(nil); got != nil {
+		t.Errorf("cardFacts(nil) = %+v, want nil", got)
+	}
+}
@@ -3,39 +3,220 @@ package service
 
 import (
 	"bytes"
-	"crypto/tls"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// httpTimeout bounds every call to the chat platforms. Scheduled jobs make
+// such calls, so it must stay well below jobLease: a call hanging past the
+// lease would let another replica run the job again.
+const httpTimeout time.Duration = 30 * time.Second
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// SendSlackMessage answers a command on its response URL, which Mattermost
+// accepts too.
 func SendSlackMessage(url string, resType string, msg string) error {
 	jsonData := new(bytes.Buffer)
 	json.NewEncoder(jsonData).Encode(&SlackMessage{resType, msg})
 	req, err := http.NewRequest("POST", url, jsonData)
-	//var jsonData = []byte(`{"response_type": "` + resType + `", "text": "` + msg + `"}`)
-	//req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	client := &http.Client{Transport: customTransport}
-
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	fmt.Println("response Status:", resp.Status)
-	fmt.Println("response Headers:", resp.Header)
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("answering on the response URL failed: " + resp.Status)
+	}
+	return nil
+}
+
+const slackApiUrl string = "https://slack.com/api/"
+
+// PostSlackMessage posts a message on behalf of the bot. Unlike response
+// URLs, which expire shortly after a command, the bot token can be used
+// at any time, e.g. by scheduled jobs. A user ID as channel sends a DM.
+func PostSlackMessage(token string, channel string, msg string) (*SlackApiResponse, error) {
+	return callSlackApi(token, "chat.postMessage", map[string]string{"channel": channel, "text": msg})
+}
+
+// PostSlackReply posts a message in the thread of the message with the
+// given timestamp.
+func PostSlackReply(token string, channel string, threadTs string, msg string) (*SlackApiResponse, error) {
+	return callSlackApi(token, "chat.postMessage", map[string]string{"channel": channel, "text": msg, "thread_ts": threadTs})
+}
+
+// PostSlackBlocks posts a Block Kit message on behalf of the bot. The text
+// is shown where blocks cannot be, e.g. in notifications.
+func PostSlackBlocks(token string, channel string, text string, blocks []SlackBlock) (*SlackApiResponse, error) {
+	return callSlackApi(token, "chat.postMessage", map[string]interface{}{"channel": channel, "text": text, "blocks": blocks})
+}
+
+// UpdateSlackMessage replaces the text of a message the bot posted and
+// drops its blocks, e.g. buttons that have been used.
+func UpdateSlackMessage(token string, channel string, ts string, text string) error {
+	_, err := callSlackApi(token, "chat.update", map[string]interface{}{"channel": channel, "ts": ts, "text": text, "blocks": []SlackBlock{}})
+	return err
+}
+
+// OpenSlackView opens a modal in response to an interaction.
+func OpenSlackView(token string, triggerId string, view *SlackView) error {
+	_, err := callSlackApi(token, "views.open", map[string]interface{}{"trigger_id": triggerId, "view": view})
+	return err
+}
+
+// GetChannelMembers returns the IDs of all members of the channel.
+func GetChannelMembers(token string, channel string) ([]string, error) {
+	var members []string
+	cursor := ""
+	for {
+		args := url.Values{"channel": {channel}, "limit": {"200"}}
+		if cursor != "" {
+			args.Set("cursor", cursor)
+		}
+		res, err := getSlackApi(token, "conversations.members", args)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, res.Members...)
+
+		cursor = res.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return members, nil
+		}
+	}
+}
+
+// DeleteSlackMessage deletes a message the bot posted, identified by the
+// channel and timestamp returned by PostSlackMessage.
+func DeleteSlackMessage(token string, channel string, ts string) error {
+	_, err := callSlackApi(token, "chat.delete", map[string]string{"channel": channel, "ts": ts})
+	return err
+}
+
+func callSlackApi(token string, method string, args interface{}) (*SlackApiResponse, error) {
+	jsonData := new(bytes.Buffer)
+	json.NewEncoder(jsonData).Encode(args)
+	req, err := http.NewRequest("POST", slackApiUrl+method, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doSlackApi(method, req)
+}
+
+func doSlackApi(method string, req *http.Request) (*SlackApiResponse, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res SlackApiResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Ok {
+		return nil, errors.New(method + " failed: " + res.Error)
+	}
+
+	return &res, nil
+}
+
+// getSlackApi calls a read method of the Slack Web API. Unlike write
+// methods, these do not accept JSON bodies.
+func getSlackApi(token string, method string, args url.Values) (*SlackApiResponse, error) {
+	req, err := http.NewRequest("GET", slackApiUrl+method+"?"+args.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doSlackApi(method, req)
+}
+
+const (
+	slackRequestMaxAge    time.Duration = 5 * time.Minute
+	slackRequestSizeLimit int64         = 1 << 20
+)
+
+// verifySlackSignature checks the signature Slack sends its requests with:
+// an HMAC-SHA256 of the request's timestamp and body keyed with the
+// signing secret of the app.
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	if secret == "" {
+		return errors.New("the Slack request cannot be verified without a signing secret")
+	}
+
+	ts := header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("the Slack request has no valid timestamp")
+	}
+	age := now.Sub(time.Unix(sec, 0))
+	if age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return errors.New("the Slack request is too old")
+	}
 
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return errors.New("the Slack request signature does not match")
+	}
 	return nil
 }
 
+// newSlackRequest reads a slash command from its form, which must have
+// been parsed.
+func newSlackRequest(r *http.Request) *SlackRequest {
+	return &SlackRequest{
+		Caller: Caller{
+			ChannelId:   String(r.PostForm.Get("channel_id")),
+			Platform:    PlatformSlack,
+			ResponseUrl: r.PostForm.Get("response_url"),
+			TeamId:      String(r.PostForm.Get("team_id")),
+			UserId:      r.PostForm.Get("user_id"),
+			UserName:    r.PostForm.Get("user_name"),
+		},
+		ChannelName: String(r.PostForm.Get("channel_name")),
+		Command:     String(r.PostForm.Get("command")),
+		TeamDomain:  String(r.PostForm.Get("team_domain")),
+		Text:        String(r.PostForm.Get("text")),
+		Token:       String(r.PostForm.Get("token")),
+		TriggerId:   String(r.PostForm.Get("trigger_id")),
+	}
+}
+
+func writeSlackMessage(w http.ResponseWriter, resType string, msg string) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&SlackMessage{resType, msg})
+}
+
+// writeSlackBlocks responds with a Block Kit message. The text is shown
+// where blocks cannot be, e.g. in notifications.
+func writeSlackBlocks(w http.ResponseWriter, resType string, text string, blocks []SlackBlock) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&SlackBlocksMessage{Blocks: blocks, ResponseType: resType, Text: text})
+}
+
 func String(s string) *string {
 	return &s
 }
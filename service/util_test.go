@@ -0,0 +1,161 @@
+// util_test.go
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signSlack sets the headers Slack signs its requests with.
+func signSlack(header http.Header, secret string, body string, at time.Time) {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	header.Set("X-Slack-Request-Timestamp", ts)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := "command=%2Fsanta&user_id=U1"
+	tests := []struct {
+		name    string
+		secret  string
+		sign    func(h http.Header)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			secret: "secret",
+			sign:   func(h http.Header) { signSlack(h, "secret", body, now) },
+		},
+		{
+			name:   "a little ahead",
+			secret: "secret",
+			sign:   func(h http.Header) { signSlack(h, "secret", body, now.Add(time.Minute)) },
+		},
+		{
+			name:    "no signing secret",
+			secret:  "",
+			sign:    func(h http.Header) { signSlack(h, "", body, now) },
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			secret:  "secret",
+			sign:    func(h http.Header) {},
+			wantErr: true,
+		},
+		{
+			name:    "other secret",
+			secret:  "secret",
+			sign:    func(h http.Header) { signSlack(h, "other", body, now) },
+			wantErr: true,
+		},
+		{
+			name:    "other body",
+			secret:  "secret",
+			sign:    func(h http.Header) { signSlack(h, "secret", body+"&user_id=U2", now) },
+			wantErr: true,
+		},
+		{
+			name:    "too old",
+			secret:  "secret",
+			sign:    func(h http.Header) { signSlack(h, "secret", body, now.Add(-slackRequestMaxAge-time.Second)) },
+			wantErr: true,
+		},
+		{
+			name:    "too far ahead",
+			secret:  "secret",
+			sign:    func(h http.Header) { signSlack(h, "secret", body, now.Add(slackRequestMaxAge+time.Second)) },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			tt.sign(header)
+			err := verifySlackSignature(tt.secret, header, []byte(body), now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifySlackSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySlack(t *testing.T) {
+	h := &Handlers{
+		SecretSanta:   &SecretSanta{logger: log.New(io.Discard, "", 0)},
+		signingSecret: "secret",
+	}
+	body := "command=%2Fsanta&user_id=U1"
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus int
+	}{
+		{"signed", "secret", http.StatusOK},
+		{"forged", "other", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := h.verifySlack(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				got = string(b)
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/santa", strings.NewReader(body))
+			signSlack(r.Header, tt.secret, body, time.Now())
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && got != body {
+				t.Errorf("handler read %q, want the body %q", got, body)
+			}
+		})
+	}
+}
+
+func TestSendSlackMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"answered", http.StatusOK, false},
+		{"expired", http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got SlackMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := SendSlackMessage(server.URL, ResponseTypeEphemeral, "Hello")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SendSlackMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Text != "Hello" || got.ResponseType != ResponseTypeEphemeral {
+				t.Errorf("response URL received %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,1059 @@
+// web.go
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const slackOpenIdUrl string = "https://slack.com/openid/connect/authorize"
+
+const (
+	webSessionCookie string = "santa_session"
+	webStateCookie   string = "santa_state"
+)
+
+const webSessionTtl = 12 * time.Hour
+
+// WebUI serves the self-service pages: participants enroll and keep their
+// address and wishlist up to date, look up their giftees, and hosts run
+// their events. Users sign in with Slack, so only Slack events are
+// available on the web.
+type WebUI struct {
+	baseUrl      string
+	clientId     string
+	clientSecret string
+	pages        *htmltemplate.Template
+	sessionKey   []byte
+}
+
+// NewWebUI returns the web UI served at baseUrl, signing users in with the
+// Slack app of the given client ID and secret. Sessions are signed with
+// the base64 encoded session key. It returns nil if no client ID is
+// configured.
+func NewWebUI(baseUrl string, clientId string, clientSecret string, sessionKey string) (*WebUI, error) {
+	if clientId == "" {
+		return nil, nil
+	}
+	if baseUrl == "" {
+		return nil, errors.New("the web UI needs the URL it is served at")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) < 32 {
+		return nil, errors.New("the web session key must be a base64 encoded key of at least 32 bytes")
+	}
+
+	pages, err := htmltemplate.ParseFS(templateFiles, "templates/web/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebUI{
+		baseUrl:      strings.TrimSuffix(baseUrl, "/"),
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		pages:        pages,
+		sessionKey:   key,
+	}, nil
+}
+
+// webSession is who is signed in. It is kept in a cookie, signed so that
+// it cannot be forged. Csrf is sent along with every form.
+type webSession struct {
+	Csrf      string    `json:"csrf"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	TeamId    string    `json:"teamId"`
+	UserId    string    `json:"userId"`
+	UserName  string    `json:"userName"`
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (u *WebUI) sign(data string) string {
+	mac := hmac.New(sha256.New, u.sessionKey)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (u *WebUI) setCookie(w http.ResponseWriter, name string, value string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		HttpOnly: true,
+		MaxAge:   int(ttl.Seconds()),
+		Name:     name,
+		Path:     "/web",
+		SameSite: http.SameSiteLaxMode,
+		Secure:   strings.HasPrefix(u.baseUrl, "https://"),
+		Value:    value,
+	})
+}
+
+func (u *WebUI) setSession(w http.ResponseWriter, s *webSession) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	data := base64.RawURLEncoding.EncodeToString(b)
+	u.setCookie(w, webSessionCookie, data+"."+u.sign(data), webSessionTtl)
+	return nil
+}
+
+// session returns who is signed in, or nil if nobody is.
+func (u *WebUI) session(r *http.Request) *webSession {
+	cookie, err := r.Cookie(webSessionCookie)
+	if err != nil {
+		return nil
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(u.sign(parts[0]))) {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil
+	}
+	var s webSession
+	if json.Unmarshal(b, &s) != nil || time.Now().After(s.ExpiresAt) {
+		return nil
+	}
+	return &s
+}
+
+func (u *WebUI) redirectUrl() string {
+	return u.baseUrl + "/web/auth/callback"
+}
+
+// callSlackOpenId calls a method of Sign in with Slack and decodes its
+// response into v, which embeds the ok and error fields of every response.
+func callSlackOpenId(req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&raw)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		Error string `json:"error"`
+		Ok    bool   `json:"ok"`
+	}
+	err = json.Unmarshal(raw, &status)
+	if err != nil {
+		return err
+	}
+	if !status.Ok {
+		return errors.New(req.URL.Path + " failed: " + status.Error)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// signIn exchanges the code Slack redirected the user back with for who
+// they are.
+func (u *WebUI) signIn(code string) (*webSession, error) {
+	form := url.Values{
+		"client_id":     {u.clientId},
+		"client_secret": {u.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {u.redirectUrl()},
+	}
+	req, err := http.NewRequest(http.MethodPost, slackApiUrl+"openid.connect.token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = callSlackOpenId(req, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err = http.NewRequest(http.MethodGet, slackApiUrl+"openid.connect.userInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	var user struct {
+		Name   string `json:"name"`
+		TeamId string `json:"https://slack.com/team_id"`
+		UserId string `json:"https://slack.com/user_id"`
+	}
+	err = callSlackOpenId(req, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return &webSession{
+		Csrf:      csrf,
+		ExpiresAt: time.Now().Add(webSessionTtl),
+		TeamId:    user.TeamId,
+		UserId:    user.UserId,
+		UserName:  user.Name,
+	}, nil
+}
+
+func (h *Handlers) setupWebRoutes(mux *mux.Router) {
+	web := mux.PathPrefix("/web").Subrouter()
+	web.HandleFunc("/", h.WebHomeHandler).Methods(http.MethodGet)
+	web.HandleFunc("/signin", h.WebSignInHandler).Methods(http.MethodGet)
+	web.HandleFunc("/auth/callback", h.WebCallbackHandler).Methods(http.MethodGet)
+	web.HandleFunc("/signout", h.webHandler(h.webSignOut)).Methods(http.MethodPost)
+	web.HandleFunc("/my-data", h.webHandler(h.webMyData)).Methods(http.MethodGet)
+	web.HandleFunc("/events/{eventId}", h.webHandler(h.webEvent)).Methods(http.MethodGet)
+	web.HandleFunc("/events/{eventId}/enroll", h.webHandler(h.webEnroll)).Methods(http.MethodPost)
+	web.HandleFunc("/events/{eventId}/profile", h.webHandler(h.webProfile)).Methods(http.MethodPost)
+	web.HandleFunc("/events/{eventId}/giftee", h.webHandler(h.webGiftee)).Methods(http.MethodGet)
+	web.HandleFunc("/events/{eventId}/host", h.webHandler(h.webHost)).Methods(http.MethodGet)
+	web.HandleFunc("/events/{eventId}/host/settings", h.webHandler(h.webSettings)).Methods(http.MethodPost)
+	web.HandleFunc("/events/{eventId}/host/exclusions", h.webHandler(h.webExclusions)).Methods(http.MethodPost)
+	web.HandleFunc("/events/{eventId}/host/draw", h.webHandler(h.webDraw)).Methods(http.MethodPost)
+	web.HandleFunc("/events/{eventId}/host/export", h.webHandler(h.webExport)).Methods(http.MethodGet)
+	web.HandleFunc("/events/{eventId}/host/import", h.webHandler(h.webImport)).Methods(http.MethodPost)
+}
+
+// webPage is what the page templates are rendered with. Only the fields
+// of the page at hand are set.
+type webPage struct {
+	Csrf     string
+	Error    string
+	Notice   string
+	Title    string
+	UserName string
+
+	CanExport   bool
+	Details     []string
+	EventId     string
+	Events      []webEventLink
+	Exclusions  []webExclusion
+	Giftees     []NoticeGiftee
+	Import      *ImportReport
+	IsHost      bool
+	IsMatched   bool
+	IsOpen      bool
+	IsRevealed  bool
+	Participant *webProfile
+	Roster      []ApiParticipant
+	Settings    map[string]string
+	Status      *ApiStatus
+}
+
+type webEventLink struct {
+	Id            string
+	IsHost        bool
+	IsParticipant bool
+	Status        string
+	Title         string
+}
+
+type webExclusion struct {
+	FirstId    string
+	FirstName  string
+	SecondId   string
+	SecondName string
+}
+
+// webProfile is what a participant keeps up to date themselves.
+type webProfile struct {
+	Address   string
+	Allergies string
+	Email     string
+	Items     string
+	Links     string
+	NoThanks  string
+	Sizes     string
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (h *Handlers) renderWeb(w http.ResponseWriter, r *http.Request, status int, name string, s *webSession, p *webPage) {
+	if s != nil {
+		p.Csrf = s.Csrf
+		p.UserName = s.UserName
+	}
+	if p.Notice == "" {
+		p.Notice = webNotices[r.URL.Query().Get("notice")]
+	}
+	if p.Error == "" {
+		p.Error = webErrors[r.URL.Query().Get("error")]
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err := h.web.pages.ExecuteTemplate(w, name+".html", p)
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// webMessage is what users are told about an error. Errors that are not
+// domain errors may tell about the internals of the service, so they are
+// only logged.
+func (h *Handlers) webMessage(err error) string {
+	h.logger.Println(err)
+	if ErrorKind(err) == "" {
+		return "Something went wrong, please try again later"
+	}
+	return err.Error()
+}
+
+func (h *Handlers) webFailure(w http.ResponseWriter, r *http.Request, s *webSession, err error) {
+	h.renderWeb(w, r, httpStatus(ErrorKind(err)), "error", s, &webPage{Error: h.webMessage(err), Title: "Secret Santa"})
+}
+
+// Pages shown after a form has been submitted are told how it went by the
+// code of a message rather than its text, so that links to them cannot
+// make the service say whatever they like. Unknown codes are ignored.
+const (
+	webNoticeDrawn            string = "drawn"
+	webNoticeEnrolled         string = "enrolled"
+	webNoticeExcluded         string = "excluded"
+	webNoticeExclusionRemoved string = "exclusionRemoved"
+	webNoticeProfileSaved     string = "profileSaved"
+	webNoticeSettingsSaved    string = "settingsSaved"
+)
+
+var webNotices = map[string]string{
+	webNoticeDrawn:            "The pairs have been drawn and everybody has been sent their match",
+	webNoticeEnrolled:         "You have enrolled",
+	webNoticeExcluded:         "The two participants will not be matched with each other",
+	webNoticeExclusionRemoved: "The two participants may be matched again",
+	webNoticeProfileSaved:     "Your details have been saved",
+	webNoticeSettingsSaved:    "The settings have been saved",
+}
+
+// Errors are told by their kind, or by their own code if their message is
+// one of webErrors.
+const (
+	webErrorInternal string = "internal"
+	webErrorNoRoster string = "noRoster"
+	webErrorSamePair string = "samePair"
+)
+
+var webErrors = map[string]string{
+	ErrorKindConflict:  "This cannot be done at this stage of the event",
+	ErrorKindForbidden: "You are not allowed to do this",
+	ErrorKindInvalid:   "Some of what you entered is not valid, please check it and try again",
+	ErrorKindNotFound:  "The event or participant could not be found",
+	webErrorInternal:   "Something went wrong, please try again later",
+	webErrorNoRoster:   "Please choose a CSV file to import",
+	webErrorSamePair:   "Please pick two different participants",
+}
+
+// webErrorCode logs the error and returns the code of the message users
+// are told about it.
+func (h *Handlers) webErrorCode(err error) string {
+	h.logger.Println(err)
+	kind := ErrorKind(err)
+	if kind == "" {
+		return webErrorInternal
+	}
+	for code, msg := range webErrors {
+		if err.Error() == msg {
+			return code
+		}
+	}
+	return kind
+}
+
+// webRedirect shows the page at path after a form has been submitted,
+// telling the user how it went with the code of a notice or the error.
+func (h *Handlers) webRedirect(w http.ResponseWriter, r *http.Request, path string, notice string, err error) {
+	q := url.Values{}
+	if err != nil {
+		q.Set("error", h.webErrorCode(err))
+	} else if notice != "" {
+		q.Set("notice", notice)
+	}
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	http.Redirect(w, r, path, http.StatusSeeOther)
+}
+
+// webHandler passes on who is signed in, and checks that forms were sent
+// from the pages of the service.
+func (h *Handlers) webHandler(fn func(w http.ResponseWriter, r *http.Request, s *webSession)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.web == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s := h.web.session(r)
+		if s == nil {
+			http.Redirect(w, r, "/web/", http.StatusSeeOther)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			// Rosters are uploaded as multipart forms, everything else is
+			// sent as a plain form.
+			r.Body = http.MaxBytesReader(w, r.Body, RosterSizeLimit)
+			err := r.ParseMultipartForm(RosterSizeLimit)
+			if err == http.ErrNotMultipart {
+				err = r.ParseForm()
+			}
+			if err != nil || subtle.ConstantTimeCompare([]byte(r.PostForm.Get("csrf")), []byte(s.Csrf)) != 1 {
+				h.renderWeb(w, r, http.StatusForbidden, "error", s, &webPage{Error: "This form has expired, please go back and try again", Title: "Secret Santa"})
+				return
+			}
+		}
+
+		fn(w, r, s)
+	}
+}
+
+func webCaller(s *webSession) *Caller {
+	return &Caller{
+		Platform: PlatformSlack,
+		TeamId:   String(s.TeamId),
+		UserId:   s.UserId,
+		UserName: s.UserName,
+	}
+}
+
+// isChannelMember reports whether the user may see the events of the
+// channel, which they can in Slack only if they are in it.
+func (h *Handlers) isChannelMember(channelId *string, uid string) bool {
+	if channelId == nil {
+		return false
+	}
+	members, err := GetChannelMembers(h.botToken, *channelId)
+	if err != nil {
+		h.logger.Println(err)
+		return false
+	}
+	return containsUser(members, uid)
+}
+
+// webEventOf returns the event with the given ID if the user may see it,
+// together with the caller acting on it and the user's participant
+// record, which is nil unless they take part.
+func (h *Handlers) webEventOf(ctx context.Context, s *webSession, id string) (*Event, *Caller, *Participant, error) {
+	c := webCaller(s)
+	e, err := h.workspaceEvent(ctx, c, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p, err := h.repo.GetParticipantById(ctx, e.Id, s.UserId)
+	if err != nil {
+		p = nil
+	}
+	if p == nil && authorizeHost(e, s.UserId, HostActionViewStatus) != nil && !h.isChannelMember(e.ChannelId, s.UserId) {
+		return nil, nil, nil, ErrEventNotFound
+	}
+	return e, c, p, nil
+}
+
+func webEventPath(e *Event) string {
+	return "/web/events/" + url.PathEscape(e.Id)
+}
+
+// WebHomeHandler lists the events the user can take part in, or asks them
+// to sign in.
+func (h *Handlers) WebHomeHandler(w http.ResponseWriter, r *http.Request) {
+	if h.web == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s := h.web.session(r)
+	if s == nil {
+		h.renderWeb(w, r, http.StatusOK, "signin", nil, &webPage{Title: "Secret Santa"})
+		return
+	}
+
+	events, err := h.repo.FindTeamEvents(r.Context(), String(s.TeamId))
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	members := make(map[string]bool)
+	var links []webEventLink
+	for i := range events {
+		e := &events[i]
+		if eventPlatform(e) != PlatformSlack || !isActiveEvent(e) || e.ChannelId == nil {
+			continue
+		}
+
+		link := webEventLink{Id: e.Id, Status: apiEvent(e).Status, Title: eventTitle(e)}
+		link.IsHost = authorizeHost(e, s.UserId, HostActionViewStatus) == nil
+		_, err := h.repo.GetParticipantById(r.Context(), e.Id, s.UserId)
+		link.IsParticipant = err == nil
+		if !link.IsHost && !link.IsParticipant {
+			member, ok := members[*e.ChannelId]
+			if !ok {
+				member = h.isChannelMember(e.ChannelId, s.UserId)
+				members[*e.ChannelId] = member
+			}
+			if !member {
+				continue
+			}
+		}
+		links = append(links, link)
+	}
+
+	h.renderWeb(w, r, http.StatusOK, "home", s, &webPage{Events: links, Title: "Secret Santa"})
+}
+
+// WebSignInHandler sends the user to Slack to sign in.
+func (h *Handlers) WebSignInHandler(w http.ResponseWriter, r *http.Request) {
+	if h.web == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		h.webFailure(w, r, nil, err)
+		return
+	}
+	h.web.setCookie(w, webStateCookie, state, 10*time.Minute)
+
+	q := url.Values{
+		"client_id":     {h.web.clientId},
+		"nonce":         {state},
+		"redirect_uri":  {h.web.redirectUrl()},
+		"response_type": {"code"},
+		"scope":         {"openid profile"},
+		"state":         {state},
+	}
+	http.Redirect(w, r, slackOpenIdUrl+"?"+q.Encode(), http.StatusSeeOther)
+}
+
+// WebCallbackHandler signs the user in once Slack sends them back.
+func (h *Handlers) WebCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.web == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	state, err := r.Cookie(webStateCookie)
+	if err != nil || q.Get("state") == "" || subtle.ConstantTimeCompare([]byte(state.Value), []byte(q.Get("state"))) != 1 {
+		h.webFailure(w, r, nil, invalidError("Signing in took too long, please try again"))
+		return
+	}
+	h.web.setCookie(w, webStateCookie, "", -time.Second)
+
+	if q.Get("error") != "" {
+		h.webFailure(w, r, nil, forbiddenError("You did not sign in with Slack"))
+		return
+	}
+
+	s, err := h.web.signIn(q.Get("code"))
+	if err != nil {
+		h.webFailure(w, r, nil, err)
+		return
+	}
+	err = h.web.setSession(w, s)
+	if err != nil {
+		h.webFailure(w, r, nil, err)
+		return
+	}
+	http.Redirect(w, r, "/web/", http.StatusSeeOther)
+}
+
+func (h *Handlers) webSignOut(w http.ResponseWriter, r *http.Request, s *webSession) {
+	h.web.setCookie(w, webSessionCookie, "", -time.Second)
+	http.Redirect(w, r, "/web/", http.StatusSeeOther)
+}
+
+// webEvent shows the user an event: how to enroll, or their address and
+// wishlist once they have.
+func (h *Handlers) webEvent(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, p, err := h.webEventOf(r.Context(), s, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	page := &webPage{
+		Details: bulletLines(eventDetails(e)),
+		EventId: e.Id,
+		IsHost:  authorizeHost(e, s.UserId, HostActionViewStatus) == nil,
+		IsOpen:  checkEventActive(e) == nil && checkEnrollmentOpen(e, time.Now()) == nil,
+		Title:   eventTitle(e),
+	}
+	if p != nil {
+		page.IsMatched = p.IsMatched
+		page.Participant = &webProfile{Address: value(p.Address), Email: value(p.Email)}
+		if p.Wishlist != nil {
+			page.Participant.Allergies = value(p.Wishlist.Allergies)
+			page.Participant.Items = value(p.Wishlist.Items)
+			page.Participant.Links = value(p.Wishlist.Links)
+			page.Participant.NoThanks = value(p.Wishlist.NoThanks)
+			page.Participant.Sizes = value(p.Wishlist.Sizes)
+		}
+	}
+	h.renderWeb(w, r, http.StatusOK, "event", s, page)
+}
+
+func (h *Handlers) webEnroll(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, c, _, err := h.webEventOf(r.Context(), s, mux.Vars(r)["eventId"])
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	email, err := parseEmail(strings.TrimSpace(r.PostForm.Get("email")))
+	if err == nil {
+		err = checkEventActive(e)
+	}
+	if err == nil {
+		_, err = h.enroll(r.Context(), c, e, strings.TrimSpace(r.PostForm.Get("address")), email)
+	}
+	if err != nil {
+		h.webRedirect(w, r, webEventPath(e), "", err)
+		return
+	}
+
+	channelId := value(e.ChannelId)
+	_, err = PostSlackMessage(h.botToken, channelId, "<@"+s.UserId+"> just enrolled in "+eventTitle(e)+" for the Slack channel <#"+channelId+">")
+	if err != nil {
+		h.logger.Println(err)
+	}
+
+	h.webRedirect(w, r, webEventPath(e), webNoticeEnrolled, nil)
+}
+
+// webProfile saves the address, email address and wishlist of the user.
+// The address cannot change once pairs are matched, as their santa has
+// been sent it already.
+func (h *Handlers) webProfile(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, p, err := h.webEventOf(r.Context(), s, mux.Vars(r)["eventId"])
+	if err == nil && p == nil {
+		err = notFoundError("You are not taking part in " + eventTitle(e))
+	}
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	err = h.saveProfile(r.Context(), e, p, r.PostForm)
+	h.webRedirect(w, r, webEventPath(e), webNoticeProfileSaved, err)
+}
+
+func (h *Handlers) saveProfile(ctx context.Context, e *Event, p *Participant, form url.Values) error {
+	address := strings.TrimSpace(form.Get("address"))
+	if !p.IsMatched && address != value(p.Address) {
+		if len(address) < 5 {
+			return invalidError("Please provide a valid postal address")
+		}
+		err := h.repo.UpdateAddress(ctx, e.Id, p.UserId, String(address))
+		if err != nil {
+			return err
+		}
+	}
+
+	email, err := parseEmail(strings.TrimSpace(form.Get("email")))
+	if err != nil {
+		return err
+	}
+	err = h.repo.UpdateEmail(ctx, e.Id, p.UserId, email)
+	if err != nil {
+		return err
+	}
+
+	wl := &Wishlist{}
+	applyWishlist(wl, map[string]string{
+		"allergies": form.Get("allergies"),
+		"items":     form.Get("items"),
+		"links":     form.Get("links"),
+		"no":        form.Get("no"),
+		"sizes":     form.Get("sizes"),
+	})
+	lines := wishlistLines(wl)
+	if lines == wishlistLines(p.Wishlist) {
+		return nil
+	}
+	if lines == "" {
+		wl = nil
+	}
+	err = h.repo.UpdateWishlist(ctx, e.Id, p.UserId, wl)
+	if err != nil {
+		return err
+	}
+
+	if lines == "" {
+		lines = "\nThe wishlist is empty now."
+	}
+	h.tellSantasAboutWishlist(ctx, e, p.UserId, lines)
+	return nil
+}
+
+// webGiftee shows the user whom they give a gift to.
+func (h *Handlers) webGiftee(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, p, err := h.webEventOf(r.Context(), s, mux.Vars(r)["eventId"])
+	if err == nil && p == nil {
+		err = notFoundError("You are not taking part in " + eventTitle(e))
+	}
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	a, err := h.assignment(r.Context(), e, p)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	n := matchNotice(a.Event, a.Participant, a.Wishlists)
+	h.renderWeb(w, r, http.StatusOK, "giftee", s, &webPage{
+		Details: n.Details,
+		EventId: e.Id,
+		Giftees: n.Giftees,
+		Title:   eventTitle(e),
+	})
+}
+
+// webHostEvent returns the event if the user may run the host action on
+// it.
+func (h *Handlers) webHostEvent(ctx context.Context, s *webSession, id string, action string) (*Event, *Caller, error) {
+	e, c, _, err := h.webEventOf(ctx, s, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = authorizeHost(e, s.UserId, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, c, nil
+}
+
+// webHost is the console of hosts: the event's settings, its roster and
+// exclusions, and the draw. Like /santa status it never shows who gives
+// to whom.
+func (h *Handlers) webHost(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionViewStatus)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+	h.renderHost(w, r, s, e, nil)
+}
+
+// renderHost renders the console of the event, with the report of a
+// roster import if one has just been uploaded.
+func (h *Handlers) renderHost(w http.ResponseWriter, r *http.Request, s *webSession, e *Event, report *ImportReport) {
+	participants, err := h.repo.GetAllParticipants(r.Context(), e.Id)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	// Sorted by name rather than in enrollment order, which could hint at
+	// how pairs were drawn.
+	sort.Slice(participants, func(i, j int) bool {
+		return strings.ToLower(participants[i].UserName) < strings.ToLower(participants[j].UserName)
+	})
+
+	names := make(map[string]string)
+	var roster []ApiParticipant
+	for i := range participants {
+		names[participants[i].UserId] = participants[i].UserName
+		roster = append(roster, apiParticipant(&participants[i]))
+	}
+
+	var exclusions []webExclusion
+	for _, x := range e.Exclusions {
+		exclusions = append(exclusions, webExclusion{
+			FirstId:    x.FirstId,
+			FirstName:  webUserName(names, x.FirstId),
+			SecondId:   x.SecondId,
+			SecondName: webUserName(names, x.SecondId),
+		})
+	}
+
+	h.renderWeb(w, r, http.StatusOK, "host", s, &webPage{
+		CanExport:  authorizeHost(e, s.UserId, HostActionExport) == nil,
+		Details:    bulletLines(eventDetails(e)),
+		EventId:    e.Id,
+		Exclusions: exclusions,
+		Import:     report,
+		IsOpen:     e.Status == "" || e.Status == EventStatusOpen,
+		IsRevealed: e.Status == EventStatusArchived,
+		Roster:     roster,
+		Settings:   webSettings(e),
+		Status:     apiStatus(e, participants),
+		Title:      eventTitle(e),
+	})
+}
+
+func webUserName(names map[string]string, uid string) string {
+	if name := names[uid]; name != "" {
+		return name
+	}
+	return uid
+}
+
+// webSettings fills in the settings form with the event's settings, as
+// /santa settings would take them.
+func webSettings(e *Event) map[string]string {
+	settings := map[string]string{
+		"currency": value(e.Currency),
+		"giftees":  "1",
+		"rules":    value(e.Rules),
+		"theme":    value(e.Theme),
+	}
+	if e.Budget != nil {
+		settings["budget"] = strconv.FormatFloat(*e.Budget, 'f', -1, 64)
+	}
+	if e.ExchangeDate != nil {
+		settings["exchange"] = e.ExchangeDate.Format(dateLayout)
+	}
+	if e.GifteesEach > 1 {
+		settings["giftees"] = strconv.Itoa(e.GifteesEach)
+	}
+	if e.MatchByRegion {
+		settings["regions"] = "on"
+	}
+	return settings
+}
+
+func (h *Handlers) webSettings(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionConfigure)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+	path := webEventPath(e) + "/host"
+
+	// Every setting is on the form, but how many gifts everybody gives
+	// cannot be changed once pairs are matched, so it is only applied when
+	// it changes.
+	current := webSettings(e)
+	opts := make(map[string]string)
+	var details []string
+	for _, key := range settingKeys {
+		v := strings.TrimSpace(r.PostForm.Get(key))
+		if key == "regions" && v == "" {
+			v = "off"
+		}
+		if key == "giftees" && v == current[key] {
+			continue
+		}
+		opts[key] = v
+		details = append(details, key+"=\""+v+"\"")
+	}
+
+	e, err = h.updateEvent(r.Context(), e.Id, func(e *Event) error {
+		err := applySettings(e, opts)
+		if err != nil {
+			return invalidError(err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		h.webRedirect(w, r, path, "", err)
+		return
+	}
+
+	h.audit(r.Context(), e, s.UserId, HostActionConfigure, "", strings.Join(details, " "))
+
+	// The gift reminder depends on the exchange date.
+	err = h.scheduleReminders(r.Context(), e)
+	if err != nil {
+		h.webRedirect(w, r, path, "", err)
+		return
+	}
+
+	_, err = PostSlackMessage(h.botToken, value(e.ChannelId), "<@"+s.UserId+"> updated the "+eventTitle(e)+" settings:"+eventDetails(e))
+	if err != nil {
+		h.logger.Println(err)
+	}
+	h.webRedirect(w, r, path, webNoticeSettingsSaved, nil)
+}
+
+func (h *Handlers) webExclusions(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, _, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionExclude)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+	path := webEventPath(e) + "/host"
+
+	a, b := r.PostForm.Get("first"), r.PostForm.Get("second")
+	remove := r.PostForm.Get("remove") != ""
+	if a == "" || b == "" || a == b {
+		h.webRedirect(w, r, path, "", invalidError(webErrors[webErrorSamePair]))
+		return
+	}
+
+	names := make(map[string]string)
+	for _, uid := range []string{a, b} {
+		p, err := h.repo.GetParticipantById(r.Context(), e.Id, uid)
+		if err == nil {
+			names[uid] = p.UserName
+		}
+	}
+	pair := webUserName(names, a) + " and " + webUserName(names, b)
+
+	e, err = h.updateEvent(r.Context(), e.Id, func(e *Event) error {
+		return changeExclusion(e, a, b, remove, pair)
+	})
+	if err != nil {
+		h.webRedirect(w, r, path, "", err)
+		return
+	}
+
+	notice, details := webNoticeExcluded, "added"
+	if remove {
+		notice, details = webNoticeExclusionRemoved, "removed"
+	}
+	h.audit(r.Context(), e, s.UserId, HostActionExclude, a, details+" exclusion with "+b)
+
+	h.webRedirect(w, r, path, notice, nil)
+}
+
+// webDraw draws the pairs, announcing the draw in the event's channel as
+// /randomize does.
+func (h *Handlers) webDraw(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, c, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionRandomize)
+	if err == nil {
+		err = checkEventActive(e)
+	}
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+	path := webEventPath(e) + "/host"
+
+	channelId := value(e.ChannelId)
+	e, err = h.draw(r.Context(), c, e, func(e *Event, d *Draw) {
+		_, err := PostSlackMessage(h.botToken, channelId, "<@"+s.UserId+"> is drawing the pairs of "+eventTitle(e)+". The draw's commitment is `"+d.Commitment+"`, its seed will be revealed on reveal day.")
+		if err != nil {
+			h.logger.Println(err)
+		}
+	})
+	if err != nil {
+		h.webRedirect(w, r, path, "", err)
+		return
+	}
+
+	_, err = PostSlackMessage(h.botToken, channelId, "<!channel> "+eventTitle(e)+" pairs have been randomized!")
+	if err != nil {
+		h.logger.Println(err)
+	}
+	h.webRedirect(w, r, path, webNoticeDrawn, nil)
+}
+
+// webExport downloads the event's export, as JSON or, with format=csv, as
+// a CSV roster.
+func (h *Handlers) webExport(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, c, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionExport)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	export, err := h.hostExport(r.Context(), c, e, r.URL.Query().Get("assignments") == "true")
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+e.Id+"."+format+"\"")
+	if format == ExportFormatCsv {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err = WriteRosterCsv(w, export)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(export)
+	}
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// webMyData downloads everything stored about the user as JSON.
+func (h *Handlers) webMyData(w http.ResponseWriter, r *http.Request, s *webSession) {
+	data, err := h.MyData(r.Context(), webCaller(s))
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\"secret-santa-"+s.UserId+".json\"")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(data)
+	if err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// webImport enrolls the participants of an uploaded CSV roster, or only
+// checks it, and shows the console with the outcome.
+func (h *Handlers) webImport(w http.ResponseWriter, r *http.Request, s *webSession) {
+	e, c, err := h.webHostEvent(r.Context(), s, mux.Vars(r)["eventId"], HostActionImport)
+	if err != nil {
+		h.webFailure(w, r, s, err)
+		return
+	}
+	path := webEventPath(e) + "/host"
+
+	file, _, err := r.FormFile("roster")
+	if err != nil {
+		h.webRedirect(w, r, path, "", invalidError(webErrors[webErrorNoRoster]))
+		return
+	}
+	defer file.Close()
+
+	report, err := h.hostImport(r.Context(), c, e, file, r.PostForm.Get("dryRun") != "")
+	if err != nil {
+		h.webRedirect(w, r, path, "", err)
+		return
+	}
+	h.renderHost(w, r, s, e, report)
+}
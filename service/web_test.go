@@ -0,0 +1,210 @@
+// web_test.go
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testWebUI(t *testing.T, fill byte) *WebUI {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), 32)))
+	u, err := NewWebUI("https://santa.example.com/", "client", "secret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestNewWebUI(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name       string
+		baseUrl    string
+		clientId   string
+		sessionKey string
+		wantNil    bool
+		wantErr    bool
+	}{
+		{"not configured", "", "", "", true, false},
+		{"no base URL", "", "client", key, true, true},
+		{"short session key", "https://santa.example.com", "client", base64.StdEncoding.EncodeToString(make([]byte, 16)), true, true},
+		{"valid", "https://santa.example.com", "client", key, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewWebUI(tt.baseUrl, tt.clientId, "secret", tt.sessionKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWebUI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (u == nil) != tt.wantNil {
+				t.Errorf("NewWebUI() = %v, want nil %v", u, tt.wantNil)
+			}
+		})
+	}
+}
+
+// sessionCookie returns the session cookie u sets for s.
+func sessionCookie(t *testing.T, u *WebUI, s *webSession) *http.Cookie {
+	w := httptest.NewRecorder()
+	if err := u.setSession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("setSession() set %+v", cookies)
+	}
+	return cookies[0]
+}
+
+func TestWebSession(t *testing.T) {
+	u := testWebUI(t, 'a')
+	valid := &webSession{Csrf: "csrf", ExpiresAt: time.Now().Add(time.Hour), TeamId: "T1", UserId: "U1", UserName: "jane"}
+	cookie := sessionCookie(t, u, valid)
+
+	tampered := *cookie
+	tampered.Value = strings.Replace(cookie.Value, cookie.Value[:4], "AAAA", 1)
+	unsigned := *cookie
+	unsigned.Value = strings.Split(cookie.Value, ".")[0]
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		u      *WebUI
+		want   bool
+	}{
+		{"valid", cookie, u, true},
+		{"no cookie", nil, u, false},
+		{"tampered", &tampered, u, false},
+		{"unsigned", &unsigned, u, false},
+		{"other session key", cookie, testWebUI(t, 'b'), false},
+		{"expired", sessionCookie(t, u, &webSession{ExpiresAt: time.Now().Add(-time.Minute), UserId: "U1"}), u, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/web/", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			s := tt.u.session(r)
+			if (s != nil) != tt.want {
+				t.Fatalf("session() = %+v, want a session %v", s, tt.want)
+			}
+			if s != nil && (s.UserId != valid.UserId || s.TeamId != valid.TeamId || s.Csrf != valid.Csrf) {
+				t.Errorf("session() = %+v, want %+v", s, valid)
+			}
+		})
+	}
+}
+
+func TestWebHandlerCsrf(t *testing.T) {
+	u := testWebUI(t, 'a')
+	h := &Handlers{SecretSanta: &SecretSanta{logger: log.New(io.Discard, "", 0)}, web: u}
+	cookie := sessionCookie(t, u, &webSession{Csrf: "csrf", ExpiresAt: time.Now().Add(time.Hour), UserId: "U1"})
+
+	tests := []struct {
+		name       string
+		method     string
+		cookie     *http.Cookie
+		csrf       string
+		wantStatus int
+	}{
+		{"page", http.MethodGet, cookie, "", http.StatusOK},
+		{"form", http.MethodPost, cookie, "csrf", http.StatusOK},
+		{"form without token", http.MethodPost, cookie, "", http.StatusForbidden},
+		{"form with wrong token", http.MethodPost, cookie, "other", http.StatusForbidden},
+		{"signed out", http.MethodPost, nil, "csrf", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := h.webHandler(func(w http.ResponseWriter, r *http.Request, s *webSession) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			form := url.Values{"csrf": {tt.csrf}}
+			r := httptest.NewRequest(tt.method, "/web/events/E1/enroll", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("handler called = %v", called)
+			}
+		})
+	}
+}
+
+func TestWebRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		notice string
+		err    error
+		want   string
+	}{
+		{"nothing to tell", "", nil, "/web/events/E1"},
+		{"notice", webNoticeEnrolled, nil, "/web/events/E1?notice=enrolled"},
+		{"domain error", "", conflictError("Pairs have been drawn already"), "/web/events/E1?error=conflict"},
+		{"error with its own code", "", invalidError(webErrors[webErrorSamePair]), "/web/events/E1?error=samePair"},
+		{"other error", webNoticeEnrolled, errors.New("connection refused"), "/web/events/E1?error=internal"},
+	}
+
+	h := &Handlers{SecretSanta: &SecretSanta{logger: log.New(io.Discard, "", 0)}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.webRedirect(w, httptest.NewRequest(http.MethodPost, "/web/events/E1/enroll", nil), "/web/events/E1", tt.notice, tt.err)
+			if got := w.Header().Get("Location"); got != tt.want {
+				t.Errorf("redirect to %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderWebMessages checks that pages only show the messages of the
+// service, not text that a link puts in their query.
+func TestRenderWebMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"notice", "notice=profileSaved", webNotices[webNoticeProfileSaved]},
+		{"error", "error=notFound", webErrors[ErrorKindNotFound]},
+		{"text as notice", "notice=" + url.QueryEscape("Your account is locked, call 555-0100"), ""},
+		{"text as error", "error=" + url.QueryEscape("Your account is locked, call 555-0100"), ""},
+	}
+
+	h := &Handlers{SecretSanta: &SecretSanta{logger: log.New(io.Discard, "", 0)}, web: testWebUI(t, 'a')}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.renderWeb(w, httptest.NewRequest(http.MethodGet, "/web?"+tt.query, nil), http.StatusOK, "error", nil, &webPage{Title: "Secret Santa"})
+			body := w.Body.String()
+			if strings.Contains(body, "555-0100") {
+				t.Error("page shows the text of its query")
+			}
+			if tt.want != "" && !strings.Contains(body, tt.want) {
+				t.Errorf("page does not show %q", tt.want)
+			}
+		})
+	}
+}
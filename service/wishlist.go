@@ -0,0 +1,138 @@
+// wishlist.go
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const wishlistUsage string = `Usage: /santa wishlist [items="Books, warm socks"] [links="https://..."] [sizes="M, shoes 42"] [allergies="Nuts"] [no="Candles"] | /santa wishlist clear`
+
+var wishlistKeys = []string{"items", "links", "sizes", "allergies", "no"}
+
+func applyWishlist(wl *Wishlist, opts map[string]string) {
+	for key, value := range opts {
+		value = strings.TrimSpace(value)
+		switch key {
+		case "items":
+			wl.Items = optionalString(value)
+		case "links":
+			wl.Links = optionalString(value)
+		case "sizes":
+			wl.Sizes = optionalString(value)
+		case "allergies":
+			wl.Allergies = optionalString(value)
+		case "no":
+			wl.NoThanks = optionalString(value)
+		}
+	}
+}
+
+// wishlistLines lists the wishlist, one entry per line, for adding to
+// messages. It is empty if there is nothing on the wishlist.
+func wishlistLines(wl *Wishlist) string {
+	if wl == nil {
+		return ""
+	}
+
+	lines := ""
+	if wl.Items != nil {
+		lines += "\n• Wishes: " + *wl.Items
+	}
+	if wl.Links != nil {
+		lines += "\n• Links: " + *wl.Links
+	}
+	if wl.Sizes != nil {
+		lines += "\n• Sizes: " + *wl.Sizes
+	}
+	if wl.Allergies != nil {
+		lines += "\n• Allergies: " + *wl.Allergies
+	}
+	if wl.NoThanks != nil {
+		lines += "\n• Please no: " + *wl.NoThanks
+	}
+	return lines
+}
+
+// wishlistDetails is the wishlist of a giftee as shown to their santa.
+func wishlistDetails(wl *Wishlist) string {
+	lines := wishlistLines(wl)
+	if lines == "" {
+		return ""
+	}
+	return "\nTheir wishlist:" + lines
+}
+
+func (h *Handlers) wishlistCommand(w http.ResponseWriter, r *http.Request, req *SlackRequest, eventName string, args []string) {
+	e, err := h.findEvent(r.Context(), &req.Caller, eventName)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	p, err := h.repo.GetParticipantById(r.Context(), e.Id, req.UserId)
+	if err != nil {
+		err = errors.New("You are not taking part in " + eventTitle(e) + ", please enroll with /participate first")
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	if len(args) == 0 {
+		lines := wishlistLines(p.Wishlist)
+		if lines == "" {
+			lines = "\nYour wishlist is empty. " + wishlistUsage
+		}
+		writeSlackMessage(w, ResponseTypeEphemeral, "Your "+eventTitle(e)+" wishlist:"+lines)
+		return
+	}
+
+	if len(args) == 1 && strings.ToLower(args[0]) == "clear" {
+		p.Wishlist = nil
+	} else {
+		rest, opts := parseOptions(strings.Join(args, " "), wishlistKeys)
+		if rest != "" || len(opts) == 0 {
+			writeSlackMessage(w, ResponseTypeEphemeral, wishlistUsage)
+			return
+		}
+		if p.Wishlist == nil {
+			p.Wishlist = &Wishlist{}
+		}
+		applyWishlist(p.Wishlist, opts)
+	}
+
+	err = h.repo.UpdateWishlist(r.Context(), e.Id, req.UserId, p.Wishlist)
+	if err != nil {
+		h.logger.Println(err)
+		writeSlackMessage(w, ResponseTypeEphemeral, err.Error())
+		return
+	}
+
+	lines := wishlistLines(p.Wishlist)
+	if lines == "" {
+		lines = "\nThe wishlist is empty now."
+	}
+
+	h.tellSantasAboutWishlist(r.Context(), e, req.UserId, lines)
+
+	writeSlackMessage(w, ResponseTypeEphemeral, "Your "+eventTitle(e)+" wishlist:"+lines)
+}
+
+// tellSantasAboutWishlist lets the santas of a giftee know that the giftee
+// changed their wishlist, once pairs are matched.
+func (h *Handlers) tellSantasAboutWishlist(ctx context.Context, e *Event, uid string, lines string) {
+	santas, err := h.getSantas(ctx, e, uid)
+	if err != nil {
+		h.logger.Println(err)
+	}
+	for _, santa := range santas {
+		msg := "Your " + eventTitle(e) + " match <@" + uid + "> updated their wishlist:" + lines
+		_, err = PostSlackMessage(h.botToken, santa.UserId, msg)
+		if err != nil {
+			h.logger.Println(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// wishlist_test.go
+package service
+
+import "testing"
+
+func TestWishlistDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		start Wishlist
+		text  string
+		want  string
+	}{
+		{
+			name: "empty",
+			text: "",
+			want: "",
+		},
+		{
+			name: "every entry",
+			text: `items="Books, warm socks" links=https://example.com sizes="M, shoes 42" allergies=Nuts no=Candles`,
+			want: "\nTheir wishlist:\n• Wishes: Books, warm socks\n• Links: https://example.com\n• Sizes: M, shoes 42\n• Allergies: Nuts\n• Please no: Candles",
+		},
+		{
+			name:  "keeps what is not mentioned",
+			start: Wishlist{Items: optionalString("Tea")},
+			text:  "sizes=L",
+			want:  "\nTheir wishlist:\n• Wishes: Tea\n• Sizes: L",
+		},
+		{
+			name:  "empty value clears",
+			start: Wishlist{Items: optionalString("Tea")},
+			text:  `items=""`,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wl := tt.start
+			_, opts := parseOptions(tt.text, wishlistKeys)
+			applyWishlist(&wl, opts)
+			if got := wishlistDetails(&wl); got != tt.want {
+				t.Errorf("wishlistDetails() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := wishlistDetails(nil); got != "" {
+		t.Errorf("wishlistDetails(nil) = %q, want empty", got)
+	}
+}